@@ -8,83 +8,206 @@ import (
 
 type Expr interface {
 	Eval(sc *Scope) (*Object, error)
+	// Pos returns the position of the first token of the expression, it's not valid for nodes
+	// which are not created by the parser.
+	Pos() token.Position
 	// Given the scope, collects all the unresolved identifiers in the expression, used for closure capture.
 	collectUnresolvedNames(*Scope, map[string]bool)
 }
 
 type (
 	NilExpr struct {
+		Position token.Position
 	}
 
 	IdentExpr struct {
-		Name string
+		Position token.Position
+		Name     string
 	}
 
 	NumExpr struct {
-		Value float64
+		Position token.Position
+		Kind     ObjKind     // Int, BigInt, Ratio or Double.
+		Value    interface{} // int64, *big.Int, *big.Rat or float64 depending on Kind.
 	}
 
 	BooleanExpr struct {
-		Bool bool
+		Position token.Position
+		Bool     bool
+	}
+
+	StringExpr struct {
+		Position token.Position
+		Value    string
+	}
+
+	VectorExpr struct {
+		Position token.Position
+		Exprs    *ExprList
 	}
 
 	DefExpr struct {
-		Ident *IdentExpr
-		Expr  Expr
+		Position token.Position
+		Ident    *IdentExpr
+		Expr     Expr
+		// Doc is the docstring, (def name "doc" expr), and Meta the metadata map written before the
+		// name, (def ^{:deprecated true} name expr). Both are optional.
+		Doc  string
+		Meta []*MetaEntry
 	}
 
 	DefnExpr struct {
-		Ident *IdentExpr
-		Expr  Expr
+		Position token.Position
+		Ident    *IdentExpr
+		Expr     Expr
+		// Private is set for defn-, the function can't be used by other modules.
+		Private bool
+		// Doc and Meta are the docstring and metadata map like for def,
+		// (defn ^{...} name "doc" [params] body).
+		Doc  string
+		Meta []*MetaEntry
+	}
+
+	// MetaEntry is an entry of the metadata map of a definition, its value is evaluated when the
+	// definition is.
+	MetaEntry struct {
+		Position token.Position
+		Key      string // Like :deprecated.
+		Value    Expr
 	}
 
 	FuncExpr struct {
-		Params []*IdentExpr
-		Expr   Expr
+		Position token.Position
+		Params   []*IdentExpr
+		// ParamTags holds the type hints of the parameters, written ^Tag before them, with an
+		// empty string for the parameters without one. It's nil if no parameter has a hint.
+		ParamTags []string
+		// ResultTag is the type hint of the result, written ^Tag after the parameters.
+		ResultTag string
+		// Pre and Post are the conditions checked before and after a call, written
+		// {:pre [...] :post [...]} before the body, nil if there are none. The result is bound to %
+		// in the post-conditions.
+		Pre  *ExprList
+		Post *ExprList
+		// PreSource and PostSource are the texts of the conditions, see AssertExpr.
+		PreSource, PostSource []string
+		Expr                  Expr
 	}
 
 	ExprList struct {
-		Exprs []Expr
+		Position token.Position
+		Exprs    []Expr
 	}
 
 	CallExpr struct {
+		Position token.Position
 		// Fun is an expression returns a function object.
 		Fun  Expr
 		Args *ExprList
 	}
 
 	DoExpr struct {
-		Exprs *ExprList
+		Position token.Position
+		Exprs    *ExprList
 	}
 
 	IfExpr struct {
-		Cond Expr
-		Then Expr
-		Else Expr
+		Position token.Position
+		Cond     Expr
+		Then     Expr
+		Else     Expr
 	}
 
 	BinaryOp struct {
-		Op    token.Token
-		Left  Expr
-		Right Expr
+		Position token.Position
+		Op       token.Token
+		Left     Expr
+		Right    Expr
 	}
 
 	MultiOp struct {
-		Op    token.Token
-		Exprs *ExprList
+		Position token.Position
+		Op       token.Token
+		Exprs    *ExprList
 	}
 
 	BindExpr struct {
-		Ident *IdentExpr
-		Value Expr
+		Position token.Position
+		Ident    *IdentExpr
+		Value    Expr
 	}
 
 	LetExpr struct {
+		Position token.Position
 		Bindings []*BindExpr
 		Body     Expr
 	}
+
+	// LazySeqExpr evaluates to a lazy sequence, Body is evaluated when the elements are needed.
+	LazySeqExpr struct {
+		Position token.Position
+		Body     Expr
+	}
+
+	// AssertExpr fails with a ContractError if Cond is false or nil, Msg is an optional message.
+	// Source is the text of Cond reported by the error. The parser takes it before Cond may be
+	// changed by optimizations, it's rendered from Cond if empty.
+	AssertExpr struct {
+		Position token.Position
+		Cond     Expr
+		Msg      Expr
+		Source   string
+	}
+
+	// NsExpr names the namespace of a program or module, (ns my.lib "doc").
+	NsExpr struct {
+		Position token.Position
+		Name     *IdentExpr
+		Doc      string
+	}
+
+	// RequireExpr loads modules, (require '[my.lib :as lib :refer [f]] 'other.lib).
+	RequireExpr struct {
+		Position token.Position
+		Specs    []*RequireSpec
+	}
+
+	// RequireSpec is a module loaded by require. Its names are used qualified by the name of the
+	// module or by Alias, like lib/f, and the names in Refer, or all of them if ReferAll is set,
+	// are also bound unqualified.
+	RequireSpec struct {
+		Position token.Position
+		Module   *IdentExpr
+		Alias    *IdentExpr // Nil without :as.
+		Refer    []*IdentExpr
+		ReferAll bool
+	}
 )
 
+// Pos implementation.
+func (expr *NilExpr) Pos() token.Position     { return expr.Position }
+func (expr *IdentExpr) Pos() token.Position   { return expr.Position }
+func (expr *NumExpr) Pos() token.Position     { return expr.Position }
+func (expr *BooleanExpr) Pos() token.Position { return expr.Position }
+func (expr *StringExpr) Pos() token.Position  { return expr.Position }
+func (expr *VectorExpr) Pos() token.Position  { return expr.Position }
+func (expr *DefExpr) Pos() token.Position     { return expr.Position }
+func (expr *DefnExpr) Pos() token.Position    { return expr.Position }
+func (expr *FuncExpr) Pos() token.Position    { return expr.Position }
+func (expr *ExprList) Pos() token.Position    { return expr.Position }
+func (expr *CallExpr) Pos() token.Position    { return expr.Position }
+func (expr *DoExpr) Pos() token.Position      { return expr.Position }
+func (expr *IfExpr) Pos() token.Position      { return expr.Position }
+func (expr *BinaryOp) Pos() token.Position    { return expr.Position }
+func (expr *MultiOp) Pos() token.Position     { return expr.Position }
+func (expr *BindExpr) Pos() token.Position    { return expr.Position }
+func (expr *LetExpr) Pos() token.Position     { return expr.Position }
+func (expr *LazySeqExpr) Pos() token.Position { return expr.Position }
+func (expr *AssertExpr) Pos() token.Position  { return expr.Position }
+func (expr *NsExpr) Pos() token.Position      { return expr.Position }
+func (expr *RequireExpr) Pos() token.Position { return expr.Position }
+func (expr *RequireSpec) Pos() token.Position { return expr.Position }
+
 func (*NilExpr) Eval(sc *Scope) (*Object, error) {
 	return NilObj, nil
 }
@@ -93,19 +216,35 @@ func (*NilExpr) Eval(sc *Scope) (*Object, error) {
 func (expr *IdentExpr) Eval(sc *Scope) (*Object, error) {
 	obj := sc.Lookup(expr.Name)
 	if obj == nil {
-		return nil, fmt.Errorf("%q is not defined.", expr.Name)
+		return nil, sc.undefined(expr.Name)
 	}
 	return obj, nil
 }
 
 func (expr *NumExpr) Eval(sc *Scope) (*Object, error) {
-	return createDouble(expr.Value), nil
+	return &Object{Kind: expr.Kind, Value: expr.Value}, nil
 }
 
 func (expr *BooleanExpr) Eval(sc *Scope) (*Object, error) {
 	return createBoolean(expr.Bool), nil
 }
 
+func (expr *StringExpr) Eval(sc *Scope) (*Object, error) {
+	return createString(expr.Value), nil
+}
+
+func (expr *VectorExpr) Eval(sc *Scope) (*Object, error) {
+	list, err := expr.Exprs.Eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	vec := createVector(list.Value.([]*Object))
+	if err := sc.state.alloc(sizeOf(vec)); err != nil {
+		return nil, err
+	}
+	return vec, nil
+}
+
 func (expr *DefExpr) Eval(sc *Scope) (*Object, error) {
 	obj, err := expr.Expr.Eval(sc)
 	if err != nil {
@@ -114,6 +253,12 @@ func (expr *DefExpr) Eval(sc *Scope) (*Object, error) {
 	if obj == NilObj {
 		return nil, fmt.Errorf("Can't bind nil object to symbol.")
 	}
+	meta, err := defMeta(sc, expr, expr.Ident.Name, expr.Doc, expr.Meta, false)
+	if err != nil {
+		return nil, err
+	}
+	// The object may be bound to other names, the metadata belongs to this one.
+	obj = &Object{Kind: obj.Kind, Value: obj.Value, Meta: meta}
 	// Put it into symbol table.
 	sc.Insert(expr.Ident.Name, obj)
 	return NilObj, nil
@@ -130,6 +275,10 @@ func (expr *DefnExpr) Eval(sc *Scope) (*Object, error) {
 	if obj == NilObj {
 		return nil, fmt.Errorf("Can't bind nil object to symbol.")
 	}
+	obj.Value.(*FuncValue).Name = expr.Ident.Name
+	if obj.Meta, err = defMeta(sc, expr, expr.Ident.Name, expr.Doc, expr.Meta, expr.Private); err != nil {
+		return nil, err
+	}
 	// Put it into symbol table.
 	sc.Insert(expr.Ident.Name, obj)
 	return NilObj, nil
@@ -143,7 +292,12 @@ func (expr *FuncExpr) Eval(sc *Scope) (*Object, error) {
 	unresolvedNames := make(map[string]bool)
 	expr.collectUnresolvedNames(NewScope(nil), unresolvedNames)
 	closure := NewScope(nil)
+	closure.state, closure.ns = sc.state, sc.ns
 	funcObj := createFunc(closure, params, expr.Expr)
+	fn := funcObj.Value.(*FuncValue)
+	fn.ParamTags, fn.ResultTag = expr.ParamTags, expr.ResultTag
+	fn.Pre, fn.Post = expr.Pre, expr.Post
+	fn.PreSource, fn.PostSource = expr.PreSource, expr.PostSource
 	// Capture all the unresolved names from current scope.
 	for name, _ := range unresolvedNames {
 		obj := sc.Lookup(name)
@@ -156,6 +310,9 @@ func (expr *FuncExpr) Eval(sc *Scope) (*Object, error) {
 			closure.Insert(name, obj)
 		}
 	}
+	if err := sc.state.alloc(sizeOf(funcObj)); err != nil {
+		return nil, err
+	}
 	return funcObj, nil
 }
 
@@ -176,25 +333,21 @@ func (expr *CallExpr) Eval(sc *Scope) (*Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	if obj.Kind != Func {
+	if obj.Kind != Func && obj.Kind != Builtin {
 		return nil, fmt.Errorf("The object is not a function object.")
 	}
-	funObj := obj.Value.(*FuncValue)
-	numParams := len(funObj.Params)
-	numArgs := len(expr.Args.Exprs)
-	if numParams != numArgs {
-		return nil, fmt.Errorf("Wrong number of arguments(%d), expect %d", numArgs, numParams)
+	if obj.Kind == Func {
+		numParams := len(obj.Value.(*FuncValue).Params)
+		numArgs := len(expr.Args.Exprs)
+		if numParams != numArgs {
+			return nil, fmt.Errorf("Wrong number of arguments(%d), expect %d", numArgs, numParams)
+		}
 	}
 	argList, err := expr.Args.Eval(sc)
 	if err != nil {
 		return nil, err
 	}
-	args := argList.Value.([]*Object)
-	// Binding arguments to function's closure.
-	for idx, param := range funObj.Params {
-		funObj.Closure.Insert(param, args[idx])
-	}
-	return funObj.Body.Eval(funObj.Closure)
+	return Apply(obj, argList.Value.([]*Object))
 }
 
 func (expr *DoExpr) Eval(sc *Scope) (*Object, error) {
@@ -226,6 +379,9 @@ func (expr *IfExpr) Eval(sc *Scope) (*Object, error) {
 }
 
 func (expr *BinaryOp) Eval(sc *Scope) (*Object, error) {
+	if err := checkOperator(sc, expr.Op); err != nil {
+		return nil, err
+	}
 	left, err := expr.Left.Eval(sc)
 	if err != nil {
 		return nil, err
@@ -234,61 +390,49 @@ func (expr *BinaryOp) Eval(sc *Scope) (*Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	if left.Kind != right.Kind {
-		return nil, fmt.Errorf("left operand and right operand have different types.")
+	if expr.Op == token.EQ {
+		eq, err := equal(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return createBoolean(eq), nil
 	}
-	if left.Kind != Double {
-		return nil, fmt.Errorf("You can only compare double numbers.")
+	if !isNumber(left) || !isNumber(right) {
+		return nil, fmt.Errorf("You can only compare numbers.")
 	}
-	v1 := left.Value.(float64)
-	v2 := right.Value.(float64)
+	cmp := compareNums(left, right)
 	switch expr.Op {
 	case token.LT:
-		return createBoolean(v1 < v2), nil
+		return createBoolean(cmp < 0), nil
 	case token.LE:
-		return createBoolean(v1 <= v2), nil
+		return createBoolean(cmp <= 0), nil
 	case token.GT:
-		return createBoolean(v1 > v2), nil
+		return createBoolean(cmp > 0), nil
 	case token.GE:
-		return createBoolean(v1 >= v2), nil
-	case token.EQ:
-		return createBoolean(v1 == v2), nil
+		return createBoolean(cmp >= 0), nil
 	}
 	return nil, fmt.Errorf("invalid op %q", token.TokenName(expr.Op))
 }
 
 func (expr *MultiOp) Eval(sc *Scope) (*Object, error) {
+	if err := checkOperator(sc, expr.Op); err != nil {
+		return nil, err
+	}
 	list, err := expr.Exprs.Eval(sc)
 	if err != nil {
 		return nil, err
 	}
-	objects := list.Value.([]*Object)
-	if len(objects) == 0 {
-		return NilObj, nil
-	}
-	var opFun func(v1, v2 float64) float64
-	switch expr.Op {
-	case token.ADD:
-		opFun = func(v1, v2 float64) float64 { return v1 + v2 }
-	case token.MULT:
-		opFun = func(v1, v2 float64) float64 { return v1 * v2 }
-	case token.DIV:
-		opFun = func(v1, v2 float64) float64 { return v1 / v2 }
-	case token.SUB:
-		opFun = func(v1, v2 float64) float64 { return v1 - v2 }
-	}
-	if objects[0].Kind != Double {
-		return nil, fmt.Errorf("operand must be double numbers")
-	}
-	operand := objects[0].Value.(float64)
-	for _, obj := range objects[1:] {
-		if obj.Kind != Double {
-			return nil, fmt.Errorf("operand must be double numbers")
-		}
-		v := obj.Value.(float64)
-		operand = opFun(operand, v)
+	return arithBuiltin(expr.Op)(list.Value.([]*Object))
+}
+
+// checkOperator returns an error unless op is defined in sc. The operators in call position are
+// parsed apart from other calls, but they are builtins granted by the core capability like the
+// others.
+func checkOperator(sc *Scope, op token.Token) error {
+	if name := token.TokenName(op); sc.Lookup(name) == nil {
+		return sc.undefined(name)
 	}
-	return createDouble(operand), nil
+	return nil
 }
 
 func (expr *BindExpr) Eval(sc *Scope) (*Object, error) {
@@ -301,6 +445,11 @@ func (expr *BindExpr) Eval(sc *Scope) (*Object, error) {
 }
 
 func (expr *LetExpr) Eval(sc *Scope) (*Object, error) {
+	size := scopeSizeOf(len(expr.Bindings))
+	if err := sc.state.alloc(size); err != nil {
+		return nil, err
+	}
+	defer sc.state.free(size)
 	newScope := NewScope(sc)
 	for _, binding := range expr.Bindings {
 		_, err := binding.Eval(newScope)
@@ -311,8 +460,46 @@ func (expr *LetExpr) Eval(sc *Scope) (*Object, error) {
 	return expr.Body.Eval(newScope)
 }
 
+func (expr *LazySeqExpr) Eval(sc *Scope) (*Object, error) {
+	seq := createLazySeq(sc.state, func() (*Object, error) {
+		return expr.Body.Eval(sc)
+	})
+	if err := sc.state.alloc(sizeOf(seq)); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+func (expr *AssertExpr) Eval(sc *Scope) (*Object, error) {
+	if !CheckContracts {
+		return NilObj, nil
+	}
+	cond, err := expr.Cond.Eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(cond) {
+		return NilObj, nil
+	}
+	e := &ContractError{Kind: "assertion", Expr: expr.Source, Pos: expr.Position}
+	if e.Expr == "" {
+		e.Expr = SourceText(expr.Cond)
+	}
+	if expr.Msg != nil {
+		msg, err := expr.Msg.Eval(sc)
+		if err != nil {
+			return nil, err
+		}
+		e.Msg = msg.String()
+		if msg.Kind == String {
+			e.Msg = msg.Value.(string)
+		}
+	}
+	return nil, e
+}
+
 func (expr *NilExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
-	panic("why tring to find unresolved names in nil expression")
+	// Do nothing.
 }
 
 // collectUnresolvedNames implementation.
@@ -331,14 +518,35 @@ func (expr *BooleanExpr) collectUnresolvedNames(sc *Scope, names map[string]bool
 	// Do nothing.
 }
 
+func (expr *StringExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	// Do nothing.
+}
+
+func (expr *VectorExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	expr.Exprs.collectUnresolvedNames(sc, names)
+}
+
 func (expr *DefExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
-	// def should be only allowed to in outer-most scope, it shouldn't be called.
-	panic("why trying to find unresolved names in def expression.")
+	// def belongs at the top level, but inside a function it binds the name in the scope of the
+	// call, so the following expressions see it like a let binding.
+	collectMetaNames(expr.Meta, sc, names)
+	expr.Expr.collectUnresolvedNames(sc, names)
+	sc.Insert(expr.Ident.Name, NilObj)
 }
 
 func (expr *DefnExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
-	// defn should be only allowed to in outer-most scope, it shouldn't be called.
-	panic("why trying to find unresolved names in def expression.")
+	collectMetaNames(expr.Meta, sc, names)
+	// The function can call itself by name.
+	newScope := NewScope(sc)
+	newScope.Insert(expr.Ident.Name, NilObj)
+	expr.Expr.collectUnresolvedNames(newScope, names)
+	sc.Insert(expr.Ident.Name, NilObj)
+}
+
+func collectMetaNames(meta []*MetaEntry, sc *Scope, names map[string]bool) {
+	for _, entry := range meta {
+		entry.Value.collectUnresolvedNames(sc, names)
+	}
 }
 
 func (expr *FuncExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
@@ -347,7 +555,15 @@ func (expr *FuncExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
 		// Add parameter names to scope, these don't need to be marked as unresolved inside of function.
 		newScope.Insert(param.Name, NilObj)
 	}
+	if expr.Pre != nil {
+		expr.Pre.collectUnresolvedNames(newScope, names)
+	}
 	expr.Expr.collectUnresolvedNames(newScope, names)
+	if expr.Post != nil {
+		postScope := NewScope(newScope)
+		postScope.Insert("%", NilObj)
+		expr.Post.collectUnresolvedNames(postScope, names)
+	}
 }
 
 func (expr *ExprList) collectUnresolvedNames(sc *Scope, names map[string]bool) {
@@ -372,14 +588,24 @@ func (expr *IfExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
 }
 
 func (expr *BinaryOp) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	collectOperator(expr.Op, sc, names)
 	expr.Left.collectUnresolvedNames(sc, names)
 	expr.Right.collectUnresolvedNames(sc, names)
 }
 
 func (expr *MultiOp) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	collectOperator(expr.Op, sc, names)
 	expr.Exprs.collectUnresolvedNames(sc, names)
 }
 
+// collectOperator adds the name of op to names unless it's bound in sc, the operators are looked up
+// like the other builtins.
+func collectOperator(op token.Token, sc *Scope, names map[string]bool) {
+	if name := token.TokenName(op); sc.Lookup(name) == nil {
+		names[name] = true
+	}
+}
+
 func (expr *BindExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
 	expr.Value.collectUnresolvedNames(sc, names)
 	sc.Insert(expr.Ident.Name, NilObj)
@@ -392,3 +618,31 @@ func (expr *LetExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
 	}
 	expr.Body.collectUnresolvedNames(newScope, names)
 }
+
+func (expr *LazySeqExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	expr.Body.collectUnresolvedNames(sc, names)
+}
+
+func (expr *AssertExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	expr.Cond.collectUnresolvedNames(sc, names)
+	if expr.Msg != nil {
+		expr.Msg.collectUnresolvedNames(sc, names)
+	}
+}
+
+func (expr *NsExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	// Do nothing.
+}
+
+func (expr *RequireExpr) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	for _, spec := range expr.Specs {
+		spec.collectUnresolvedNames(sc, names)
+	}
+}
+
+func (expr *RequireSpec) collectUnresolvedNames(sc *Scope, names map[string]bool) {
+	// The referred names are bound like by def, the names of all the module are not known.
+	for _, ident := range expr.Refer {
+		sc.Insert(ident.Name, NilObj)
+	}
+}
@@ -0,0 +1,172 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// Options configures the environment of a global scope.
+type Options struct {
+	// Stdout is where the printing builtins write to, os.Stdout if nil.
+	Stdout io.Writer
+	// Capabilities decides which builtins are defined, all of them if nil.
+	Capabilities *Capabilities
+	// Rand is the source of the random builtins, one seeded with the time if nil.
+	Rand *rand.Rand
+	// FS is the file system of the file builtins, the one of the host if nil. The builtins
+	// writing files fail unless it's a WritableFS.
+	FS fs.FS
+	// Loader finds the modules loaded by require, which fails if it's nil. The modules get the
+	// same builtins as the program.
+	Loader Loader
+}
+
+// NewGlobalScope creates a top-level scope with all the builtin functions defined.
+func NewGlobalScope() *Scope {
+	return NewGlobalScopeWithOptions(&Options{})
+}
+
+// NewGlobalScopeWithOptions creates a top-level scope with the builtin functions granted by the
+// capabilities of opts, the builtins interacting with the host are configured by opts.
+func NewGlobalScopeWithOptions(opts *Options) *Scope {
+	// The state is created up front so that the builtins and the closures of functions defined in
+	// the scope share it.
+	sc := newBuiltinScope(opts, &evalState{})
+	sc.ns = newNamespace("user", sc, &modules{opts: *opts, loaded: make(map[string]*namespace)})
+	return sc
+}
+
+// newBuiltinScope creates a scope with the builtin functions configured by opts, evaluated with the
+// limits of st.
+func newBuiltinScope(opts *Options, st *evalState) *Scope {
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	caps := opts.Capabilities
+	if caps == nil {
+		caps = AllCapabilities()
+	}
+	r := opts.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	sc := NewScope(nil)
+	sc.state = st
+	define := func(name string, fn func(args []*Object) (*Object, error)) {
+		sc.Insert(name, createBuiltin(st, name, fn))
+	}
+	insert := func(builtins map[string]func(args []*Object) (*Object, error)) {
+		for name, fn := range builtins {
+			define(name, fn)
+		}
+	}
+	if caps.Has("core") {
+		for _, op := range []token.Token{token.ADD, token.SUB, token.MULT, token.DIV} {
+			define(token.TokenName(op), arithBuiltin(op))
+		}
+		for _, op := range []token.Token{token.LT, token.GT, token.LE, token.GE, token.EQ} {
+			define(token.TokenName(op), compareBuiltin(op))
+		}
+		insert(coreBuiltins(st))
+	}
+	if caps.Has("io") {
+		insert(outputBuiltins(stdout))
+		insert(docBuiltins(stdout))
+	}
+	if caps.Has("os.env") {
+		insert(envBuiltins())
+	}
+	if caps.Has("time") {
+		insert(timeBuiltins(st))
+	}
+	if caps.Has("rand") {
+		insert(randBuiltins(r, st))
+	}
+	files := &fileAccess{fsys: opts.FS, caps: caps, state: st}
+	if files.fsys == nil {
+		files.fsys = osFS{}
+	}
+	if caps.readsFiles() {
+		insert(fileReadBuiltins(files))
+	}
+	if caps.writesFiles() {
+		insert(fileWriteBuiltins(files))
+	}
+	return sc
+}
+
+// arithBuiltin returns the variadic function for an arithmetic operator. Like in Clojure, (+) is 0,
+// (*) is 1, (- x) negates x and (/ x) is the reciprocal of x.
+func arithBuiltin(op token.Token) func(args []*Object) (*Object, error) {
+	return func(args []*Object) (*Object, error) {
+		for _, arg := range args {
+			if !isNumber(arg) {
+				return nil, fmt.Errorf("operand must be numbers")
+			}
+		}
+		switch {
+		case len(args) == 0 && op == token.ADD:
+			return createInt(0), nil
+		case len(args) == 0 && op == token.MULT:
+			return createInt(1), nil
+		case len(args) == 0:
+			return nil, fmt.Errorf("Wrong number of arguments(0) passed to %s", token.TokenName(op))
+		case len(args) == 1 && op == token.SUB:
+			return arith(op, createInt(0), args[0])
+		case len(args) == 1 && op == token.DIV:
+			return arith(op, createInt(1), args[0])
+		}
+		res := args[0]
+		for _, arg := range args[1:] {
+			var err error
+			if res, err = arith(op, res, arg); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+}
+
+// compareBuiltin returns the variadic function for a comparison operator, which holds if each
+// argument is in the relation with the next one.
+func compareBuiltin(op token.Token) func(args []*Object) (*Object, error) {
+	return func(args []*Object) (*Object, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Wrong number of arguments(0) passed to %s", token.TokenName(op))
+		}
+		for i := 1; i < len(args); i++ {
+			if op == token.EQ {
+				if eq, err := equal(args[i-1], args[i]); err != nil || !eq {
+					return createBoolean(false), err
+				}
+				continue
+			}
+			if !isNumber(args[i-1]) || !isNumber(args[i]) {
+				return nil, fmt.Errorf("You can only compare numbers.")
+			}
+			cmp := compareNums(args[i-1], args[i])
+			var ok bool
+			switch op {
+			case token.LT:
+				ok = cmp < 0
+			case token.GT:
+				ok = cmp > 0
+			case token.LE:
+				ok = cmp <= 0
+			case token.GE:
+				ok = cmp >= 0
+			}
+			if !ok {
+				return createBoolean(false), nil
+			}
+		}
+		return createBoolean(true), nil
+	}
+}
@@ -0,0 +1,204 @@
+package ast
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// capabilitySets holds the names of the capabilities granting sets of builtins, the file system
+// capabilities are parsed apart.
+var capabilitySets = map[string]bool{"core": true, "io": true, "os.env": true, "time": true, "rand": true}
+
+// Capabilities is a set of capabilities granted to a program, they decide which builtins are
+// defined in its global scope and which files it may access, with the file builtins or by
+// requiring modules.
+//
+// The capabilities are named:
+//
+//	core        the arithmetic, comparison and collection functions
+//	io          printing to the standard output
+//	os.env      reading environment variables
+//	time        reading the clock and sleeping
+//	rand        random numbers
+//	fs          reading and writing any file
+//	fs:readonly reading any file
+//	fs:/dir     reading and writing the files under /dir
+type Capabilities struct {
+	sets map[string]bool
+	// readAll grants reading any file, roots are the directories whose files may be read and
+	// written.
+	readAll bool
+	roots   []string
+	names   []string
+
+	// opened holds the granted directories opened as roots by hostFile.
+	mu     sync.Mutex
+	opened map[string]*os.Root
+}
+
+// ParseCapabilities returns the capabilities with the given names.
+func ParseCapabilities(names ...string) (*Capabilities, error) {
+	c := &Capabilities{sets: make(map[string]bool)}
+	for _, name := range names {
+		switch {
+		case capabilitySets[name]:
+			c.sets[name] = true
+		case name == "fs":
+			c.roots = append(c.roots, string(filepath.Separator))
+		case name == "fs:readonly":
+			c.readAll = true
+		case strings.HasPrefix(name, "fs:"):
+			dir := strings.TrimPrefix(name, "fs:")
+			if !filepath.IsAbs(dir) {
+				return nil, fmt.Errorf("capability %q: the directory must be an absolute path", name)
+			}
+			c.roots = append(c.roots, resolvePath(dir))
+		default:
+			return nil, fmt.Errorf("unknown capability %q, expect one of %s, fs, fs:readonly or fs:/dir", name, strings.Join(CapabilityNames(), ", "))
+		}
+		c.names = append(c.names, name)
+	}
+	return c, nil
+}
+
+// AllCapabilities returns the capabilities granting everything, those of the gofp command.
+func AllCapabilities() *Capabilities {
+	c, _ := ParseCapabilities(append(CapabilityNames(), "fs")...)
+	return c
+}
+
+// CapabilityNames returns the names of the capabilities granting sets of builtins, sorted, the file
+// system capabilities are not included.
+func CapabilityNames() []string {
+	var names []string
+	for name := range capabilitySets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether the capability to use a set of builtins, like "io", is granted.
+func (c *Capabilities) Has(name string) bool {
+	return c.sets[name]
+}
+
+// CheckPath returns an *fs.PathError unless the file at path may be read, or written if write is true.
+// Symbolic links are followed so that a link can't give access to files out of the granted
+// directories.
+func (c *Capabilities) CheckPath(path string, write bool) error {
+	_, _, err := c.check(path, write)
+	return err
+}
+
+// ReadFile reads the file at path like os.ReadFile if it may be read.
+func (c *Capabilities) ReadFile(path string) ([]byte, error) {
+	fsys, name, err := c.hostFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// check returns the clean absolute path without symbolic links of the file at path, and the
+// granted directory holding it if any, unless the file may not be accessed.
+func (c *Capabilities) check(path string, write bool) (abs, root string, err error) {
+	if abs, err = filepath.Abs(path); err != nil {
+		return "", "", err
+	}
+	abs = resolvePath(abs)
+	for _, root := range c.roots {
+		if within(root, abs) {
+			return abs, root, nil
+		}
+	}
+	return abs, "", c.allows(abs, path, write)
+}
+
+// hostFile returns the file system of the host where the file at path is accessed and its name
+// there, unless it may not be accessed. The files of the granted directories are accessed through
+// an os.Root, so that a symbolic link changed after the check can't lead out of the directory.
+func (c *Capabilities) hostFile(path string, write bool) (fs.FS, string, error) {
+	abs, root, err := c.check(path, write)
+	if err != nil {
+		return nil, "", err
+	}
+	if root == "" {
+		// Any file may be read.
+		return osFS{}, abs, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.opened[root]
+	if !ok {
+		if r, err = os.OpenRoot(root); err != nil {
+			return nil, "", err
+		}
+		if c.opened == nil {
+			c.opened = make(map[string]*os.Root)
+		}
+		c.opened[root] = r
+	}
+	rel, _ := filepath.Rel(root, abs)
+	return rootFS{r}, rel, nil
+}
+
+// ErrNoCapability is the error of the file operations not granted by the capabilities, it's an
+// fs.ErrPermission.
+var ErrNoCapability = fmt.Errorf("%w: no capability", fs.ErrPermission)
+
+// allows returns an *fs.PathError unless the file at the clean absolute path abs may be accessed,
+// path is the one reported.
+func (c *Capabilities) allows(abs, path string, write bool) error {
+	if !write && c.readAll {
+		return nil
+	}
+	for _, root := range c.roots {
+		if within(root, abs) {
+			return nil
+		}
+	}
+	op := "read"
+	if write {
+		op = "write"
+	}
+	return &fs.PathError{Op: op, Path: path, Err: ErrNoCapability}
+}
+
+// within reports whether the clean absolute path abs is under the directory root.
+func within(root, abs string) bool {
+	rel, err := filepath.Rel(root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readsFiles and writesFiles report whether some files may be read or written.
+func (c *Capabilities) readsFiles() bool {
+	return c.readAll || c.writesFiles()
+}
+
+func (c *Capabilities) writesFiles() bool {
+	return len(c.roots) > 0
+}
+
+func (c *Capabilities) String() string {
+	return strings.Join(c.names, ",")
+}
+
+// resolvePath returns the clean absolute path without symbolic links of a path which may not
+// exist yet, the links are resolved in its longest existing parent.
+func resolvePath(abs string) string {
+	abs = filepath.Clean(abs)
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	dir := filepath.Dir(abs)
+	if dir == abs {
+		return abs
+	}
+	return filepath.Join(resolvePath(dir), filepath.Base(abs))
+}
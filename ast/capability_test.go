@@ -0,0 +1,124 @@
+package ast_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestCapabilities(t *testing.T) {
+	caps, err := ast.ParseCapabilities("core", "rand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps, Rand: rand.New(rand.NewSource(1))})
+	for _, name := range []string{"+", "map", "rand-int"} {
+		if sc.Lookup(name) == nil {
+			t.Errorf("expect %s to be defined", name)
+		}
+	}
+	for _, name := range []string{"println", "getenv", "current-time-millis"} {
+		if sc.Lookup(name) != nil {
+			t.Errorf("expect %s not to be defined", name)
+		}
+	}
+	if obj := evalString(t, sc, "(rand-int 3)"); obj.Kind != ast.Int || obj.Value.(int64) < 0 || obj.Value.(int64) >= 3 {
+		t.Errorf("expect (rand-int 3) in [0, 3), got %s", obj)
+	}
+
+	// The operators parsed apart from calls are builtins of core too.
+	caps, err = ast.ParseCapabilities("io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc = ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps})
+	for _, src := range []string{"(+ 1 2)", "(< 1 2)", "(= 1 1)"} {
+		expr, err := parser.ParseExpr([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := expr.Eval(sc); err == nil {
+			t.Errorf("%s: expect an error without the core capability", src)
+		}
+	}
+
+	for _, name := range []string{"net", "fs:tmp", ""} {
+		if _, err := ast.ParseCapabilities(name); err == nil {
+			t.Errorf("expect capability %q to be rejected", name)
+		}
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gofp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	granted := filepath.Join(dir, "granted")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{granted, other} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link in the granted directory must not give access to the other one.
+	if err := os.Symlink(other, filepath.Join(granted, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		caps  []string
+		path  string
+		write bool
+		ok    bool
+	}{
+		{[]string{"fs:" + granted}, filepath.Join(granted, "a.txt"), true, true},
+		{[]string{"fs:" + granted}, filepath.Join(granted, "new", "b.txt"), true, true},
+		{[]string{"fs:" + granted}, granted, false, true},
+		{[]string{"fs:" + granted}, filepath.Join(other, "a.txt"), false, false},
+		{[]string{"fs:" + granted}, filepath.Join(granted, "..", "other", "a.txt"), false, false},
+		{[]string{"fs:" + granted}, filepath.Join(granted, "link", "a.txt"), true, false},
+		{[]string{"fs:" + granted}, granted + "2", false, false},
+		{[]string{"fs:readonly"}, filepath.Join(other, "a.txt"), false, true},
+		{[]string{"fs:readonly"}, filepath.Join(other, "a.txt"), true, false},
+		{[]string{"fs:readonly", "fs:" + granted}, filepath.Join(granted, "a.txt"), true, true},
+		{[]string{"fs"}, filepath.Join(other, "a.txt"), true, true},
+		{[]string{"core"}, filepath.Join(other, "a.txt"), false, false},
+	}
+	for _, test := range tests {
+		caps, err := ast.ParseCapabilities(test.caps...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := caps.CheckPath(test.path, test.write); (err == nil) != test.ok {
+			t.Errorf("%v: CheckPath(%s, %v) = %v", test.caps, test.path, test.write, err)
+		}
+	}
+	// The files of the granted directories are accessed through them.
+	caps, err := ast.ParseCapabilities("fs:" + granted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := caps.ReadFile(filepath.Join(granted, "link", "a.txt")); !errors.Is(err, ast.ErrNoCapability) {
+		t.Errorf("expect reading through the link to be denied, got %v", err)
+	}
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps})
+	file := filepath.Join(granted, "new", "b.txt")
+	src := fmt.Sprintf(`(do (mkdir %q) (spit %q "b") (slurp %q))`, filepath.Dir(file), file, file)
+	if res := evalString(t, sc, src); res.String() != `"b"` {
+		t.Errorf("%s: expect \"b\", got %s", src, res)
+	}
+	if data, err := caps.ReadFile(file); err != nil || string(data) != "b" {
+		t.Errorf("ReadFile(%s) = %q, %v", file, data, err)
+	}
+}
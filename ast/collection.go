@@ -0,0 +1,303 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MapValue is an immutable map preserving the insertion order of its keys.
+type MapValue struct {
+	keys  []*Object
+	vals  []*Object
+	index map[string]int
+}
+
+func newMapValue() *MapValue {
+	return &MapValue{index: make(map[string]int)}
+}
+
+// Get returns the value bound to key, or nil if the key is absent or can't be hashed, like an
+// infinite sequence.
+func (m *MapValue) Get(key *Object) *Object {
+	val, _ := m.lookup(key)
+	return val
+}
+
+// lookup returns the value bound to key, or nil if the key is absent.
+func (m *MapValue) lookup(key *Object) (*Object, error) {
+	h, err := hashKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if i, ok := m.index[h]; ok {
+		return m.vals[i], nil
+	}
+	return nil, nil
+}
+
+// Keys returns the keys of the map in insertion order.
+func (m *MapValue) Keys() []*Object {
+	return m.keys
+}
+
+// Len returns the number of entries in the map.
+func (m *MapValue) Len() int {
+	return len(m.keys)
+}
+
+// assoc returns a copy of the map with key bound to val.
+func (m *MapValue) assoc(key, val *Object) (*MapValue, error) {
+	res := &MapValue{
+		keys:  append([]*Object(nil), m.keys...),
+		vals:  append([]*Object(nil), m.vals...),
+		index: make(map[string]int, len(m.index)+1),
+	}
+	for k, i := range m.index {
+		res.index[k] = i
+	}
+	if err := res.put(key, val); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// put binds key to val in place, it must only be used while building a new map.
+func (m *MapValue) put(key, val *Object) error {
+	h, err := hashKey(key)
+	if err != nil {
+		return err
+	}
+	if i, ok := m.index[h]; ok {
+		m.vals[i] = val
+		return nil
+	}
+	m.index[h] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.vals = append(m.vals, val)
+	return nil
+}
+
+func createMap(m *MapValue) *Object {
+	return &Object{Kind: Map, Value: m}
+}
+
+// SetValue is an immutable set preserving the insertion order of its elements.
+type SetValue struct {
+	items []*Object
+	index map[string]bool
+}
+
+func newSetValue() *SetValue {
+	return &SetValue{index: make(map[string]bool)}
+}
+
+// Contains reports whether obj is an element of the set, false if it can't be hashed.
+func (s *SetValue) Contains(obj *Object) bool {
+	ok, _ := s.contains(obj)
+	return ok
+}
+
+func (s *SetValue) contains(obj *Object) (bool, error) {
+	h, err := hashKey(obj)
+	if err != nil {
+		return false, err
+	}
+	return s.index[h], nil
+}
+
+// Items returns the elements of the set in insertion order.
+func (s *SetValue) Items() []*Object {
+	return s.items
+}
+
+// add inserts obj in place, it must only be used while building a new set.
+func (s *SetValue) add(obj *Object) error {
+	h, err := hashKey(obj)
+	if err != nil || s.index[h] {
+		return err
+	}
+	s.index[h] = true
+	s.items = append(s.items, obj)
+	return nil
+}
+
+func createSet(s *SetValue) *Object {
+	return &Object{Kind: Set, Value: s}
+}
+
+// hashKey returns a string identifying obj for use as a map key or set element. Objects which are
+// equal have the same key. It fails if a sequence in obj fails to be walked, e.g. an infinite one
+// exceeding the limits of the evaluation.
+func hashKey(obj *Object) (string, error) {
+	var b strings.Builder
+	if err := writeHashKey(&b, obj); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writeHashKey(b *strings.Builder, obj *Object) error {
+	switch obj.Kind {
+	case Int, BigInt, Ratio, Double:
+		b.WriteString(numKey(obj))
+	case String:
+		fmt.Fprintf(b, "s%q", obj.Value)
+	case Boolean:
+		fmt.Fprintf(b, "b%t", obj.Value)
+	case Nil:
+		b.WriteString("nil")
+	case List, Vector, Sequence, LazySeq:
+		b.WriteString("(")
+		seq, err := SeqOf(obj)
+		for err == nil && seq != nil {
+			if err = writeHashKey(b, seq.First()); err == nil {
+				b.WriteString(" ")
+				seq, err = seq.Next()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		b.WriteString(")")
+	case Map:
+		m := obj.Value.(*MapValue)
+		keys := make([]string, 0, len(m.index))
+		for k := range m.index {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("{")
+		for _, k := range keys {
+			fmt.Fprintf(b, "%s:", k)
+			if err := writeHashKey(b, m.vals[m.index[k]]); err != nil {
+				return err
+			}
+			b.WriteString(" ")
+		}
+		b.WriteString("}")
+	case Set:
+		keys := make([]string, 0, len(obj.Value.(*SetValue).index))
+		for k := range obj.Value.(*SetValue).index {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("#{")
+		for _, k := range keys {
+			b.WriteString(k)
+			b.WriteString(" ")
+		}
+		b.WriteString("}")
+	case Func, Builtin:
+		fmt.Fprintf(b, "%s@%p", obj.Kind, obj.Value)
+	default:
+		fmt.Fprintf(b, "%s@%p", obj.Kind, obj)
+	}
+	return nil
+}
+
+// numKey is the hash key of a number, its exact value so that the numbers which are equal have
+// the same key whatever their kinds, e.g. 3/4 and 0.75.
+func numKey(obj *Object) string {
+	if r, ok := exactRat(obj); ok {
+		return "n" + r.RatString()
+	}
+	return fmt.Sprintf("d%v", obj.Value)
+}
+
+// equal reports whether two objects are equal. Numbers are compared by value, sequential
+// collections element-wise, maps and sets by their entries and everything else by identity. It
+// fails if a sequence fails to be walked, e.g. an infinite one exceeding the limits of the
+// evaluation.
+func equal(x, y *Object) (bool, error) {
+	if isNumber(x) && isNumber(y) {
+		return numEqual(x, y), nil
+	}
+	if isSequential(x) && isSequential(y) {
+		xs, err := SeqOf(x)
+		if err != nil {
+			return false, err
+		}
+		ys, err := SeqOf(y)
+		if err != nil {
+			return false, err
+		}
+		for xs != nil && ys != nil {
+			if eq, err := equal(xs.First(), ys.First()); err != nil || !eq {
+				return false, err
+			}
+			if xs, err = xs.Next(); err != nil {
+				return false, err
+			}
+			if ys, err = ys.Next(); err != nil {
+				return false, err
+			}
+		}
+		return xs == nil && ys == nil, nil
+	}
+	if x.Kind != y.Kind {
+		return false, nil
+	}
+	switch x.Kind {
+	case Nil:
+		return true, nil
+	case Boolean:
+		return x.Value.(bool) == y.Value.(bool), nil
+	case String:
+		return x.Value.(string) == y.Value.(string), nil
+	case Map:
+		xm, ym := x.Value.(*MapValue), y.Value.(*MapValue)
+		if xm.Len() != ym.Len() {
+			return false, nil
+		}
+		for i, key := range xm.keys {
+			v, err := ym.lookup(key)
+			if err != nil || v == nil {
+				return false, err
+			}
+			if eq, err := equal(xm.vals[i], v); err != nil || !eq {
+				return false, err
+			}
+		}
+		return true, nil
+	case Set:
+		xs, ys := x.Value.(*SetValue), y.Value.(*SetValue)
+		if len(xs.items) != len(ys.items) {
+			return false, nil
+		}
+		for _, item := range xs.items {
+			if ok, err := ys.contains(item); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case Func, Builtin:
+		// def binds a copy of the object carrying the metadata, the function is the same.
+		return x.Value == y.Value, nil
+	}
+	return x == y, nil
+}
+
+// numEqual reports whether two numbers are equal. Doubles are compared with the other kinds of
+// numbers by their exact value, like numKey does, and not rounding the other number to a double.
+func numEqual(x, y *Object) bool {
+	if x.Kind != y.Kind {
+		// The infinities and NaN are equal to no number of another kind.
+		if _, ok := exactRat(x); !ok {
+			return false
+		}
+		if _, ok := exactRat(y); !ok {
+			return false
+		}
+	}
+	return compareNums(x, y) == 0
+}
+
+// isSequential reports whether obj is a list, vector or sequence.
+func isSequential(obj *Object) bool {
+	switch obj.Kind {
+	case List, Vector, Sequence, LazySeq:
+		return true
+	}
+	return false
+}
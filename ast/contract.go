@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// CheckContracts turns the checking of pre-conditions, post-conditions and assertions on or off.
+// Programs run in production may turn it off to save the cost of evaluating the conditions.
+var CheckContracts = true
+
+// ContractError is the error of a pre-condition, post-condition or assertion which doesn't hold.
+type ContractError struct {
+	Kind string // "pre-condition", "post-condition" or "assertion".
+	Func string // Name of the function of a condition, empty for assertions.
+	// Expr is the source text of the condition and Pos its position.
+	Expr string
+	Pos  token.Position
+	// Msg is the message of an assertion, empty if it has none.
+	Msg string
+}
+
+func (e *ContractError) Error() string {
+	what := e.Kind
+	if e.Func != "" {
+		what += " of " + e.Func
+	}
+	s := fmt.Sprintf("%s: %s failed: %s", e.Pos, what, e.Expr)
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	return s
+}
+
+// checkConditions evaluates the conditions of fn in sc and returns a ContractError for the first
+// one which doesn't hold. sources are the texts of the conditions, they are rendered from the
+// conditions if there are none.
+func checkConditions(kind string, fn *FuncValue, conds *ExprList, sources []string, sc *Scope) error {
+	if conds == nil || !CheckContracts {
+		return nil
+	}
+	for i, cond := range conds.Exprs {
+		obj, err := cond.Eval(sc)
+		if err != nil {
+			return err
+		}
+		if !truthy(obj) {
+			text := SourceText(cond)
+			if i < len(sources) {
+				text = sources[i]
+			}
+			return &ContractError{Kind: kind, Func: fn.displayName(), Expr: text, Pos: cond.Pos()}
+		}
+	}
+	return nil
+}
+
+// SourceText returns the text of expr in canonical layout on a single line, as reported by
+// contract errors.
+func SourceText(expr Expr) string {
+	return toSExpr(expr, 1, 0).flat()
+}
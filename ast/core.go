@@ -0,0 +1,681 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// coreBuiltins returns the sequence and collection functions of the core library, the ones walking
+// sequences check the limits of st as they go.
+func coreBuiltins(st *evalState) map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		"list":        builtinList,
+		"vector":      builtinVector,
+		"hash-map":    builtinHashMap,
+		"hash-set":    builtinHashSet,
+		"count":       withState(st, builtinCount),
+		"first":       builtinFirst,
+		"rest":        builtinRest,
+		"next":        builtinNext,
+		"cons":        builtinCons,
+		"seq":         builtinSeq,
+		"map":         withState(st, builtinMap),
+		"filter":      withState(st, builtinFilter),
+		"remove":      withState(st, builtinRemove),
+		"reduce":      withState(st, builtinReduce),
+		"take":        withState(st, builtinTake),
+		"drop":        withState(st, builtinDrop),
+		"concat":      withState(st, builtinConcat),
+		"range":       withState(st, builtinRange),
+		"sort":        withState(st, builtinSort),
+		"sort-by":     withState(st, builtinSortBy),
+		"group-by":    withState(st, builtinGroupBy),
+		"frequencies": withState(st, builtinFrequencies),
+		"partition":   withState(st, builtinPartition),
+		"interleave":  withState(st, builtinInterleave),
+		"apply":       withState(st, builtinApply),
+		"iterate":     withState(st, builtinIterate),
+		"repeat":      withState(st, builtinRepeat),
+		"cycle":       withState(st, builtinCycle),
+		"doall":       withState(st, builtinDoall),
+		"dorun":       withState(st, builtinDorun),
+		"meta":        builtinMeta,
+		"arglists":    builtinArglists,
+	}
+}
+
+// withState binds the evaluation state to a builtin which needs it.
+func withState(st *evalState, fn func(st *evalState, args []*Object) (*Object, error)) func(args []*Object) (*Object, error) {
+	return func(args []*Object) (*Object, error) {
+		return fn(st, args)
+	}
+}
+
+// checkArity returns an error unless the number of arguments is between min and max, a negative
+// max means there is no upper limit.
+func checkArity(name string, args []*Object, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("Wrong number of arguments(%d) passed to %s", len(args), name)
+	}
+	return nil
+}
+
+func intArg(name string, obj *Object) (int, error) {
+	if obj.Kind != Int {
+		return 0, fmt.Errorf("%s expects an integer, got %s", name, obj.Kind)
+	}
+	return int(obj.Value.(int64)), nil
+}
+
+func stringArg(name string, obj *Object) (string, error) {
+	if obj.Kind != String {
+		return "", fmt.Errorf("%s expects a string, got %s", name, obj.Kind)
+	}
+	return obj.Value.(string), nil
+}
+
+func fnArg(name string, obj *Object) (*Object, error) {
+	if obj.Kind != Func && obj.Kind != Builtin {
+		return nil, fmt.Errorf("%s expects a function, got %s", name, obj.Kind)
+	}
+	return obj, nil
+}
+
+func sliceArg(st *evalState, obj *Object) ([]*Object, error) {
+	seq, err := SeqOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	return seqToSlice(st, seq)
+}
+
+func builtinList(args []*Object) (*Object, error) {
+	return createList(args), nil
+}
+
+func builtinVector(args []*Object) (*Object, error) {
+	return createVector(args), nil
+}
+
+func builtinHashMap(args []*Object) (*Object, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("hash-map expects an even number of arguments")
+	}
+	m := newMapValue()
+	for i := 0; i < len(args); i += 2 {
+		if err := m.put(args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return createMap(m), nil
+}
+
+func builtinHashSet(args []*Object) (*Object, error) {
+	s := newSetValue()
+	for _, arg := range args {
+		if err := s.add(arg); err != nil {
+			return nil, err
+		}
+	}
+	return createSet(s), nil
+}
+
+func builtinCount(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("count", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch coll := args[0]; coll.Kind {
+	case List, Vector:
+		return createInt(int64(len(coll.Value.([]*Object)))), nil
+	case Map:
+		return createInt(int64(coll.Value.(*MapValue).Len())), nil
+	case Set:
+		return createInt(int64(len(coll.Value.(*SetValue).items))), nil
+	case String:
+		return createInt(int64(utf8.RuneCountInString(coll.Value.(string)))), nil
+	}
+	// Other sequences are walked without holding their elements.
+	seq, err := SeqOf(args[0])
+	var n int64
+	for ; err == nil && seq != nil; n++ {
+		if err = st.step(); err == nil {
+			seq, err = seq.Next()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return createInt(n), nil
+}
+
+func builtinFirst(args []*Object) (*Object, error) {
+	if err := checkArity("first", args, 1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[0])
+	if err != nil || seq == nil {
+		return NilObj, err
+	}
+	return seq.First(), nil
+}
+
+func builtinRest(args []*Object) (*Object, error) {
+	if err := checkArity("rest", args, 1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[0])
+	if err != nil || seq == nil {
+		return createList(nil), err
+	}
+	return seqRest(seq)
+}
+
+func builtinNext(args []*Object) (*Object, error) {
+	if err := checkArity("next", args, 1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[0])
+	if err != nil || seq == nil {
+		return NilObj, err
+	}
+	if seq, err = seq.Next(); err != nil || seq == nil {
+		return NilObj, err
+	}
+	return createSeq(seq), nil
+}
+
+func builtinCons(args []*Object) (*Object, error) {
+	if err := checkArity("cons", args, 2, 2); err != nil {
+		return nil, err
+	}
+	if !seqable(args[1]) {
+		return nil, fmt.Errorf("Don't know how to create sequence from %s", args[1].Kind)
+	}
+	return createSeq(&consSeq{first: args[0], rest: args[1]}), nil
+}
+
+func builtinSeq(args []*Object) (*Object, error) {
+	if err := checkArity("seq", args, 1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[0])
+	if err != nil || seq == nil {
+		return NilObj, err
+	}
+	return createSeq(seq), nil
+}
+
+func builtinMap(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("map", args, 2, -1); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("map", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return lazyMap(st, fn, args[1:]), nil
+}
+
+func builtinFilter(st *evalState, args []*Object) (*Object, error) {
+	return filterBy(st, "filter", args, true)
+}
+
+func builtinRemove(st *evalState, args []*Object) (*Object, error) {
+	return filterBy(st, "remove", args, false)
+}
+
+// filterBy keeps the elements for which the predicate's truthiness equals keep.
+func filterBy(st *evalState, name string, args []*Object, keep bool) (*Object, error) {
+	if err := checkArity(name, args, 2, 2); err != nil {
+		return nil, err
+	}
+	pred, err := fnArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return lazyFilter(st, pred, args[1], keep), nil
+}
+
+func builtinReduce(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("reduce", args, 2, 3); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("reduce", args[0])
+	if err != nil {
+		return nil, err
+	}
+	items, err := sliceArg(st, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	var acc *Object
+	if len(args) == 3 {
+		acc = args[1]
+	} else if len(items) == 0 {
+		return Apply(fn, nil)
+	} else {
+		acc, items = items[0], items[1:]
+	}
+	for _, item := range items {
+		if acc, err = Apply(fn, []*Object{acc, item}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func builtinTake(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("take", args, 2, 2); err != nil {
+		return nil, err
+	}
+	n, err := intArg("take", args[0])
+	if err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[1])
+	if err != nil {
+		return nil, err
+	}
+	var res []*Object
+	for ; n > 0 && seq != nil; n-- {
+		if res, err = st.appendHeld(res, seq.First()); err != nil {
+			return nil, err
+		}
+		if n > 1 {
+			if seq, err = seq.Next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return createList(res), nil
+}
+
+func builtinDrop(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("drop", args, 2, 2); err != nil {
+		return nil, err
+	}
+	n, err := intArg("drop", args[0])
+	if err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[1])
+	if err != nil {
+		return nil, err
+	}
+	for ; n > 0 && seq != nil; n-- {
+		if seq, err = seq.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return createSeq(seq), nil
+}
+
+func builtinConcat(st *evalState, args []*Object) (*Object, error) {
+	for _, coll := range args {
+		if !seqable(coll) {
+			return nil, fmt.Errorf("Don't know how to create sequence from %s", coll.Kind)
+		}
+	}
+	return lazyConcat(st, args), nil
+}
+
+func builtinRange(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("range", args, 0, 3); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return createSeq(rangeSeqOf(st, createInt(0), nil, createInt(1))), nil
+	}
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return nil, fmt.Errorf("range expects numbers, got %s", arg.Kind)
+		}
+	}
+	start, end, step := createInt(0), args[0], createInt(1)
+	if len(args) > 1 {
+		start, end = args[0], args[1]
+	}
+	if len(args) > 2 {
+		step = args[2]
+	}
+	return createSeq(rangeSeqOf(st, start, end, step)), nil
+}
+
+func builtinSort(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("sort", args, 1, 2); err != nil {
+		return nil, err
+	}
+	var comp *Object
+	if len(args) == 2 {
+		var err error
+		if comp, err = fnArg("sort", args[0]); err != nil {
+			return nil, err
+		}
+	}
+	items, err := sliceArg(st, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	return sortObjects(st, items, items, comp)
+}
+
+func builtinSortBy(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("sort-by", args, 2, 3); err != nil {
+		return nil, err
+	}
+	keyFn, err := fnArg("sort-by", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var comp *Object
+	if len(args) == 3 {
+		if comp, err = fnArg("sort-by", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	items, err := sliceArg(st, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Object, len(items))
+	for i, item := range items {
+		if keys[i], err = Apply(keyFn, []*Object{item}); err != nil {
+			return nil, err
+		}
+	}
+	return sortObjects(st, items, keys, comp)
+}
+
+// sortObjects stably sorts items by their corresponding keys, using comp as comparator if given or
+// the natural order otherwise. The comparator may either return a boolean "less than" result or a
+// number which is negative, zero or positive.
+func sortObjects(st *evalState, items, keys []*Object, comp *Object) (*Object, error) {
+	indices := make([]int, len(items))
+	for i := range indices {
+		indices[i] = i
+	}
+	var err error
+	less := func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		x, y := keys[indices[i]], keys[indices[j]]
+		if comp == nil {
+			var cmp int
+			cmp, err = compare(st, x, y)
+			return cmp < 0
+		}
+		var res *Object
+		if res, err = Apply(comp, []*Object{x, y}); err != nil {
+			return false
+		}
+		if isNumber(res) {
+			return compareNums(res, createInt(0)) < 0
+		}
+		return truthy(res)
+	}
+	sort.SliceStable(indices, less)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Object, len(items))
+	for i, idx := range indices {
+		res[i] = items[idx]
+	}
+	return createList(res), nil
+}
+
+// compare orders numbers, strings, booleans and sequential collections of them.
+func compare(st *evalState, x, y *Object) (int, error) {
+	switch {
+	case isNumber(x) && isNumber(y):
+		return compareNums(x, y), nil
+	case x.Kind == String && y.Kind == String:
+		a, b := x.Value.(string), y.Value.(string)
+		switch {
+		case a < b:
+			return -1, nil
+		case a > b:
+			return 1, nil
+		}
+		return 0, nil
+	case x.Kind == Boolean && y.Kind == Boolean:
+		a, b := x.Value.(bool), y.Value.(bool)
+		switch {
+		case a == b:
+			return 0, nil
+		case b:
+			return -1, nil
+		}
+		return 1, nil
+	case isSequential(x) && isSequential(y):
+		xs, err := sliceArg(st, x)
+		if err != nil {
+			return 0, err
+		}
+		ys, err := sliceArg(st, y)
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < len(xs) && i < len(ys); i++ {
+			if cmp, err := compare(st, xs[i], ys[i]); err != nil || cmp != 0 {
+				return cmp, err
+			}
+		}
+		return len(xs) - len(ys), nil
+	}
+	return 0, fmt.Errorf("Can't compare %s with %s", x.Kind, y.Kind)
+}
+
+func builtinGroupBy(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("group-by", args, 2, 2); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("group-by", args[0])
+	if err != nil {
+		return nil, err
+	}
+	items, err := sliceArg(st, args[1])
+	if err != nil {
+		return nil, err
+	}
+	groups := newMapValue()
+	for _, item := range items {
+		key, err := Apply(fn, []*Object{item})
+		if err != nil {
+			return nil, err
+		}
+		obj, err := groups.lookup(key)
+		if err != nil {
+			return nil, err
+		}
+		var group []*Object
+		if obj != nil {
+			group = obj.Value.([]*Object)
+		}
+		vec := createVector(append(group, item))
+		if err := st.alloc(sizeOf(vec)); err != nil {
+			return nil, err
+		}
+		if err := groups.put(key, vec); err != nil {
+			return nil, err
+		}
+	}
+	return createMap(groups), nil
+}
+
+func builtinFrequencies(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("frequencies", args, 1, 1); err != nil {
+		return nil, err
+	}
+	items, err := sliceArg(st, args[0])
+	if err != nil {
+		return nil, err
+	}
+	freqs := newMapValue()
+	for _, item := range items {
+		obj, err := freqs.lookup(item)
+		if err != nil {
+			return nil, err
+		}
+		var n int64
+		if obj != nil {
+			n = obj.Value.(int64)
+		}
+		if err := freqs.put(item, createInt(n+1)); err != nil {
+			return nil, err
+		}
+	}
+	return createMap(freqs), nil
+}
+
+func builtinPartition(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("partition", args, 2, 3); err != nil {
+		return nil, err
+	}
+	n, err := intArg("partition", args[0])
+	if err != nil {
+		return nil, err
+	}
+	step := n
+	if len(args) == 3 {
+		if step, err = intArg("partition", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if n <= 0 || step <= 0 {
+		return nil, fmt.Errorf("partition expects positive sizes")
+	}
+	items, err := sliceArg(st, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	// Incomplete partitions at the end are dropped.
+	var res []*Object
+	for i := 0; i+n <= len(items); i += step {
+		list := createList(items[i : i+n])
+		if err := st.alloc(sizeOf(list)); err != nil {
+			return nil, err
+		}
+		if res, err = st.appendHeld(res, list); err != nil {
+			return nil, err
+		}
+	}
+	return createList(res), nil
+}
+
+func builtinInterleave(st *evalState, args []*Object) (*Object, error) {
+	seqs := make([]Seq, len(args))
+	for i, coll := range args {
+		var err error
+		if seqs[i], err = SeqOf(coll); err != nil {
+			return nil, err
+		}
+	}
+	var res []*Object
+	for len(seqs) > 0 {
+		for _, seq := range seqs {
+			if seq == nil {
+				return createList(res), nil
+			}
+		}
+		for i, seq := range seqs {
+			var err error
+			if res, err = st.appendHeld(res, seq.First()); err != nil {
+				return nil, err
+			}
+			if seqs[i], err = seq.Next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return createList(res), nil
+}
+
+func builtinApply(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("apply", args, 2, -1); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("apply", args[0])
+	if err != nil {
+		return nil, err
+	}
+	// The last argument is a collection spliced after the others.
+	spread, err := sliceArg(st, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	fnArgs := append(append([]*Object(nil), args[1:len(args)-1]...), spread...)
+	return Apply(fn, fnArgs)
+}
+
+func builtinIterate(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("iterate", args, 2, 2); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("iterate", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return lazyIterate(st, fn, args[1]), nil
+}
+
+func builtinRepeat(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("repeat", args, 1, 2); err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return createSeq(&repeatSeq{obj: args[0], state: st}), nil
+	}
+	n, err := intArg("repeat", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var res []*Object
+	for i := 0; i < n; i++ {
+		if res, err = st.appendHeld(res, args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return createList(res), nil
+}
+
+func builtinCycle(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("cycle", args, 1, 1); err != nil {
+		return nil, err
+	}
+	items, err := sliceArg(st, args[0])
+	if err != nil || len(items) == 0 {
+		return createList(nil), err
+	}
+	return createSeq(&cycleSeq{items: items, state: st}), nil
+}
+
+// builtinDoall realizes a whole lazy sequence and returns it.
+func builtinDoall(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("doall", args, 1, 1); err != nil {
+		return nil, err
+	}
+	if _, err := sliceArg(st, args[0]); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}
+
+// builtinDorun realizes a whole lazy sequence for its side effects and returns nil.
+func builtinDorun(st *evalState, args []*Object) (*Object, error) {
+	if err := checkArity("dorun", args, 1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := SeqOf(args[0])
+	for err == nil && seq != nil {
+		if err = st.step(); err == nil {
+			seq, err = seq.Next()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NilObj, nil
+}
@@ -0,0 +1,180 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func evalString(t *testing.T, sc *ast.Scope, src string) *ast.Object {
+	expr, err := parser.ParseExpr([]byte(src))
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	obj, err := expr.Eval(sc)
+	if err != nil {
+		t.Fatalf("eval %q: %v", src, err)
+	}
+	return obj
+}
+
+func TestCoreLibrary(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn inc [n] (+ n 1))")
+	evalString(t, sc, "(defn big? [n] (> n 2))")
+	evalString(t, sc, "(def plus +)")
+	evalString(t, sc, "(def bigger? big?)")
+	tests := []string{
+		"(= (first [1 2 3]) 1)",
+		"(= (rest [1 2 3]) [2 3])",
+		"(= (rest []) [])",
+		"(= (next [1]) (seq []))",
+		"(= (cons 0 [1 2]) [0 1 2])",
+		"(= (first \"abc\") \"a\")",
+		"(= (map inc [1 2 3]) [2 3 4])",
+		"(= (map + [1 2 3] [10 20]) [11 22])",
+		"(= (filter big? (range 6)) [3 4 5])",
+		"(= (remove big? (range 6)) [0 1 2])",
+		"(= (reduce + (range 101)) 5050)",
+		"(= (reduce + 10 [1 2]) 13)",
+		"(= (reduce + []) 0)",
+		"(= (take 2 (range 10)) [0 1])",
+		"(= (drop 8 (range 10)) [8 9])",
+		"(= (concat [1] (list 2 3) []) [1 2 3])",
+		"(= (range 1 10 3) [1 4 7])",
+		"(= (range 3 0 -1) [3 2 1])",
+		"(= (sort [3 1 2]) [1 2 3])",
+		"(= (sort > [3 1 2]) [3 2 1])",
+		"(= (sort-by - [3 1 2]) [3 2 1])",
+		"(= (group-by big? [1 3 2 4]) (hash-map false [1 2] true [3 4]))",
+		"(= (frequencies \"abca\") (hash-map \"a\" 2 \"b\" 1 \"c\" 1))",
+		"(= (partition 2 (range 5)) [[0 1] [2 3]])",
+		"(= (partition 2 1 [1 2 3]) [[1 2] [2 3]])",
+		"(= (interleave [1 2 3] \"ab\") [1 \"a\" 2 \"b\"])",
+		"(= (apply + 1 2 [3 4]) 10)",
+		"(= (count (hash-set 1 2 1)) 2)",
+		// Numbers which are equal are the same key.
+		"(= (count (hash-set 3/4 0.75 1 1.0 100000000000000000000N 1e20)) 3)",
+		"(= (hash-map 0.75 1 1e20 2) (hash-map 3/4 1 100000000000000000000N 2))",
+		"(= (frequencies [1 1.0 2N]) (hash-map 1 2 2 1))",
+		// The comparisons agree with =, a double is compared by its exact value.
+		"(= (= 1/10 0.1) false)",
+		"(< 1/10 0.1)",
+		"(= (>= 1/10 0.1) false)",
+		"(> 1/3 0.3333333333333333)",
+		"(= (<= 0.1 1/10) false)",
+		"(< 1.5 2N)",
+		// The functions bound again by def are the same.
+		"(= plus +)",
+		"(= bigger? big?)",
+		"(= (count (hash-set plus + bigger? big?)) 2)",
+	}
+	for _, src := range tests {
+		if obj := evalString(t, sc, src); obj.Kind != ast.Boolean || !obj.Value.(bool) {
+			t.Errorf("%s: got false", src)
+		}
+	}
+}
+
+func TestRecursiveCallArguments(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn fib [n] (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2)))))")
+	if obj := evalString(t, sc, "(fib 10)"); obj.Kind != ast.Int || obj.Value.(int64) != 55 {
+		t.Errorf("(fib 10): got %v", obj.Value)
+	}
+}
+
+func TestLazySeq(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn big? [n] (> n 2))")
+	evalString(t, sc, "(defn inc [n] (+ n 1))")
+	evalString(t, sc, "(defn nums [n] (lazy-seq (cons n (nums (+ n 1)))))")
+	evalString(t, sc, "(defn skip [n] (lazy-seq (if (= n 0) [1] (skip (- n 1)))))")
+	tests := []string{
+		"(= (take 3 (filter big? (range))) [3 4 5])",
+		"(= (take 3 (map inc (range))) [1 2 3])",
+		"(= (take 3 (nums 5)) [5 6 7])",
+		"(= (first (drop 100000 (nums 0))) 100000)",
+		"(= (first (filter (fn [x] (> x 100000)) (range))) 100001)",
+		"(= (skip 100000) [1])",
+		"(= (take 4 (iterate inc 0)) [0 1 2 3])",
+		"(= (take 2 (repeat 7)) [7 7])",
+		"(= (repeat 2 7) [7 7])",
+		"(= (take 5 (cycle [1 2])) [1 2 1 2 1])",
+		"(= (take 3 (concat [1] (range))) [1 0 1])",
+		"(= (doall (map inc [1 2])) [2 3])",
+		"(= (dorun (map inc [1 2])) (seq []))",
+		"(= (lazy-seq []) [])",
+	}
+	for _, src := range tests {
+		if obj := evalString(t, sc, src); obj.Kind != ast.Boolean || !obj.Value.(bool) {
+			t.Errorf("%s: got false", src)
+		}
+	}
+}
+
+func TestDefInFunction(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn f [x] (do (def y (* x 2)) (defn g [n] (if (= n 0) y (g (- n 1)))) (g 3)))")
+	if res := evalString(t, sc, "(f 4)"); res.String() != "8" {
+		t.Errorf("expect 8, got %s", res)
+	}
+	if sc.Lookup("y") != nil {
+		t.Error("def in a function shouldn't bind a global name")
+	}
+}
+
+func TestTypeHints(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn area [^Double w ^Double h] ^Double (* w h))")
+	evalString(t, sc, "(defn half [^Number x] ^Int (/ x 2))")
+	if res := evalString(t, sc, "(area 1.5 2.0)"); res.String() != "3.0" {
+		t.Errorf("expect 3.0, got %s", res)
+	}
+	tests := []struct {
+		src, expect string
+	}{
+		{"(area 1.5 2)", "argument h of area must be Double, got Int"},
+		{`((fn [^String s] s) 1)`, "argument s of fn must be String, got Int"},
+		{"(half 3)", "result of half must be Int, got Ratio"},
+	}
+	for _, test := range tests {
+		expr, err := parser.ParseExpr([]byte(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := expr.Eval(sc); err == nil || err.Error() != test.expect {
+			t.Errorf("%s: expect error %q, got %v", test.src, test.expect, err)
+		}
+	}
+}
+
+func TestContracts(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn sqrt [x] {:pre [(>= x 0)] :post [(>= % 0) (< (- x (* % %)) 0.01)]} (if (< x 2) x 1.5))")
+	evalString(t, sc, "(sqrt 1)")
+	tests := []struct {
+		src, expect string
+	}{
+		{"(sqrt -1)", "1:23: pre-condition of sqrt failed: (>= x 0)"},
+		{"(sqrt 3)", "1:49: post-condition of sqrt failed: (< (- x (* % %)) 0.01)"},
+		{"(assert (= 1 2))", "1:1: assertion failed: (= 1 2)"},
+		{`(assert false "never")`, "1:1: assertion failed: false: never"},
+	}
+	for _, test := range tests {
+		expr, err := parser.ParseExpr([]byte(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = expr.Eval(sc)
+		if _, ok := err.(*ast.ContractError); !ok || err.Error() != test.expect {
+			t.Errorf("%s: expect contract error %q, got %v", test.src, test.expect, err)
+		}
+	}
+	ast.CheckContracts = false
+	defer func() { ast.CheckContracts = true }()
+	if res := evalString(t, sc, "(do (assert false) (sqrt -1))"); res.String() != "-1" {
+		t.Errorf("expect -1 with contracts off, got %s", res)
+	}
+}
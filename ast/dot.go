@@ -0,0 +1,213 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// FprintDot writes the trees of nodes to w as a Graphviz DOT graph. Expression lists are not
+// shown as nodes of their own, their elements are linked to the node holding the list.
+func FprintDot(w io.Writer, nodes ...Expr) error {
+	var b bytes.Buffer
+	b.WriteString("digraph ast {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	id := 0
+	var add func(node Expr) int
+	add = func(node Expr) int {
+		id++
+		n := id
+		fmt.Fprintf(&b, "\tn%d [label=%s];\n", n, strconv.Quote(dotLabel(node)))
+		for _, child := range dotChildren(node) {
+			c := add(child.node)
+			fmt.Fprintf(&b, "\tn%d -> n%d [label=%s];\n", n, c, strconv.Quote(child.name))
+		}
+		return n
+	}
+	for _, node := range nodes {
+		add(node)
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// dotLabel returns the label of a node: its type and the value of a leaf.
+func dotLabel(node Expr) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return "nil"
+	}
+	kind := reflect.TypeOf(node).Elem().Name()
+	switch n := node.(type) {
+	case *IdentExpr:
+		return kind + "\n" + n.Name
+	case *NumExpr:
+		return kind + "\n" + (&Object{Kind: n.Kind, Value: n.Value}).String()
+	case *BooleanExpr:
+		return kind + "\n" + strconv.FormatBool(n.Bool)
+	case *StringExpr:
+		return kind + "\n" + strconv.Quote(n.Value)
+	case *BinaryOp:
+		return kind + "\n" + token.TokenName(n.Op)
+	case *MultiOp:
+		return kind + "\n" + token.TokenName(n.Op)
+	}
+	return kind
+}
+
+type dotChild struct {
+	name string
+	node Expr
+}
+
+// dotChildren returns the children of a node named after the fields holding them.
+func dotChildren(node Expr) []dotChild {
+	var children []dotChild
+	add := func(name string, node Expr) {
+		if node != nil && !reflect.ValueOf(node).IsNil() {
+			children = append(children, dotChild{name, node})
+		}
+	}
+	addList := func(name string, l *ExprList) {
+		if l == nil {
+			return
+		}
+		for i, expr := range l.Exprs {
+			add(fmt.Sprintf("%s[%d]", name, i), expr)
+		}
+	}
+	switch n := node.(type) {
+	case *VectorExpr:
+		addList("exprs", n.Exprs)
+	case *DefExpr:
+		add("ident", n.Ident)
+		for _, entry := range n.Meta {
+			add(entry.Key, entry.Value)
+		}
+		add("expr", n.Expr)
+	case *DefnExpr:
+		add("ident", n.Ident)
+		for _, entry := range n.Meta {
+			add(entry.Key, entry.Value)
+		}
+		add("expr", n.Expr)
+	case *FuncExpr:
+		for i, param := range n.Params {
+			add(fmt.Sprintf("params[%d]", i), param)
+		}
+		addList("pre", n.Pre)
+		addList("post", n.Post)
+		add("expr", n.Expr)
+	case *ExprList:
+		addList("exprs", n)
+	case *CallExpr:
+		add("fun", n.Fun)
+		addList("args", n.Args)
+	case *DoExpr:
+		addList("exprs", n.Exprs)
+	case *IfExpr:
+		add("cond", n.Cond)
+		add("then", n.Then)
+		add("else", n.Else)
+	case *BinaryOp:
+		add("left", n.Left)
+		add("right", n.Right)
+	case *MultiOp:
+		addList("exprs", n.Exprs)
+	case *BindExpr:
+		add("ident", n.Ident)
+		add("value", n.Value)
+	case *LetExpr:
+		for i, binding := range n.Bindings {
+			add(fmt.Sprintf("bindings[%d]", i), binding)
+		}
+		add("body", n.Body)
+	case *LazySeqExpr:
+		add("body", n.Body)
+	case *AssertExpr:
+		add("cond", n.Cond)
+		add("msg", n.Msg)
+	case *NsExpr:
+		add("name", n.Name)
+	case *RequireExpr:
+		for i, spec := range n.Specs {
+			add(fmt.Sprintf("specs[%d]", i), spec)
+		}
+	case *RequireSpec:
+		add("module", n.Module)
+		add("alias", n.Alias)
+		for i, ident := range n.Refer {
+			add(fmt.Sprintf("refer[%d]", i), ident)
+		}
+	}
+	return children
+}
+
+// CallGraph records which functions defined with defn call which.
+type CallGraph struct {
+	// Funcs are the names of the functions in the order they are defined.
+	Funcs []string
+	// Calls maps a function to the sorted names of the functions it calls.
+	Calls map[string][]string
+}
+
+// NewCallGraph builds the call graph of the functions defined with defn at the top level of
+// exprs. A function calls another one if the name of the other one is free in its body, as found
+// by closure capture, and is used in call position.
+func NewCallGraph(exprs []Expr) *CallGraph {
+	g := &CallGraph{Calls: make(map[string][]string)}
+	defined := make(map[string]bool)
+	var defns []*DefnExpr
+	for _, expr := range exprs {
+		if defn, ok := expr.(*DefnExpr); ok {
+			if !defined[defn.Ident.Name] {
+				g.Funcs = append(g.Funcs, defn.Ident.Name)
+			}
+			defined[defn.Ident.Name] = true
+			defns = append(defns, defn)
+		}
+	}
+	for _, defn := range defns {
+		free := FreeNames(defn.Expr)
+		called := make(map[string]bool)
+		for _, name := range g.Calls[defn.Ident.Name] {
+			called[name] = true
+		}
+		Inspect(defn.Expr, func(node Expr) bool {
+			if call, ok := node.(*CallExpr); ok {
+				if ident, ok := call.Fun.(*IdentExpr); ok && free[ident.Name] && defined[ident.Name] {
+					called[ident.Name] = true
+				}
+			}
+			return true
+		})
+		calls := make([]string, 0, len(called))
+		for name := range called {
+			calls = append(calls, name)
+		}
+		sort.Strings(calls)
+		g.Calls[defn.Ident.Name] = calls
+	}
+	return g
+}
+
+// FprintDot writes the call graph to w as a Graphviz DOT graph.
+func (g *CallGraph) FprintDot(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("digraph calls {\n\tnode [shape=ellipse, fontname=\"monospace\"];\n")
+	for _, name := range g.Funcs {
+		fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(name))
+	}
+	for _, name := range g.Funcs {
+		for _, callee := range g.Calls[name] {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", strconv.Quote(name), strconv.Quote(callee))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,59 @@
+package ast_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestCallGraph(t *testing.T) {
+	src := `(defn even? [n] (if (= n 0) true (odd? (- n 1))))
+(defn odd? [n] (if (= n 0) false (even? (- n 1))))
+(defn fact [n] (if (= n 0) 1 (* n (fact (- n 1)))))
+(defn apply-to [even? x] (even? x))
+(defn main [] (do (println (fact 5)) (map odd? [1 2])))`
+	exprs, err := parser.ParseExprs([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := ast.NewCallGraph(exprs)
+	expect := map[string][]string{
+		"even?":    {"odd?"},
+		"odd?":     {"even?"},
+		"fact":     {"fact"},
+		"apply-to": {}, // even? is a parameter here.
+		"main":     {"fact"},
+	}
+	if !reflect.DeepEqual(g.Calls, expect) {
+		t.Errorf("expect calls %v, got %v", expect, g.Calls)
+	}
+	var b bytes.Buffer
+	g.FprintDot(&b)
+	if !strings.Contains(b.String(), "\"even?\" -> \"odd?\";\n") {
+		t.Errorf("missing edge in\n%s", b.String())
+	}
+}
+
+func TestFprintDot(t *testing.T) {
+	expr, err := parser.ParseExpr([]byte(`(if (< x 1) "a" 2)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	ast.FprintDot(&b, expr)
+	for _, expect := range []string{
+		"n1 [label=\"IfExpr\"];",
+		"n2 [label=\"BinaryOp\\n<\"];",
+		"n1 -> n2 [label=\"cond\"];",
+		"n5 [label=\"StringExpr\\n\\\"a\\\"\"];",
+		"n1 -> n6 [label=\"else\"];",
+	} {
+		if !strings.Contains(b.String(), expect) {
+			t.Errorf("expect %s in\n%s", expect, b.String())
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package ast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"runtime"
+)
+
+// WritableFS is a file system whose files may be written by the file builtins, like spit. The
+// names of its files are those of an fs.FS.
+type WritableFS interface {
+	fs.FS
+	// WriteFile writes data to the named file, creating it if needed, and appends it to the
+	// content of the file if append is true.
+	WriteFile(name string, data []byte, append bool) error
+	// MkdirAll creates a directory along with the missing parents.
+	MkdirAll(name string) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+}
+
+// errReadOnly is the error of the writing builtins on a file system which isn't a WritableFS.
+var errReadOnly = fmt.Errorf("%w: read-only file system", fs.ErrPermission)
+
+// DirFS returns the file system of the files under dir. Its names can't refer to files out of
+// dir, even through symbolic links.
+func DirFS(dir string) (WritableFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &dirFS{root: root}, nil
+}
+
+type dirFS struct {
+	root *os.Root
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return d.root.Open(name)
+}
+
+func (d *dirFS) WriteFile(name string, data []byte, append bool) error {
+	f, err := d.root.OpenFile(name, writeFlags(append), 0666)
+	if err != nil {
+		return err
+	}
+	return writeAndClose(f, data)
+}
+
+func (d *dirFS) MkdirAll(name string) error {
+	return d.root.MkdirAll(name, 0777)
+}
+
+func (d *dirFS) Remove(name string) error {
+	return d.root.Remove(name)
+}
+
+// osFS is the file system of the host, its names are the paths of the operating system.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) WriteFile(name string, data []byte, append bool) error {
+	f, err := os.OpenFile(name, writeFlags(append), 0666)
+	if err != nil {
+		return err
+	}
+	return writeAndClose(f, data)
+}
+
+func (osFS) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0777)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// rootFS is the file system of the files under a directory of the host, its names are relative
+// to the directory and can't lead out of it, even through symbolic links.
+type rootFS struct {
+	root *os.Root
+}
+
+func (r rootFS) Open(name string) (fs.File, error) {
+	return r.root.Open(name)
+}
+
+func (r rootFS) WriteFile(name string, data []byte, append bool) error {
+	f, err := r.root.OpenFile(name, writeFlags(append), 0666)
+	if err != nil {
+		return err
+	}
+	return writeAndClose(f, data)
+}
+
+func (r rootFS) MkdirAll(name string) error {
+	return r.root.MkdirAll(name, 0777)
+}
+
+func (r rootFS) Remove(name string) error {
+	return r.root.Remove(name)
+}
+
+func writeFlags(append bool) int {
+	if append {
+		return os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+}
+
+func writeAndClose(f *os.File, data []byte) error {
+	_, err := f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fileAccess gives the file builtins access to the files granted by the capabilities.
+type fileAccess struct {
+	fsys  fs.FS
+	caps  *Capabilities
+	state *evalState
+}
+
+// file checks that the file at path may be accessed by the builtin op and returns the file system
+// where it's accessed and its name there. The paths of the host file system are checked with their
+// symbolic links resolved, see Capabilities.hostFile, those of other file systems are rooted at
+// their top directory, e.g. the capability fs:/data grants access to data/config.edn.
+func (a *fileAccess) file(op, path string, write bool) (fs.FS, string, error) {
+	if _, ok := a.fsys.(osFS); ok {
+		fsys, name, err := a.caps.hostFile(path, write)
+		if err != nil {
+			return nil, "", pathError(op, path, err)
+		}
+		return fsys, name, nil
+	}
+	// Cleaning a rooted path drops the .. elements escaping the root.
+	abs := pathpkg.Clean("/" + path)
+	if err := a.caps.allows(abs, path, write); err != nil {
+		return nil, "", pathError(op, path, err)
+	}
+	name := abs[1:]
+	if name == "" {
+		name = "."
+	}
+	return a.fsys, name, nil
+}
+
+// writable returns fsys as the file system of the writing builtin op.
+func writable(op, path string, fsys fs.FS) (WritableFS, error) {
+	w, ok := fsys.(WritableFS)
+	if !ok {
+		return nil, pathError(op, path, errReadOnly)
+	}
+	return w, nil
+}
+
+// pathError returns the *fs.PathError of the builtin op on path, for the error of a file system
+// operation.
+func pathError(op, path string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+// pathArg returns the path passed to op, and the file system and name of its file, see file.
+func (a *fileAccess) pathArg(op string, obj *Object, write bool) (string, fs.FS, string, error) {
+	path, err := stringArg(op, obj)
+	if err != nil {
+		return "", nil, "", err
+	}
+	fsys, name, err := a.file(op, path, write)
+	return path, fsys, name, err
+}
+
+// fileReadBuiltins returns the functions reading files, their errors are *fs.PathError.
+func fileReadBuiltins(a *fileAccess) map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		// (slurp path) is the content of a file.
+		"slurp": func(args []*Object) (*Object, error) {
+			if err := checkArity("slurp", args, 1, 1); err != nil {
+				return nil, err
+			}
+			path, fsys, name, err := a.pathArg("slurp", args[0], false)
+			if err != nil {
+				return nil, err
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, pathError("slurp", path, err)
+			}
+			return createString(string(data)), nil
+		},
+		// (line-seq path) is the lazy sequence of the lines of a file, without the line endings.
+		"line-seq": func(args []*Object) (*Object, error) {
+			if err := checkArity("line-seq", args, 1, 1); err != nil {
+				return nil, err
+			}
+			path, fsys, name, err := a.pathArg("line-seq", args[0], false)
+			if err != nil {
+				return nil, err
+			}
+			// The file is opened once the sequence is walked.
+			return createLazySeq(a.state, func() (*Object, error) {
+				r, err := openLines(fsys, path, name)
+				if err != nil {
+					return nil, err
+				}
+				seq, err := r.readLine()
+				if err != nil {
+					return nil, err
+				}
+				return createSeq(seq), nil
+			}), nil
+		},
+		"file-exists?": func(args []*Object) (*Object, error) {
+			if err := checkArity("file-exists?", args, 1, 1); err != nil {
+				return nil, err
+			}
+			path, fsys, name, err := a.pathArg("file-exists?", args[0], false)
+			if err != nil {
+				return nil, err
+			}
+			_, err = fs.Stat(fsys, name)
+			if errors.Is(err, fs.ErrNotExist) {
+				return createBoolean(false), nil
+			}
+			if err != nil {
+				return nil, pathError("file-exists?", path, err)
+			}
+			return createBoolean(true), nil
+		},
+		// (list-dir path) is the vector of the names of the files in a directory, sorted.
+		"list-dir": func(args []*Object) (*Object, error) {
+			if err := checkArity("list-dir", args, 1, 1); err != nil {
+				return nil, err
+			}
+			path, fsys, name, err := a.pathArg("list-dir", args[0], false)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := fs.ReadDir(fsys, name)
+			if err != nil {
+				return nil, pathError("list-dir", path, err)
+			}
+			names := make([]*Object, len(entries))
+			for i, entry := range entries {
+				names[i] = createString(entry.Name())
+			}
+			return createVector(names), nil
+		},
+	}
+}
+
+// fileWriteBuiltins returns the functions writing files, their errors are *fs.PathError.
+func fileWriteBuiltins(a *fileAccess) map[string]func(args []*Object) (*Object, error) {
+	// modify runs the operation of the builtin op on the file at the path passed to it.
+	modify := func(op string, args []*Object, min, max int, do func(w WritableFS, name string) error) (*Object, error) {
+		if err := checkArity(op, args, min, max); err != nil {
+			return nil, err
+		}
+		path, fsys, name, err := a.pathArg(op, args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		w, err := writable(op, path, fsys)
+		if err != nil {
+			return nil, err
+		}
+		if err := do(w, name); err != nil {
+			return nil, pathError(op, path, err)
+		}
+		return NilObj, nil
+	}
+	return map[string]func(args []*Object) (*Object, error){
+		// (spit path x) writes x to a file as print would, (spit path x true) appends it.
+		"spit": func(args []*Object) (*Object, error) {
+			return modify("spit", args, 2, 3, func(w WritableFS, name string) error {
+				return w.WriteFile(name, []byte(joinObjects(args[1:2], false)), len(args) == 3 && truthy(args[2]))
+			})
+		},
+		// (mkdir path) creates a directory and its missing parents.
+		"mkdir": func(args []*Object) (*Object, error) {
+			return modify("mkdir", args, 1, 1, func(w WritableFS, name string) error {
+				return w.MkdirAll(name)
+			})
+		},
+		// (delete-file path) removes a file or an empty directory.
+		"delete-file": func(args []*Object) (*Object, error) {
+			return modify("delete-file", args, 1, 1, func(w WritableFS, name string) error {
+				return w.Remove(name)
+			})
+		},
+	}
+}
+
+// maxLineSize is the length of the longest line read by line-seq.
+const maxLineSize = 16 << 20
+
+// lineReader reads the lines of a file for line-seq. The file is closed once its last line is
+// read or reading fails, and when the sequence isn't referenced anymore if it's not walked to the
+// end.
+type lineReader struct {
+	path    string
+	scanner *bufio.Scanner
+	file    io.Closer
+}
+
+func openLines(fsys fs.FS, path, name string) (*lineReader, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, pathError("line-seq", path, err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+	r := &lineReader{path: path, scanner: scanner, file: f}
+	runtime.SetFinalizer(r, (*lineReader).close)
+	return r, nil
+}
+
+func (r *lineReader) close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// readLine reads the next line of the file, and returns nil at the end of the file.
+func (r *lineReader) readLine() (Seq, error) {
+	if r.scanner.Scan() {
+		return &lineSeq{line: createString(r.scanner.Text()), reader: r}, nil
+	}
+	r.close()
+	if err := r.scanner.Err(); err != nil {
+		return nil, pathError("line-seq", r.path, err)
+	}
+	return nil, nil
+}
+
+// lineSeq is the sequence of the lines of a file, which are read as the sequence is walked.
+type lineSeq struct {
+	line   *Object
+	reader *lineReader
+	// next is the rest of the lines once read, or the error reading them.
+	read bool
+	next Seq
+	err  error
+}
+
+func (s *lineSeq) First() *Object {
+	return s.line
+}
+
+func (s *lineSeq) Next() (Seq, error) {
+	if !s.read {
+		s.next, s.err = s.reader.readLine()
+		s.read = true
+	}
+	return s.next, s.err
+}
@@ -0,0 +1,126 @@
+package ast_test
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+// evalError evaluates src in sc and returns its error.
+func evalError(t *testing.T, sc *ast.Scope, src string) error {
+	expr, err := parser.ParseExpr([]byte(src))
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	_, err = expr.Eval(sc)
+	return err
+}
+
+func TestFileBuiltins(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.edn":    {Data: []byte("{:port 80}")},
+		"data/a.txt":    {Data: []byte("one\ntwo\nthree\n")},
+		"data/b.txt":    {Data: []byte("")},
+		"secret/k.txt":  {Data: []byte("key")},
+		"data/wide.txt": {Data: []byte(strings.Repeat("x", 100000))},
+		"data/long.txt": {Data: []byte("short\n" + strings.Repeat("x", 17<<20) + "\n")},
+	}
+	caps, err := ast.ParseCapabilities("core", "fs:/data", "fs:/config.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps, FS: fsys})
+	tests := []struct {
+		src, expect string
+	}{
+		{`(slurp "config.edn")`, `"{:port 80}"`},
+		{`(slurp "/config.edn")`, `"{:port 80}"`},
+		{`(list-dir "data")`, `["a.txt" "b.txt" "long.txt" "wide.txt"]`},
+		{`(count (first (line-seq "data/wide.txt")))`, "100000"},
+		{`(count (line-seq "data/a.txt"))`, "3"},
+		{`(first (rest (line-seq "data/a.txt")))`, `"two"`},
+		{`(count (line-seq "data/b.txt"))`, "0"},
+		{`(file-exists? "data/a.txt")`, "true"},
+		{`(file-exists? "data/c.txt")`, "false"},
+	}
+	for _, test := range tests {
+		if got := evalString(t, sc, test.src).String(); got != test.expect {
+			t.Errorf("%s: expect %s, got %s", test.src, test.expect, got)
+		}
+	}
+
+	errs := []struct {
+		src    string
+		target error
+	}{
+		{`(slurp "data/c.txt")`, fs.ErrNotExist},
+		{`(slurp "secret/k.txt")`, ast.ErrNoCapability},
+		{`(slurp "data/../secret/k.txt")`, ast.ErrNoCapability},
+		{`(first (line-seq "data/c.txt"))`, fs.ErrNotExist},
+		{`(count (line-seq "data/long.txt"))`, bufio.ErrTooLong},
+		// A MapFS is read-only.
+		{`(spit "data/c.txt" "x")`, fs.ErrPermission},
+	}
+	for _, test := range errs {
+		err := evalError(t, sc, test.src)
+		var pe *fs.PathError
+		if !errors.As(err, &pe) || !errors.Is(err, test.target) {
+			t.Errorf("%s: expect a path error %v, got %v", test.src, test.target, err)
+		}
+	}
+
+	// Only the reading builtins are granted by fs:readonly.
+	caps, _ = ast.ParseCapabilities("fs:readonly")
+	sc = ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps, FS: fsys})
+	if sc.Lookup("slurp") == nil || sc.Lookup("spit") != nil {
+		t.Errorf("expect slurp but not spit to be defined with fs:readonly")
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gofp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fsys, err := ast.DirFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, _ := ast.ParseCapabilities("core", "fs")
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps, FS: fsys})
+	for _, src := range []string{`(mkdir "out/logs")`, `(spit "out/logs/a.txt" 1)`, `(spit "out/logs/a.txt" [2 3] true)`} {
+		evalString(t, sc, src)
+	}
+	if got := evalString(t, sc, `(slurp "out/logs/a.txt")`).String(); got != `"1[2 3]"` {
+		t.Errorf("expect \"1[2 3]\", got %s", got)
+	}
+	evalString(t, sc, `(delete-file "out/logs/a.txt")`)
+	if _, err := os.Stat(filepath.Join(dir, "out", "logs", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("expect the file to be deleted, got %v", err)
+	}
+	if err := evalError(t, sc, `(delete-file "out")`); err == nil {
+		t.Errorf("expect a directory which isn't empty not to be deleted")
+	}
+	evalString(t, sc, `(delete-file "out/logs")`)
+	evalString(t, sc, `(delete-file "out")`)
+	if err := evalError(t, sc, `(delete-file "out")`); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expect a missing file error, got %v", err)
+	}
+
+	// The file system can't be escaped through a symbolic link.
+	if err := os.Symlink("/", filepath.Join(dir, "root")); err != nil {
+		t.Fatal(err)
+	}
+	if err := evalError(t, sc, `(list-dir "root/etc")`); err == nil {
+		t.Errorf("expect the link out of the directory to be rejected")
+	}
+}
@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// hints maps the type hints which can annotate parameters and results, written ^Tag, to the kinds
+// of objects they accept.
+var hints = map[string][]ObjKind{
+	"Int":     {Int},
+	"BigInt":  {BigInt},
+	"Ratio":   {Ratio},
+	"Double":  {Double},
+	"Number":  {Int, BigInt, Ratio, Double},
+	"String":  {String},
+	"Boolean": {Boolean},
+	"List":    {List},
+	"Vector":  {Vector},
+	"Map":     {Map},
+	"Set":     {Set},
+	"Seq":     {List, Vector, Sequence, LazySeq, Nil},
+	"Fn":      {Func, Builtin},
+}
+
+// IsHint reports whether tag is a valid type hint.
+func IsHint(tag string) bool {
+	_, ok := hints[tag]
+	return ok
+}
+
+// Hints returns the sorted names of the type hints.
+func Hints() []string {
+	tags := make([]string, 0, len(hints))
+	for tag := range hints {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// HintKinds returns the kinds of objects accepted by a type hint.
+func HintKinds(tag string) []ObjKind {
+	return hints[tag]
+}
+
+// HintAccepts reports whether an object of the given kind satisfies a type hint.
+func HintAccepts(tag string, kind ObjKind) bool {
+	for _, k := range hints[tag] {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArgHints checks the arguments of a call to fn satisfy the type hints of its parameters.
+func checkArgHints(fn *FuncValue, args []*Object) error {
+	for i, tag := range fn.ParamTags {
+		if tag != "" && !HintAccepts(tag, args[i].Kind) {
+			return fmt.Errorf("argument %s of %s must be %s, got %s", fn.Params[i], fn.displayName(), tag, args[i].Kind)
+		}
+	}
+	return nil
+}
+
+// checkResultHint checks the result of a call to fn satisfies the type hint of its result.
+func checkResultHint(fn *FuncValue, res *Object) error {
+	if fn.ResultTag != "" && !HintAccepts(fn.ResultTag, res.Kind) {
+		return fmt.Errorf("result of %s must be %s, got %s", fn.displayName(), fn.ResultTag, res.Kind)
+	}
+	return nil
+}
+
+func (fn *FuncValue) displayName() string {
+	if fn.Name == "" {
+		return "fn"
+	}
+	return fn.Name
+}
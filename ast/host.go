@@ -0,0 +1,119 @@
+package ast
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// envBuiltins returns the functions reading the environment of the process.
+func envBuiltins() map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		// (getenv) is the map of all the variables, (getenv name) the value of one or nil.
+		"getenv": func(args []*Object) (*Object, error) {
+			if err := checkArity("getenv", args, 0, 1); err != nil {
+				return nil, err
+			}
+			if len(args) == 0 {
+				m := newMapValue()
+				for _, kv := range os.Environ() {
+					if i := strings.IndexByte(kv, '='); i >= 0 {
+						m.put(createString(kv[:i]), createString(kv[i+1:]))
+					}
+				}
+				return createMap(m), nil
+			}
+			name, err := stringArg("getenv", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := os.LookupEnv(name); ok {
+				return createString(v), nil
+			}
+			return NilObj, nil
+		},
+	}
+}
+
+// timeBuiltins returns the functions reading the clock and sleeping, the sleeps stop at the time
+// limit of st.
+func timeBuiltins(st *evalState) map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		"current-time-millis": func(args []*Object) (*Object, error) {
+			if err := checkArity("current-time-millis", args, 0, 0); err != nil {
+				return nil, err
+			}
+			return createInt(time.Now().UnixNano() / int64(time.Millisecond)), nil
+		},
+		"nano-time": func(args []*Object) (*Object, error) {
+			if err := checkArity("nano-time", args, 0, 0); err != nil {
+				return nil, err
+			}
+			return createInt(time.Now().UnixNano()), nil
+		},
+		// (sleep ms) pauses for ms milliseconds.
+		"sleep": func(args []*Object) (*Object, error) {
+			if err := checkArity("sleep", args, 1, 1); err != nil {
+				return nil, err
+			}
+			ms, err := intArg("sleep", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if err := st.sleep(time.Duration(ms) * time.Millisecond); err != nil {
+				return nil, err
+			}
+			return NilObj, nil
+		},
+	}
+}
+
+// randBuiltins returns the functions drawing random numbers from r.
+func randBuiltins(r *rand.Rand, st *evalState) map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		// (rand) is a double in [0, 1), (rand n) in [0, n).
+		"rand": func(args []*Object) (*Object, error) {
+			if err := checkArity("rand", args, 0, 1); err != nil {
+				return nil, err
+			}
+			if len(args) == 0 {
+				return createDouble(r.Float64()), nil
+			}
+			if !isNumber(args[0]) {
+				return nil, fmt.Errorf("rand expects a number, got %s", args[0].Kind)
+			}
+			return arith(token.MULT, createDouble(r.Float64()), args[0])
+		},
+		// (rand-int n) is an integer in [0, n).
+		"rand-int": func(args []*Object) (*Object, error) {
+			if err := checkArity("rand-int", args, 1, 1); err != nil {
+				return nil, err
+			}
+			n, err := intArg("rand-int", args[0])
+			if err != nil {
+				return nil, err
+			}
+			if n <= 0 {
+				return nil, fmt.Errorf("rand-int expects a positive integer, got %d", n)
+			}
+			return createInt(int64(r.Intn(n))), nil
+		},
+		"rand-nth": func(args []*Object) (*Object, error) {
+			if err := checkArity("rand-nth", args, 1, 1); err != nil {
+				return nil, err
+			}
+			items, err := sliceArg(st, args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				return nil, fmt.Errorf("rand-nth of an empty collection")
+			}
+			return items[r.Intn(len(items))], nil
+		},
+	}
+}
@@ -0,0 +1,509 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// MarshalJSON encodes an AST as JSON. Every node is an object whose "type" member is the name of
+// its Go type and whose "pos" member, omitted for nodes not created by the parser, is the
+// position of its first token. The other members are the fields of the node with their names in
+// lower camel case:
+//
+//	{"type": "NilExpr"}
+//	{"type": "IdentExpr", "name": string}
+//	{"type": "NumExpr", "kind": "Int"|"BigInt"|"Ratio"|"Double", "value": string}
+//	{"type": "BooleanExpr", "bool": bool}
+//	{"type": "StringExpr", "value": string}
+//	{"type": "VectorExpr", "exprs": ExprList}
+//	{"type": "DefExpr", "ident": IdentExpr, "expr": node, "doc": string, "meta": [entry...]}
+//	{"type": "DefnExpr", "ident": IdentExpr, "expr": node, "private": bool, "doc": string,
+//	 "meta": [entry...]}
+//	{"type": "FuncExpr", "params": [IdentExpr...], "paramTags": [string...], "resultTag": string,
+//	 "pre": ExprList, "post": ExprList, "preSource": [string...], "postSource": [string...],
+//	 "expr": node}
+//	{"type": "ExprList", "exprs": [node...]}
+//	{"type": "CallExpr", "fun": node, "args": ExprList}
+//	{"type": "DoExpr", "exprs": ExprList}
+//	{"type": "IfExpr", "cond": node, "then": node, "else": node}
+//	{"type": "BinaryOp", "op": "<"|">"|"<="|">="|"=", "left": node, "right": node}
+//	{"type": "MultiOp", "op": "+"|"-"|"*"|"/", "exprs": ExprList}
+//	{"type": "BindExpr", "ident": IdentExpr, "value": node}
+//	{"type": "LetExpr", "bindings": [BindExpr...], "body": node}
+//	{"type": "LazySeqExpr", "body": node}
+//	{"type": "AssertExpr", "cond": node, "msg": node, "source": string}
+//	{"type": "NsExpr", "name": IdentExpr, "doc": string}
+//	{"type": "RequireExpr", "specs": [RequireSpec...]}
+//	{"type": "RequireSpec", "module": IdentExpr, "alias": IdentExpr, "refer": [IdentExpr...],
+//	 "referAll": bool}
+//
+// The entries of metadata maps are objects {"key": string, "value": node, "pos": position}. The
+// members which are optional in the syntax, like "paramTags", "private", "doc" or "alias", are
+// omitted when absent, and so are the source texts of conditions.
+//
+// Positions are objects {"offset": int, "line": int, "column": int}. Numbers are encoded as
+// strings in their literal syntax ("42", "1/3", "2.5") so that big integers, ratios and doubles
+// keep their exact value. A missing child node is null.
+func MarshalJSON(node Expr) ([]byte, error) {
+	return json.Marshal(jsonNode(node))
+}
+
+// UnmarshalJSON decodes an AST encoded by MarshalJSON.
+func UnmarshalJSON(data []byte) (Expr, error) {
+	return decodeNode(json.RawMessage(data))
+}
+
+type jsonPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// jsonNode converts a node into the values encoded as its JSON object.
+func jsonNode(node Expr) interface{} {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+	m := map[string]interface{}{"type": fmt.Sprintf("%T", node)[len("*ast."):]}
+	if pos := node.Pos(); pos.IsValid() {
+		m["pos"] = jsonPos{pos.Offset, pos.Line, pos.Column}
+	}
+	switch n := node.(type) {
+	case *NilExpr:
+	case *IdentExpr:
+		m["name"] = n.Name
+	case *NumExpr:
+		m["kind"] = n.Kind.String()
+		m["value"] = (&Object{Kind: n.Kind, Value: n.Value}).String()
+	case *BooleanExpr:
+		m["bool"] = n.Bool
+	case *StringExpr:
+		m["value"] = n.Value
+	case *VectorExpr:
+		m["exprs"] = jsonNode(n.Exprs)
+	case *DefExpr:
+		m["ident"], m["expr"] = jsonNode(n.Ident), jsonNode(n.Expr)
+		jsonDoc(m, n.Doc, n.Meta)
+	case *DefnExpr:
+		m["ident"], m["expr"] = jsonNode(n.Ident), jsonNode(n.Expr)
+		if n.Private {
+			m["private"] = true
+		}
+		jsonDoc(m, n.Doc, n.Meta)
+	case *FuncExpr:
+		params := make([]interface{}, len(n.Params))
+		for i, param := range n.Params {
+			params[i] = jsonNode(param)
+		}
+		m["params"], m["expr"] = params, jsonNode(n.Expr)
+		if n.ParamTags != nil {
+			m["paramTags"] = n.ParamTags
+		}
+		if n.ResultTag != "" {
+			m["resultTag"] = n.ResultTag
+		}
+		if n.Pre != nil {
+			m["pre"] = jsonNode(n.Pre)
+		}
+		if n.Post != nil {
+			m["post"] = jsonNode(n.Post)
+		}
+		if n.PreSource != nil {
+			m["preSource"] = n.PreSource
+		}
+		if n.PostSource != nil {
+			m["postSource"] = n.PostSource
+		}
+	case *ExprList:
+		exprs := make([]interface{}, len(n.Exprs))
+		for i, expr := range n.Exprs {
+			exprs[i] = jsonNode(expr)
+		}
+		m["exprs"] = exprs
+	case *CallExpr:
+		m["fun"], m["args"] = jsonNode(n.Fun), jsonNode(n.Args)
+	case *DoExpr:
+		m["exprs"] = jsonNode(n.Exprs)
+	case *IfExpr:
+		m["cond"], m["then"], m["else"] = jsonNode(n.Cond), jsonNode(n.Then), jsonNode(n.Else)
+	case *BinaryOp:
+		m["op"], m["left"], m["right"] = token.TokenName(n.Op), jsonNode(n.Left), jsonNode(n.Right)
+	case *MultiOp:
+		m["op"], m["exprs"] = token.TokenName(n.Op), jsonNode(n.Exprs)
+	case *BindExpr:
+		m["ident"], m["value"] = jsonNode(n.Ident), jsonNode(n.Value)
+	case *LetExpr:
+		bindings := make([]interface{}, len(n.Bindings))
+		for i, binding := range n.Bindings {
+			bindings[i] = jsonNode(binding)
+		}
+		m["bindings"], m["body"] = bindings, jsonNode(n.Body)
+	case *LazySeqExpr:
+		m["body"] = jsonNode(n.Body)
+	case *AssertExpr:
+		m["cond"], m["msg"] = jsonNode(n.Cond), jsonNode(n.Msg)
+		if n.Source != "" {
+			m["source"] = n.Source
+		}
+	case *NsExpr:
+		m["name"] = jsonNode(n.Name)
+		jsonDoc(m, n.Doc, nil)
+	case *RequireExpr:
+		specs := make([]interface{}, len(n.Specs))
+		for i, spec := range n.Specs {
+			specs[i] = jsonNode(spec)
+		}
+		m["specs"] = specs
+	case *RequireSpec:
+		m["module"] = jsonNode(n.Module)
+		if n.Alias != nil {
+			m["alias"] = jsonNode(n.Alias)
+		}
+		if n.Refer != nil {
+			refer := make([]interface{}, len(n.Refer))
+			for i, ident := range n.Refer {
+				refer[i] = jsonNode(ident)
+			}
+			m["refer"] = refer
+		}
+		if n.ReferAll {
+			m["referAll"] = true
+		}
+	default:
+		panic(fmt.Sprintf("ast.MarshalJSON: unexpected node type %T", n))
+	}
+	return m
+}
+
+// jsonDoc sets the members of the docstring and metadata map of a definition in m.
+func jsonDoc(m map[string]interface{}, doc string, meta []*MetaEntry) {
+	if doc != "" {
+		m["doc"] = doc
+	}
+	if meta == nil {
+		return
+	}
+	entries := make([]interface{}, len(meta))
+	for i, entry := range meta {
+		e := map[string]interface{}{"key": entry.Key, "value": jsonNode(entry.Value)}
+		if pos := entry.Position; pos.IsValid() {
+			e["pos"] = jsonPos{pos.Offset, pos.Line, pos.Column}
+		}
+		entries[i] = e
+	}
+	m["meta"] = entries
+}
+
+// jsonObject is a node being decoded, its members are decoded on demand. The first error is kept
+// in err.
+type jsonObject struct {
+	typ     string
+	members map[string]json.RawMessage
+	err     error
+}
+
+func decodeNode(data json.RawMessage) (Expr, error) {
+	if string(data) == "null" {
+		return nil, nil
+	}
+	o := &jsonObject{}
+	if err := json.Unmarshal(data, &o.members); err != nil {
+		return nil, err
+	}
+	o.decode("type", &o.typ)
+	var pos token.Position
+	if _, ok := o.members["pos"]; ok {
+		var p jsonPos
+		o.decode("pos", &p)
+		pos = token.Position{Offset: p.Offset, Line: p.Line, Column: p.Column}
+	}
+	var node Expr
+	switch o.typ {
+	case "NilExpr":
+		node = &NilExpr{Position: pos}
+	case "IdentExpr":
+		n := &IdentExpr{Position: pos}
+		o.decode("name", &n.Name)
+		node = n
+	case "NumExpr":
+		var kind, value string
+		o.decode("kind", &kind)
+		o.decode("value", &value)
+		n := &NumExpr{Position: pos}
+		if o.err == nil {
+			n.Kind, n.Value, o.err = decodeNum(kind, value)
+		}
+		node = n
+	case "BooleanExpr":
+		n := &BooleanExpr{Position: pos}
+		o.decode("bool", &n.Bool)
+		node = n
+	case "StringExpr":
+		n := &StringExpr{Position: pos}
+		o.decode("value", &n.Value)
+		node = n
+	case "VectorExpr":
+		node = &VectorExpr{Position: pos, Exprs: o.list("exprs")}
+	case "DefExpr":
+		n := &DefExpr{Position: pos, Ident: o.ident("ident"), Expr: o.node("expr")}
+		n.Doc, n.Meta = o.doc(), o.meta()
+		node = n
+	case "DefnExpr":
+		n := &DefnExpr{Position: pos, Ident: o.ident("ident"), Expr: o.node("expr")}
+		if _, ok := o.members["private"]; ok {
+			o.decode("private", &n.Private)
+		}
+		n.Doc, n.Meta = o.doc(), o.meta()
+		node = n
+	case "FuncExpr":
+		n := &FuncExpr{Position: pos, Params: o.idents("params")}
+		if _, ok := o.members["paramTags"]; ok {
+			o.decode("paramTags", &n.ParamTags)
+		}
+		if _, ok := o.members["resultTag"]; ok {
+			o.decode("resultTag", &n.ResultTag)
+		}
+		if _, ok := o.members["pre"]; ok {
+			n.Pre = o.list("pre")
+		}
+		if _, ok := o.members["post"]; ok {
+			n.Post = o.list("post")
+		}
+		if _, ok := o.members["preSource"]; ok {
+			o.decode("preSource", &n.PreSource)
+		}
+		if _, ok := o.members["postSource"]; ok {
+			o.decode("postSource", &n.PostSource)
+		}
+		n.Expr = o.node("expr")
+		node = n
+	case "ExprList":
+		node = &ExprList{Position: pos, Exprs: o.nodes("exprs")}
+	case "CallExpr":
+		node = &CallExpr{Position: pos, Fun: o.node("fun"), Args: o.list("args")}
+	case "DoExpr":
+		node = &DoExpr{Position: pos, Exprs: o.list("exprs")}
+	case "IfExpr":
+		node = &IfExpr{Position: pos, Cond: o.node("cond"), Then: o.node("then"), Else: o.node("else")}
+	case "BinaryOp":
+		node = &BinaryOp{Position: pos, Op: o.op("op"), Left: o.node("left"), Right: o.node("right")}
+	case "MultiOp":
+		node = &MultiOp{Position: pos, Op: o.op("op"), Exprs: o.list("exprs")}
+	case "BindExpr":
+		node = &BindExpr{Position: pos, Ident: o.ident("ident"), Value: o.node("value")}
+	case "LetExpr":
+		n := &LetExpr{Position: pos, Bindings: []*BindExpr{}}
+		for _, binding := range o.nodes("bindings") {
+			if b, ok := binding.(*BindExpr); ok {
+				n.Bindings = append(n.Bindings, b)
+			} else {
+				o.typeError("bindings", "BindExpr", binding)
+			}
+		}
+		n.Body = o.node("body")
+		node = n
+	case "LazySeqExpr":
+		node = &LazySeqExpr{Position: pos, Body: o.node("body")}
+	case "AssertExpr":
+		n := &AssertExpr{Position: pos, Cond: o.node("cond"), Msg: o.node("msg")}
+		if _, ok := o.members["source"]; ok {
+			o.decode("source", &n.Source)
+		}
+		node = n
+	case "NsExpr":
+		node = &NsExpr{Position: pos, Name: o.ident("name"), Doc: o.doc()}
+	case "RequireExpr":
+		n := &RequireExpr{Position: pos, Specs: []*RequireSpec{}}
+		for _, spec := range o.nodes("specs") {
+			if s, ok := spec.(*RequireSpec); ok {
+				n.Specs = append(n.Specs, s)
+			} else {
+				o.typeError("specs", "RequireSpec", spec)
+			}
+		}
+		node = n
+	case "RequireSpec":
+		n := &RequireSpec{Position: pos, Module: o.ident("module")}
+		if _, ok := o.members["alias"]; ok {
+			n.Alias = o.ident("alias")
+		}
+		if _, ok := o.members["refer"]; ok {
+			n.Refer = o.idents("refer")
+		}
+		if _, ok := o.members["referAll"]; ok {
+			o.decode("referAll", &n.ReferAll)
+		}
+		node = n
+	default:
+		if o.err == nil {
+			o.err = fmt.Errorf("ast: unknown node type %q", o.typ)
+		}
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	return node, nil
+}
+
+func (o *jsonObject) decode(name string, v interface{}) {
+	if o.err != nil {
+		return
+	}
+	data, ok := o.members[name]
+	if !ok {
+		o.err = fmt.Errorf("ast: %s has no member %q", o.typ, name)
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		o.err = fmt.Errorf("ast: %s.%s: %v", o.typ, name, err)
+	}
+}
+
+func (o *jsonObject) node(name string) Expr {
+	var data json.RawMessage
+	o.decode(name, &data)
+	if o.err != nil {
+		return nil
+	}
+	node, err := decodeNode(data)
+	if err != nil {
+		o.err = err
+	}
+	return node
+}
+
+func (o *jsonObject) nodes(name string) []Expr {
+	var items []json.RawMessage
+	o.decode(name, &items)
+	nodes := make([]Expr, 0, len(items))
+	for _, item := range items {
+		if o.err != nil {
+			return nil
+		}
+		node, err := decodeNode(item)
+		if err != nil {
+			o.err = err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (o *jsonObject) ident(name string) *IdentExpr {
+	node := o.node(name)
+	ident, ok := node.(*IdentExpr)
+	if !ok {
+		o.typeError(name, "IdentExpr", node)
+	}
+	return ident
+}
+
+// idents decodes a list of identifiers, it's never nil.
+func (o *jsonObject) idents(name string) []*IdentExpr {
+	idents := []*IdentExpr{}
+	for _, node := range o.nodes(name) {
+		if ident, ok := node.(*IdentExpr); ok {
+			idents = append(idents, ident)
+		} else {
+			o.typeError(name, "IdentExpr", node)
+		}
+	}
+	return idents
+}
+
+// doc decodes the optional docstring of a definition.
+func (o *jsonObject) doc() string {
+	var doc string
+	if _, ok := o.members["doc"]; ok {
+		o.decode("doc", &doc)
+	}
+	return doc
+}
+
+// meta decodes the optional metadata map of a definition.
+func (o *jsonObject) meta() []*MetaEntry {
+	if _, ok := o.members["meta"]; !ok {
+		return nil
+	}
+	var entries []struct {
+		Key   string
+		Value json.RawMessage
+		Pos   *jsonPos
+	}
+	o.decode("meta", &entries)
+	meta := make([]*MetaEntry, 0, len(entries))
+	for _, e := range entries {
+		if o.err != nil {
+			return nil
+		}
+		entry := &MetaEntry{Key: e.Key}
+		if e.Pos != nil {
+			entry.Position = token.Position{Offset: e.Pos.Offset, Line: e.Pos.Line, Column: e.Pos.Column}
+		}
+		entry.Value, o.err = decodeNode(e.Value)
+		meta = append(meta, entry)
+	}
+	return meta
+}
+
+func (o *jsonObject) list(name string) *ExprList {
+	node := o.node(name)
+	list, ok := node.(*ExprList)
+	if !ok {
+		o.typeError(name, "ExprList", node)
+	}
+	return list
+}
+
+func (o *jsonObject) op(name string) token.Token {
+	var lit string
+	o.decode(name, &lit)
+	if o.err != nil {
+		return token.ILLEGAL
+	}
+	tok := token.Lookup(lit)
+	if !tok.IsOperator() {
+		o.err = fmt.Errorf("ast: %s.%s: invalid operator %q", o.typ, name, lit)
+	}
+	return tok
+}
+
+func (o *jsonObject) typeError(name, expect string, node Expr) {
+	if o.err == nil {
+		o.err = fmt.Errorf("ast: %s.%s: expect %s, got %T", o.typ, name, expect, node)
+	}
+}
+
+// decodeNum converts the kind and literal of a number back into its value.
+func decodeNum(kind, lit string) (ObjKind, interface{}, error) {
+	var err error
+	switch kind {
+	case "Int":
+		var v int64
+		if v, err = strconv.ParseInt(lit, 10, 64); err == nil {
+			return Int, v, nil
+		}
+	case "BigInt":
+		if v, ok := new(big.Int).SetString(strings.TrimSuffix(lit, "N"), 10); ok && strings.HasSuffix(lit, "N") {
+			return BigInt, v, nil
+		}
+	case "Ratio":
+		if v, ok := new(big.Rat).SetString(lit); ok {
+			return Ratio, v, nil
+		}
+	case "Double":
+		var v float64
+		if v, err = strconv.ParseFloat(lit, 64); err == nil {
+			return Double, v, nil
+		}
+	default:
+		return Bad, nil, fmt.Errorf("ast: invalid number kind %q", kind)
+	}
+	return Bad, nil, fmt.Errorf("ast: invalid %s literal %q", kind, lit)
+}
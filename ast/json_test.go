@@ -0,0 +1,62 @@
+package ast_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	src := `(def x 1)
+(defn f [a b] (if (< a b) (+ a x 1/3 2.5 100000000000000000000N) (let [c [a "s\n" true false nil]] (lazy-seq (g c)))))
+(do ((fn [^Int n] ^Number {:pre [(> n 0)] :post [(< % 0)]} (- n)) 1) (= 1 1) (assert true "ok"))
+(ns my.app) (require '[my.lib :as lib :refer [h]] '[other :refer :all] 'm) (defn- g [] (lib/h))
+(ns my.app "The app.") (defn ^{:deprecated true} f "Doc
+ string." [] 1) (def ^{:added (+ 1 1)} y "The y." 2)`
+	exprs, err := parser.ParseExprs([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range exprs {
+		data, err := ast.MarshalJSON(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(expr, decoded) {
+			t.Errorf("%s doesn't round-trip", data)
+		}
+	}
+	data, _ := ast.MarshalJSON(exprs[0])
+	expect := `{"expr":{"kind":"Int","pos":{"offset":7,"line":1,"column":8},"type":"NumExpr","value":"1"},` +
+		`"ident":{"name":"x","pos":{"offset":5,"line":1,"column":6},"type":"IdentExpr"},` +
+		`"pos":{"offset":0,"line":1,"column":1},"type":"DefExpr"}`
+	if string(data) != expect {
+		t.Errorf("expect %s, got %s", expect, data)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		data, err string
+	}{
+		{`{"type":"FooExpr"}`, "unknown node type"},
+		{`{"type":"IdentExpr"}`, "no member \"name\""},
+		{`{"type":"DefExpr","ident":{"type":"NilExpr"},"expr":null}`, "expect IdentExpr"},
+		{`{"type":"NumExpr","kind":"Int","value":"1.5"}`, "invalid Int literal"},
+		{`{"type":"BinaryOp","op":"x","left":null,"right":null}`, "invalid operator"},
+		{`[]`, "cannot unmarshal"},
+	}
+	for _, test := range tests {
+		_, err := ast.UnmarshalJSON([]byte(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expect error containing %q, got %v", test.data, test.err, err)
+		}
+	}
+}
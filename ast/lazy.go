@@ -0,0 +1,196 @@
+package ast
+
+// LazySeqValue is a sequence which is computed the first time its elements are needed and cached
+// afterwards.
+type LazySeqValue struct {
+	// thunk computes a collection object holding the elements, it's nil once realized.
+	thunk func() (*Object, error)
+	seq   Seq
+	// state is the evaluation which realizes the sequence, each thunk called counts as a step.
+	state *evalState
+}
+
+func createLazySeq(st *evalState, thunk func() (*Object, error)) *Object {
+	return &Object{Kind: LazySeq, Value: &LazySeqValue{thunk: thunk, state: st}}
+}
+
+// Realized reports whether the elements of the sequence have been computed.
+func (l *LazySeqValue) Realized() bool {
+	return l.thunk == nil
+}
+
+// Seq realizes the lazy sequence and returns its elements, nil if it's empty.
+func (l *LazySeqValue) Seq() (Seq, error) {
+	if l.thunk == nil {
+		return l.seq, nil
+	}
+	// A thunk may return another lazy sequence, e.g. a recursive lazy-seq or a filter skipping
+	// elements. They are unwrapped in a loop instead of recursively so the Go stack stays flat, and
+	// all of them share the final result.
+	pending := []*LazySeqValue{l}
+	var seq Seq
+	for cur := l; ; {
+		if err := cur.state.step(); err != nil {
+			return nil, err
+		}
+		obj, err := cur.thunk()
+		if err != nil {
+			return nil, err
+		}
+		if obj.Kind != LazySeq {
+			if seq, err = SeqOf(obj); err != nil {
+				return nil, err
+			}
+			break
+		}
+		next := obj.Value.(*LazySeqValue)
+		if next.thunk == nil {
+			seq = next.seq
+			break
+		}
+		pending = append(pending, next)
+		cur = next
+	}
+	for _, p := range pending {
+		p.seq, p.thunk = seq, nil
+	}
+	return seq, nil
+}
+
+// lazyMap applies fn to the first elements of all the collections, then the second elements and so
+// on until any of them is exhausted.
+func lazyMap(st *evalState, fn *Object, colls []*Object) *Object {
+	return createLazySeq(st, func() (*Object, error) {
+		args := make([]*Object, len(colls))
+		rests := make([]*Object, len(colls))
+		for i, coll := range colls {
+			seq, err := SeqOf(coll)
+			if err != nil {
+				return nil, err
+			}
+			if seq == nil {
+				return NilObj, nil
+			}
+			args[i] = seq.First()
+			if rests[i], err = seqRest(seq); err != nil {
+				return nil, err
+			}
+		}
+		obj, err := Apply(fn, args)
+		if err != nil {
+			return nil, err
+		}
+		return lazyCons(st, obj, lazyMap(st, fn, rests))
+	})
+}
+
+// lazyFilter keeps the elements of coll for which the predicate's truthiness equals keep.
+func lazyFilter(st *evalState, pred, coll *Object, keep bool) *Object {
+	return createLazySeq(st, func() (*Object, error) {
+		seq, err := SeqOf(coll)
+		if err != nil {
+			return nil, err
+		}
+		// Elements which are dropped are skipped in a loop, not by nesting lazy sequences.
+		for seq != nil {
+			obj, err := Apply(pred, []*Object{seq.First()})
+			if err != nil {
+				return nil, err
+			}
+			if truthy(obj) == keep {
+				rest, err := seqRest(seq)
+				if err != nil {
+					return nil, err
+				}
+				return lazyCons(st, seq.First(), lazyFilter(st, pred, rest, keep))
+			}
+			if seq, err = seq.Next(); err != nil {
+				return nil, err
+			}
+		}
+		return NilObj, nil
+	})
+}
+
+// lazyConcat is the elements of all the collections one after another.
+func lazyConcat(st *evalState, colls []*Object) *Object {
+	return createLazySeq(st, func() (*Object, error) {
+		for ; len(colls) > 0; colls = colls[1:] {
+			seq, err := SeqOf(colls[0])
+			if err != nil {
+				return nil, err
+			}
+			if seq == nil {
+				continue
+			}
+			rest, err := seqRest(seq)
+			if err != nil {
+				return nil, err
+			}
+			remaining := append([]*Object{rest}, colls[1:]...)
+			return lazyCons(st, seq.First(), lazyConcat(st, remaining))
+		}
+		return NilObj, nil
+	})
+}
+
+// lazyIterate is the infinite sequence x, (f x), (f (f x)), ...
+func lazyIterate(st *evalState, fn, x *Object) *Object {
+	return createSeq(&consSeq{first: x, rest: iterateAfter(st, fn, x)})
+}
+
+// iterateAfter is the lazy sequence (f x), (f (f x)), ...
+func iterateAfter(st *evalState, fn, x *Object) *Object {
+	return createLazySeq(st, func() (*Object, error) {
+		y, err := Apply(fn, []*Object{x})
+		if err != nil {
+			return nil, err
+		}
+		return lazyCons(st, y, iterateAfter(st, fn, y))
+	})
+}
+
+// lazyCons creates a cell of a lazy sequence realized by a builtin, holding first and the lazy
+// rest. The cell and the rest are counted in the memory held as they are realized.
+func lazyCons(st *evalState, first, rest *Object) (*Object, error) {
+	cell := createSeq(&consSeq{first: first, rest: rest})
+	if err := st.alloc(sizeOf(cell) + sizeOf(rest)); err != nil {
+		return nil, err
+	}
+	return cell, nil
+}
+
+// repeatSeq is the infinite sequence of the same object, walking it counts steps of st.
+type repeatSeq struct {
+	obj   *Object
+	state *evalState
+}
+
+func (s *repeatSeq) First() *Object {
+	return s.obj
+}
+
+func (s *repeatSeq) Next() (Seq, error) {
+	if err := s.state.step(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// cycleSeq repeats the elements of a non-empty slice forever, walking it counts steps of st.
+type cycleSeq struct {
+	items []*Object
+	i     int
+	state *evalState
+}
+
+func (s *cycleSeq) First() *Object {
+	return s.items[s.i]
+}
+
+func (s *cycleSeq) Next() (Seq, error) {
+	if err := s.state.step(); err != nil {
+		return nil, err
+	}
+	return &cycleSeq{items: s.items, i: (s.i + 1) % len(s.items), state: s.state}, nil
+}
@@ -0,0 +1,209 @@
+package ast
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxDepth is the call depth limit of EvalContext when none is given, deep enough for
+// recursive programs and low enough not to overflow the Go stack.
+const DefaultMaxDepth = 100000
+
+// Limits bounds the resources an evaluation may use, a zero field means no limit.
+type Limits struct {
+	// MaxSteps is the number of function calls, lazy sequence realizations and elements walked by
+	// the builtins consuming sequences.
+	MaxSteps int64
+	// MaxDepth is the nesting depth of function calls, DefaultMaxDepth if it's zero. A negative
+	// value means no limit, deep recursion may then overflow the Go stack and crash the program.
+	MaxDepth int
+	// Timeout is the wall time the evaluation may take.
+	Timeout time.Duration
+	// MaxMemory is the number of bytes the evaluation may hold at once, as estimated by the
+	// accounting of Usage.
+	MaxMemory int64
+}
+
+// Usage reports the resources used by an evaluation.
+type Usage struct {
+	Steps int64
+	// Depth is the deepest nesting of function calls reached.
+	Depth int
+	// Allocated is the estimated number of bytes of the collections, strings, closures and scopes
+	// created, and Peak the most of them held at once. The objects are counted as held until the
+	// evaluation ends since their lifetime isn't tracked, only the scopes of function calls and let
+	// expressions are released when they return. Numbers and booleans are not counted.
+	Allocated, Peak int64
+}
+
+// LimitExceeded is the error of an evaluation stopped by one of its limits or by its context.
+type LimitExceeded struct {
+	// Limit is "steps", "depth", "time" or "memory" for the limits, and "context" if the context was
+	// canceled or its deadline passed.
+	Limit string
+	// Value is the limit exceeded.
+	Value interface{}
+	// Err is the error of the context.
+	Err error
+}
+
+func (e *LimitExceeded) Error() string {
+	switch e.Limit {
+	case "steps":
+		return fmt.Sprintf("evaluation exceeded the limit of %d steps", e.Value)
+	case "depth":
+		return fmt.Sprintf("evaluation exceeded the call depth limit of %d", e.Value)
+	case "time":
+		return fmt.Sprintf("evaluation exceeded the time limit of %v", e.Value)
+	case "memory":
+		return fmt.Sprintf("evaluation exceeded the memory quota of %d bytes", e.Value)
+	}
+	return fmt.Sprintf("evaluation stopped: %v", e.Err)
+}
+
+// evalState holds the limits of the evaluation in progress in a global scope. It's shared by all
+// the scopes created from the global scope, including the closures of functions, so that it's
+// found wherever the evaluation goes.
+type evalState struct {
+	active  bool
+	ctx     context.Context
+	limits  Limits
+	timeout <-chan time.Time
+	usage   Usage
+	depth   int
+	// held is the estimated number of bytes held, see Usage.
+	held int64
+}
+
+// EvalContext evaluates expr in sc like expr.Eval(sc), and stops with a *LimitExceeded error when
+// ctx is done or a limit is exceeded. The limits are checked at every function call, including
+// the ones made by builtins like map and reduce, every realization of a lazy sequence and every
+// element walked by the builtins consuming sequences, nil means no limits but the default depth.
+// expr.Eval(sc) evaluates like EvalContext with a background context and no limits.
+func EvalContext(ctx context.Context, expr Expr, sc *Scope, limits *Limits) (*Object, error) {
+	obj, _, err := EvalUsage(ctx, expr, sc, limits)
+	return obj, err
+}
+
+// EvalUsage evaluates expr like EvalContext and reports the resources used, even if the evaluation
+// fails.
+func EvalUsage(ctx context.Context, expr Expr, sc *Scope, limits *Limits) (obj *Object, usage *Usage, err error) {
+	if sc.state == nil {
+		sc.state = &evalState{}
+	}
+	st := sc.state
+	// Restored when done so that an evaluation may run inside another one, e.g. by a builtin.
+	saved := *st
+	defer func() {
+		u := st.usage
+		usage = &u
+		*st = saved
+	}()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	*st = evalState{active: true, ctx: ctx}
+	if limits != nil {
+		st.limits = *limits
+	}
+	if st.limits.MaxDepth == 0 {
+		st.limits.MaxDepth = DefaultMaxDepth
+	}
+	if st.limits.Timeout > 0 {
+		timer := time.NewTimer(st.limits.Timeout)
+		defer timer.Stop()
+		st.timeout = timer.C
+	}
+	if err := st.step(); err != nil {
+		return nil, nil, err
+	}
+	obj, err = expr.Eval(sc)
+	return obj, nil, err
+}
+
+// step counts a step of the evaluation and checks the limits.
+func (st *evalState) step() error {
+	if st == nil || !st.active {
+		return nil
+	}
+	st.usage.Steps++
+	if st.limits.MaxSteps > 0 && st.usage.Steps > st.limits.MaxSteps {
+		return &LimitExceeded{Limit: "steps", Value: st.limits.MaxSteps}
+	}
+	select {
+	case <-st.ctx.Done():
+		return st.stopped()
+	case <-st.timeout:
+		return st.timedOut()
+	default:
+	}
+	return nil
+}
+
+// sleep pauses for d, or until the context is done or the time limit passes.
+func (st *evalState) sleep(d time.Duration) error {
+	if st == nil || !st.active {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-st.ctx.Done():
+		return st.stopped()
+	case <-st.timeout:
+		return st.timedOut()
+	}
+}
+
+// stopped returns the error of an evaluation whose context is done.
+func (st *evalState) stopped() error {
+	return &LimitExceeded{Limit: "context", Err: st.ctx.Err()}
+}
+
+// timedOut returns the error of an evaluation past its time limit.
+func (st *evalState) timedOut() error {
+	// The timer fires once, the following checks must fail too.
+	st.timeout = expired
+	return &LimitExceeded{Limit: "time", Value: st.limits.Timeout}
+}
+
+// expired is a channel which is always ready, for timeouts which already fired.
+var expired = func() <-chan time.Time {
+	c := make(chan time.Time)
+	close(c)
+	return c
+}()
+
+// enter counts a function call, it must be followed by leave if it succeeds. Out of EvalContext
+// only the depth is counted, limited to DefaultMaxDepth.
+func (st *evalState) enter() error {
+	if st == nil {
+		return nil
+	}
+	if err := st.step(); err != nil {
+		return err
+	}
+	st.depth++
+	max := st.limits.MaxDepth
+	if max == 0 {
+		max = DefaultMaxDepth
+	}
+	if max > 0 && st.depth > max {
+		st.depth--
+		return &LimitExceeded{Limit: "depth", Value: max}
+	}
+	if st.depth > st.usage.Depth {
+		st.usage.Depth = st.depth
+	}
+	return nil
+}
+
+func (st *evalState) leave() {
+	if st != nil {
+		st.depth--
+	}
+}
@@ -0,0 +1,139 @@
+package ast_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestEvalContext(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn loop [n] (loop (+ n 1)))")
+	evalString(t, sc, "(defn sum [n] (if (= n 0) 0 (+ n (sum (- n 1)))))")
+	evalString(t, sc, "(defn nat [n] (lazy-seq (cons n (nat (+ n 1)))))")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		src    string
+		ctx    context.Context
+		limits *ast.Limits
+		// limit is the limit exceeded, empty if the evaluation succeeds.
+		limit string
+	}{
+		{"(sum 100)", nil, &ast.Limits{MaxSteps: 1000, MaxDepth: 200, Timeout: time.Second}, ""},
+		{"(sum 100)", nil, &ast.Limits{MaxSteps: 100}, "steps"},
+		{"(sum 100)", nil, &ast.Limits{MaxDepth: 50}, "depth"},
+		{"(loop 0)", nil, nil, "depth"},
+		{"(loop 0)", nil, &ast.Limits{MaxSteps: 10000, MaxDepth: -1}, "steps"},
+		{"(loop 0)", nil, &ast.Limits{Timeout: 10 * time.Millisecond, MaxDepth: -1}, "time"},
+		{"(count (nat 0))", nil, &ast.Limits{Timeout: 10 * time.Millisecond}, "time"},
+		{"(count (nat 0))", nil, &ast.Limits{MaxSteps: 1000}, "steps"},
+		{"(count (range))", nil, &ast.Limits{Timeout: 10 * time.Millisecond}, "time"},
+		{"(reduce (fn [a b] a) 0 (range))", nil, &ast.Limits{MaxSteps: 1000}, "steps"},
+		{"(first (filter (fn [x] false) (range)))", nil, &ast.Limits{MaxSteps: 1000}, "steps"},
+		{"(dorun (map list (repeat 1)))", nil, &ast.Limits{Timeout: 10 * time.Millisecond}, "time"},
+		{"(sort (cycle [1 2]))", nil, &ast.Limits{MaxSteps: 1000}, "steps"},
+		{"(= (range) (range))", nil, &ast.Limits{Timeout: 10 * time.Millisecond}, "time"},
+		{"(hash-set (range))", nil, &ast.Limits{MaxSteps: 1000}, "steps"},
+		{"(reduce (fn [a b] (sum 10)) 0 [1 2 3])", nil, &ast.Limits{MaxDepth: 5}, "depth"},
+		{"(sum 1)", canceled, nil, "context"},
+		{"(sleep 1000000)", nil, &ast.Limits{Timeout: 10 * time.Millisecond}, "time"},
+		{"(sleep 1000000)", canceled, nil, "context"},
+	}
+	for _, test := range tests {
+		expr, err := parser.ParseExpr([]byte(test.src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", test.src, err)
+		}
+		_, err = ast.EvalContext(test.ctx, expr, sc, test.limits)
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.src, err)
+			}
+			continue
+		}
+		if e, ok := err.(*ast.LimitExceeded); !ok || e.Limit != test.limit {
+			t.Errorf("%s with %+v: expect the %s limit to be exceeded, got %v", test.src, test.limits, test.limit, err)
+		}
+	}
+
+	// The limits only apply to EvalContext.
+	if obj := evalString(t, sc, "(sum 1000)"); obj.String() != "500500" {
+		t.Errorf("expect 500500, got %s", obj)
+	}
+	// Eval stops at the default depth rather than overflowing the stack.
+	expr, err := parser.ParseExpr([]byte("(loop 0)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expr.Eval(sc); !isLimit(err, "depth") {
+		t.Errorf("(loop 0): expect the depth limit to be exceeded, got %v", err)
+	}
+	if obj := evalString(t, sc, "(sum 10)"); obj.String() != "55" {
+		t.Errorf("expect 55 after a failed evaluation, got %s", obj)
+	}
+}
+
+// isLimit reports whether err is a *ast.LimitExceeded for limit.
+func isLimit(err error, limit string) bool {
+	e, ok := err.(*ast.LimitExceeded)
+	return ok && e.Limit == limit
+}
+
+func TestEvalUsage(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn build [n acc] (if (= n 0) acc (build (- n 1) (apply vector (cons n acc)))))")
+	evalString(t, sc, "(defn sum [n] (if (= n 0) 0 (+ n (sum (- n 1)))))")
+	eval := func(src string, limits *ast.Limits) (*ast.Usage, error) {
+		expr, err := parser.ParseExpr([]byte(src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", src, err)
+		}
+		_, usage, err := ast.EvalUsage(nil, expr, sc, limits)
+		return usage, err
+	}
+
+	usage, err := eval("(do (sum 100) (sum 100))", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Steps < 200 || usage.Depth < 100 || usage.Peak < 100*64 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	// The scopes of the calls are released once they return.
+	if usage.Peak > usage.Allocated/2 {
+		t.Errorf("expect the peak to be at most half the %d bytes allocated, got %d", usage.Allocated, usage.Peak)
+	}
+
+	// Each vector built is held, the quota is exceeded quadratically.
+	small, err := eval("(build 10 [])", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err = eval("(build 1000 [])", &ast.Limits{MaxMemory: 100 * small.Peak})
+	if e, ok := err.(*ast.LimitExceeded); !ok || e.Limit != "memory" {
+		t.Errorf("expect the memory quota to be exceeded, got %v", err)
+	}
+	if usage.Peak <= 100*small.Peak {
+		t.Errorf("expect the peak to be over the quota, got %+v", usage)
+	}
+	if _, err := eval("(build 100 [])", &ast.Limits{MaxMemory: 100 * small.Peak}); err != nil {
+		t.Errorf("(build 100 []): %v", err)
+	}
+
+	// The cells of lazy sequences are counted as they are realized, and the collections built by
+	// builtins as they grow.
+	for _, src := range []string{
+		"(count (doall (map (fn [x] x) (range 100000))))",
+		"(doall (range))",
+		"(take 1000000 (repeat 1))",
+	} {
+		_, err := eval(src, &ast.Limits{MaxMemory: 100000})
+		if e, ok := err.(*ast.LimitExceeded); !ok || e.Limit != "memory" {
+			t.Errorf("%s: expect the memory quota to be exceeded, got %v", src, err)
+		}
+	}
+}
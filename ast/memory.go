@@ -0,0 +1,89 @@
+package ast
+
+// Estimated sizes in bytes of the values held by objects, for the memory accounting of
+// evaluations on 64-bit platforms.
+const (
+	objectSize  = 32 // Object with its kind and boxed value.
+	pointerSize = 8
+	sliceSize   = 24
+	stringSize  = 16
+	// A Scope with its map, and a binding in the map.
+	scopeSize = 64
+	entrySize = 40
+	funcSize  = 128 // FuncValue.
+	lazySize  = 64  // LazySeqValue with its thunk.
+	seqSize   = 32
+)
+
+// sizeOf estimates the bytes held by obj itself, without the objects it refers to.
+func sizeOf(obj *Object) int64 {
+	switch obj.Kind {
+	case List, Vector:
+		return objectSize + sliceSize + pointerSize*int64(len(obj.Value.([]*Object)))
+	case String:
+		return objectSize + stringSize + int64(len(obj.Value.(string)))
+	case Map:
+		// Keys, values and the index by hash key.
+		n := int64(obj.Value.(*MapValue).Len())
+		return objectSize + 2*sliceSize + 2*pointerSize*n + scopeSize + entrySize*n
+	case Set:
+		n := int64(len(obj.Value.(*SetValue).items))
+		return objectSize + sliceSize + pointerSize*n + scopeSize + entrySize*n
+	case Sequence:
+		return objectSize + seqSize
+	case LazySeq:
+		return objectSize + lazySize
+	case Func:
+		return objectSize + funcSize + scopeSizeOf(len(obj.Value.(*FuncValue).Closure.Objects))
+	}
+	// Numbers, booleans and nil.
+	return 0
+}
+
+// scopeSizeOf estimates the bytes held by a scope of n bindings.
+func scopeSizeOf(n int) int64 {
+	return scopeSize + entrySize*int64(n)
+}
+
+// alloc counts n bytes held and checks the memory quota.
+func (st *evalState) alloc(n int64) error {
+	if st == nil || !st.active || n == 0 {
+		return nil
+	}
+	st.held += n
+	st.usage.Allocated += n
+	if st.held > st.usage.Peak {
+		st.usage.Peak = st.held
+	}
+	if st.limits.MaxMemory > 0 && st.held > st.limits.MaxMemory {
+		return &LimitExceeded{Limit: "memory", Value: st.limits.MaxMemory}
+	}
+	return nil
+}
+
+// free releases n bytes counted by alloc.
+func (st *evalState) free(n int64) {
+	if st != nil && st.active {
+		st.held -= n
+	}
+}
+
+// allocResult counts the object returned by a builtin unless it's one of its arguments.
+func (st *evalState) allocResult(res *Object, args []*Object) error {
+	for _, arg := range args {
+		if res == arg {
+			return nil
+		}
+	}
+	return st.alloc(sizeOf(res))
+}
+
+// appendHeld appends obj to a slice being built by a builtin and counts the element, so that
+// building a collection too large fails as soon as it exceeds the quota rather than once it's
+// returned. The returned collection is counted again, like the copies made by append as it grows.
+func (st *evalState) appendHeld(objects []*Object, obj *Object) ([]*Object, error) {
+	if err := st.alloc(pointerSize); err != nil {
+		return nil, err
+	}
+	return append(objects, obj), nil
+}
@@ -0,0 +1,185 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Meta is the metadata of an object bound by def or defn.
+type Meta struct {
+	// Name is the name of the definition and Ns the namespace it belongs to.
+	Name, Ns string
+	// Doc is the docstring, or the :doc entry of the metadata map.
+	Doc string
+	// Private is set for defn- and for a true :private entry, the name can't be used by other
+	// modules.
+	Private bool
+	// Entries holds the values of the metadata map, keyed by strings without the colon, like
+	// "deprecated".
+	Entries *MapValue
+	// Def is the definition, printed by source.
+	Def Expr
+}
+
+// defMeta evaluates the metadata of the definition def binding name in sc.
+func defMeta(sc *Scope, def Expr, name, doc string, entries []*MetaEntry, private bool) (*Meta, error) {
+	meta := &Meta{Name: name, Doc: doc, Private: private, Entries: newMapValue(), Def: def}
+	if sc.ns != nil {
+		meta.Ns = sc.ns.name
+	}
+	for _, entry := range entries {
+		val, err := entry.Value.Eval(sc)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.TrimPrefix(entry.Key, ":")
+		switch {
+		case key == "doc" && val.Kind == String && meta.Doc == "":
+			meta.Doc = val.Value.(string)
+		case key == "private":
+			meta.Private = meta.Private || truthy(val)
+		}
+		meta.Entries.put(createString(key), val)
+	}
+	if meta.Private && sc.ns != nil {
+		sc.ns.private[name] = true
+	}
+	return meta, nil
+}
+
+// QualifiedName returns the name of the definition qualified by its namespace, like user/f.
+func (m *Meta) QualifiedName() string {
+	if m.Ns == "" {
+		return m.Name
+	}
+	return m.Ns + "/" + m.Name
+}
+
+// Deprecated returns whether the definition is deprecated by a :deprecated entry, and the message
+// if the value of the entry is a string.
+func (m *Meta) Deprecated() (bool, string) {
+	val := m.Entries.Get(createString("deprecated"))
+	if val == nil || !truthy(val) {
+		return false, ""
+	}
+	if val.Kind == String {
+		return true, val.Value.(string)
+	}
+	return true, ""
+}
+
+// Arglists returns the parameter lists of a function like ([x y]), or "" for other objects.
+func Arglists(obj *Object) string {
+	if obj.Kind != Func {
+		return ""
+	}
+	return "([" + strings.Join(obj.Value.(*FuncValue).Params, " ") + "])"
+}
+
+// Doc returns the documentation of obj: its name, which is name if it has no metadata, its
+// argument lists and its docstring.
+func Doc(name string, obj *Object) string {
+	var b strings.Builder
+	meta := obj.Meta
+	if meta != nil {
+		name = meta.QualifiedName()
+	} else if obj.Kind == Builtin {
+		name = obj.Value.(*BuiltinFunc).Name
+	}
+	b.WriteString(name + "\n")
+	if arglists := Arglists(obj); arglists != "" {
+		b.WriteString(arglists + "\n")
+	}
+	switch {
+	case meta != nil && meta.Doc != "":
+		for _, line := range strings.Split(meta.Doc, "\n") {
+			b.WriteString("  " + strings.TrimSpace(line) + "\n")
+		}
+	case obj.Kind == Builtin:
+		b.WriteString("  Builtin function.\n")
+	case obj.Kind != Func:
+		fmt.Fprintf(&b, "  %s: %s\n", obj.Kind, obj)
+	}
+	if meta != nil {
+		if ok, msg := meta.Deprecated(); ok && msg != "" {
+			fmt.Fprintf(&b, "  Deprecated: %s\n", msg)
+		} else if ok {
+			b.WriteString("  Deprecated.\n")
+		}
+	}
+	return b.String()
+}
+
+// builtinMeta returns the metadata of an object as a map with the keys "name", "ns", "doc",
+// "arglists", "line" and those of the metadata map of its definition, or nil.
+func builtinMeta(args []*Object) (*Object, error) {
+	if err := checkArity("meta", args, 1, 1); err != nil {
+		return nil, err
+	}
+	meta := args[0].Meta
+	if meta == nil {
+		return NilObj, nil
+	}
+	m := newMapValue()
+	m.put(createString("name"), createString(meta.Name))
+	m.put(createString("ns"), createString(meta.Ns))
+	if meta.Doc != "" {
+		m.put(createString("doc"), createString(meta.Doc))
+	}
+	if args[0].Kind == Func {
+		m.put(createString("arglists"), arglists(args[0]))
+	}
+	if pos := meta.Def.Pos(); pos.IsValid() {
+		m.put(createString("line"), createInt(int64(pos.Line)))
+	}
+	for _, key := range meta.Entries.Keys() {
+		m.put(key, meta.Entries.Get(key))
+	}
+	return createMap(m), nil
+}
+
+// builtinArglists returns the parameter lists of a function as a list of vectors of names, nil for
+// builtins.
+func builtinArglists(args []*Object) (*Object, error) {
+	if err := checkArity("arglists", args, 1, 1); err != nil {
+		return nil, err
+	}
+	fn, err := fnArg("arglists", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if fn.Kind == Builtin {
+		return NilObj, nil
+	}
+	return arglists(fn), nil
+}
+
+func arglists(fn *Object) *Object {
+	params := NewStringList(fn.Value.(*FuncValue).Params)
+	return createList([]*Object{createVector(params.Value.([]*Object))})
+}
+
+// docBuiltins returns the functions printing the documentation and source of definitions to w.
+func docBuiltins(w io.Writer) map[string]func(args []*Object) (*Object, error) {
+	return map[string]func(args []*Object) (*Object, error){
+		"doc": func(args []*Object) (*Object, error) {
+			if err := checkArity("doc", args, 1, 1); err != nil {
+				return nil, err
+			}
+			_, err := io.WriteString(w, Doc("fn", args[0]))
+			return NilObj, err
+		},
+		// (source f) prints the definition of f as it was parsed.
+		"source": func(args []*Object) (*Object, error) {
+			if err := checkArity("source", args, 1, 1); err != nil {
+				return nil, err
+			}
+			if args[0].Meta == nil {
+				_, err := io.WriteString(w, "Source not found\n")
+				return NilObj, err
+			}
+			return NilObj, Fprint(w, args[0].Meta.Def, &PrintOptions{Mode: SExprMode})
+		},
+	}
+}
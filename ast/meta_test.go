@@ -0,0 +1,51 @@
+package ast_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+)
+
+func TestMeta(t *testing.T) {
+	var out bytes.Buffer
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Stdout: &out})
+	evalString(t, sc, `(defn ^{:deprecated true :added (+ 1 1)} area "Computes the area." [w h] (* w h))`)
+	evalString(t, sc, `(def ^{:doc "The answer."} answer 42)`)
+	evalString(t, sc, `(def other answer)`)
+
+	tests := []struct {
+		src, expect string
+	}{
+		{"(meta area)", `{"name" "area", "ns" "user", "doc" "Computes the area.", "arglists" (["w" "h"]), "line" 1, "deprecated" true, "added" 2}`},
+		{"(meta answer)", `{"name" "answer", "ns" "user", "doc" "The answer.", "line" 1}`},
+		{"(meta (fn [x] x))", "nil"},
+		{"(arglists area)", `(["w" "h"])`},
+		{"(arglists +)", "nil"},
+		{"(area 2 3)", "6"},
+		{"other", "42"},
+	}
+	for _, test := range tests {
+		if res := evalString(t, sc, test.src); res.String() != test.expect {
+			t.Errorf("%s: expect %s, got %s", test.src, test.expect, res)
+		}
+	}
+
+	docs := []struct {
+		src, expect string
+	}{
+		{"(doc area)", "user/area\n([w h])\n  Computes the area.\n  Deprecated.\n"},
+		{"(doc answer)", "user/answer\n  The answer.\n"},
+		{"(doc other)", "user/other\n  Int: 42\n"},
+		{"(doc +)", "+\n  Builtin function.\n"},
+		{"(source area)", "(defn ^{:deprecated true :added (+ 1 1)} area\n  \"Computes the area.\"\n  [w h]\n  (* w h))\n"},
+		{"(source +)", "Source not found\n"},
+	}
+	for _, test := range docs {
+		out.Reset()
+		evalString(t, sc, test.src)
+		if out.String() != test.expect {
+			t.Errorf("%s: expect\n%s\ngot\n%s", test.src, test.expect, out.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Loader finds the modules loaded by require.
+type Loader interface {
+	// Load returns the expressions of the module with the given name, like my.lib, and the file
+	// they were read from.
+	Load(name string) (file string, exprs []Expr, err error)
+}
+
+// namespace is the global scope of a program or module.
+type namespace struct {
+	name  string
+	scope *Scope
+	// module is set for the namespaces of modules, whose names are fixed by require.
+	module bool
+	// aliases maps the names and aliases of the required modules to their namespaces.
+	aliases map[string]*namespace
+	// private holds the names defined by defn-, referred the names referred to from other modules,
+	// neither can be used by the modules requiring this one.
+	private  map[string]bool
+	referred map[string]bool
+	modules  *modules
+}
+
+// modules holds the modules loaded by a program, shared by the namespaces of the program and of
+// the modules.
+type modules struct {
+	opts   Options
+	loaded map[string]*namespace
+	// loading is the chain of modules being loaded, each one requiring the next, from the
+	// namespace of the program.
+	loading []string
+}
+
+func newNamespace(name string, sc *Scope, mods *modules) *namespace {
+	return &namespace{name: name, scope: sc, aliases: make(map[string]*namespace), private: make(map[string]bool), referred: make(map[string]bool), modules: mods}
+}
+
+// load returns the namespace of a module, evaluated the first time it's required.
+func (m *modules) load(name string, state *evalState) (*namespace, error) {
+	if ns, ok := m.loaded[name]; ok {
+		return ns, nil
+	}
+	for i, loading := range m.loading {
+		if loading == name {
+			chain := append(append([]string(nil), m.loading[i:]...), name)
+			return nil, fmt.Errorf("circular dependency between modules: %s", strings.Join(chain, " -> "))
+		}
+	}
+	if m.opts.Loader == nil {
+		return nil, fmt.Errorf("can't load module %s without a module loader", name)
+	}
+	file, exprs, err := m.opts.Loader.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	m.loading = append(m.loading, name)
+	defer func() { m.loading = m.loading[:len(m.loading)-1] }()
+
+	// The definitions of the module are bound in a scope of their own, on top of its builtins.
+	builtins := newBuiltinScope(&m.opts, state)
+	sc := NewScope(builtins)
+	ns := newNamespace(name, sc, m)
+	ns.module = true
+	builtins.ns, sc.ns = ns, ns
+	for _, expr := range exprs {
+		if _, err := expr.Eval(sc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	m.loaded[name] = ns
+	return ns, nil
+}
+
+// public returns the object bound to a name defined by the module of ns.
+func (ns *namespace) public(name string) (*Object, error) {
+	obj, ok := ns.scope.Objects[name]
+	if !ok || ns.referred[name] {
+		return nil, fmt.Errorf("%s is not defined in module %s", name, ns.name)
+	}
+	if ns.private[name] {
+		return nil, fmt.Errorf("%s is private to module %s", name, ns.name)
+	}
+	return obj, nil
+}
+
+// lookupQualified returns the object bound to name in the module required as alias, or nil.
+func (ns *namespace) lookupQualified(alias, name string) *Object {
+	mod, ok := ns.aliases[alias]
+	if !ok {
+		return nil
+	}
+	obj, err := mod.public(name)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// splitQualified splits a qualified name, like lib/f, into the alias of a module and a name.
+func splitQualified(name string) (string, string, bool) {
+	i := strings.IndexByte(name, '/')
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// undefined returns the error of a name which isn't defined in sc.
+func (s *Scope) undefined(name string) error {
+	if alias, name, ok := splitQualified(name); ok && s.ns != nil {
+		mod, ok := s.ns.aliases[alias]
+		if !ok {
+			return fmt.Errorf("no module is required as %s", alias)
+		}
+		if _, err := mod.public(name); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%q is not defined.", name)
+}
+
+func (expr *NsExpr) Eval(sc *Scope) (*Object, error) {
+	ns := sc.ns
+	if ns == nil {
+		return NilObj, nil
+	}
+	if ns.module && expr.Name.Name != ns.name {
+		return nil, fmt.Errorf("module %s declares namespace %s", ns.name, expr.Name.Name)
+	}
+	if !ns.module {
+		// The program is loading until it ends, a module requiring it back closes a cycle.
+		ns.modules.loading = []string{expr.Name.Name}
+	}
+	ns.name = expr.Name.Name
+	return NilObj, nil
+}
+
+func (expr *RequireExpr) Eval(sc *Scope) (*Object, error) {
+	for _, spec := range expr.Specs {
+		if _, err := spec.Eval(sc); err != nil {
+			return nil, err
+		}
+	}
+	return NilObj, nil
+}
+
+func (expr *RequireSpec) Eval(sc *Scope) (*Object, error) {
+	ns := sc.ns
+	if ns == nil {
+		return nil, fmt.Errorf("can't require %s out of a global scope", expr.Module.Name)
+	}
+	mod, err := ns.modules.load(expr.Module.Name, sc.state)
+	if err != nil {
+		return nil, err
+	}
+	ns.aliases[mod.name] = mod
+	if expr.Alias != nil {
+		ns.aliases[expr.Alias.Name] = mod
+	}
+	var names []string
+	for _, ident := range expr.Refer {
+		names = append(names, ident.Name)
+	}
+	if expr.ReferAll {
+		for name := range mod.scope.Objects {
+			if !mod.private[name] && !mod.referred[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		obj, err := mod.public(name)
+		if err != nil {
+			return nil, err
+		}
+		sc.Insert(name, obj)
+		ns.referred[name] = true
+	}
+	return NilObj, nil
+}
@@ -0,0 +1,100 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/module"
+)
+
+func TestRequire(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/my/lib.gofp": {Data: []byte(`(ns my.lib)
+(defn- twice [x] (* x 2))
+(defn helper [x] (+ (twice x) 1))
+(def answer 42)
+(def ^{:private true} secret 1)`)},
+		"lib/my/util.gofp": {Data: []byte(`(ns my.util) (require '[my.lib :refer [helper]]) (defn f [x] (helper x))`)},
+		"lib/a.gofp":       {Data: []byte(`(ns a) (require 'b)`)},
+		"lib/b.gofp":       {Data: []byte(`(ns b) (require 'a)`)},
+		"lib/wrong.gofp":   {Data: []byte(`(ns right)`)},
+		"vendor/v.gofp":    {Data: []byte(`(ns v) (def x "vendor")`)},
+	}
+	loader := &module.Loader{Path: []string{"lib", "vendor"}, FS: fsys}
+	newScope := func() *ast.Scope {
+		return ast.NewGlobalScopeWithOptions(&ast.Options{Loader: loader})
+	}
+
+	sc := newScope()
+	evalString(t, sc, "(require '[my.lib :as lib :refer [answer]] 'my.util '[v :refer :all])")
+	tests := []struct {
+		src, expect string
+	}{
+		{"(lib/helper 2)", "5"},
+		{"(my.lib/helper 3)", "7"},
+		{"answer", "42"},
+		{"(my.util/f 1)", "3"},
+		{"x", `"vendor"`},
+	}
+	for _, test := range tests {
+		if res := evalString(t, sc, test.src); res.String() != test.expect {
+			t.Errorf("%s: expect %s, got %s", test.src, test.expect, res)
+		}
+	}
+
+	errs := []struct {
+		src, expect string
+	}{
+		{"(lib/twice 1)", "twice is private to module my.lib"},
+		{"lib/secret", "secret is private to module my.lib"},
+		{"(lib/nope 1)", "nope is not defined in module my.lib"},
+		{"(other/f 1)", "no module is required as other"},
+		{"helper", `"helper" is not defined`},
+		{"(require '[my.lib :refer [twice]])", "twice is private to module my.lib"},
+		{"(require 'a)", "circular dependency between modules: a -> b -> a"},
+		{"(require 'wrong)", "module wrong declares namespace right"},
+		{"(require 'missing)", "module missing not found in lib:vendor"},
+	}
+	for _, test := range errs {
+		err := evalError(t, sc, test.src)
+		if err == nil || !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("%s: expect error %q, got %v", test.src, test.expect, err)
+		}
+	}
+
+	// The cycles through the program start from its namespace.
+	sc = newScope()
+	evalString(t, sc, "(ns a)")
+	if err := evalError(t, sc, "(require 'b)"); err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("expect the cycle a -> b -> a, got %v", err)
+	}
+
+	// A module is loaded once, and shared by the modules requiring it.
+	counter := &countingLoader{Loader: loader, loads: make(map[string]int)}
+	sc = ast.NewGlobalScopeWithOptions(&ast.Options{Loader: counter})
+	evalString(t, sc, "(require 'my.lib 'my.util '[my.lib :as l])")
+	if counter.loads["my.lib"] != 1 || counter.loads["my.util"] != 1 {
+		t.Errorf("expect each module to be loaded once, got %v", counter.loads)
+	}
+	if err := evalError(t, sc, "(my.util/helper 1)"); err == nil {
+		t.Error("expect the names referred to by a module not to be part of it")
+	}
+
+	sc = ast.NewGlobalScope()
+	if err := evalError(t, sc, "(require 'my.lib)"); err == nil {
+		t.Error("expect require to fail without a module loader")
+	}
+}
+
+// countingLoader counts the loads of each module.
+type countingLoader struct {
+	ast.Loader
+	loads map[string]int
+}
+
+func (l *countingLoader) Load(name string) (string, []ast.Expr, error) {
+	l.loads[name]++
+	return l.Loader.Load(name)
+}
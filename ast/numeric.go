@@ -0,0 +1,228 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// Numbers form a tower Int < BigInt < Ratio < Double. Arithmetic on two numbers of different kinds
+// converts both to the higher kind first. Int results overflowing int64 are promoted to BigInt, and
+// dividing integers which don't divide evenly gives a Ratio.
+
+func isNumber(obj *Object) bool {
+	return numRank(obj.Kind) >= 0
+}
+
+func numRank(kind ObjKind) int {
+	switch kind {
+	case Int:
+		return 0
+	case BigInt:
+		return 1
+	case Ratio:
+		return 2
+	case Double:
+		return 3
+	}
+	return -1
+}
+
+func toBigInt(obj *Object) *big.Int {
+	switch v := obj.Value.(type) {
+	case int64:
+		return big.NewInt(v)
+	case *big.Int:
+		return v
+	}
+	panic(fmt.Sprintf("can't convert %s to big integer", obj.Kind))
+}
+
+func toRat(obj *Object) *big.Rat {
+	switch v := obj.Value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v)
+	case *big.Int:
+		return new(big.Rat).SetInt(v)
+	case *big.Rat:
+		return v
+	}
+	panic(fmt.Sprintf("can't convert %s to ratio", obj.Kind))
+}
+
+func toFloat(obj *Object) float64 {
+	switch v := obj.Value.(type) {
+	case int64:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	panic(fmt.Sprintf("can't convert %s to double", obj.Kind))
+}
+
+// arith applies one of the arithmetic operators ADD, SUB, MULT and DIV to two numbers.
+func arith(op token.Token, x, y *Object) (*Object, error) {
+	rank := numRank(x.Kind)
+	if r := numRank(y.Kind); r > rank {
+		rank = r
+	}
+	switch rank {
+	case 0:
+		if res, ok := intArith(op, x.Value.(int64), y.Value.(int64)); ok {
+			return res, nil
+		}
+		// Overflowed or inexact division, retry with arbitrary precision.
+		if op == token.DIV {
+			return ratArith(op, toRat(x), toRat(y))
+		}
+		return bigArith(op, toBigInt(x), toBigInt(y))
+	case 1:
+		return bigArith(op, toBigInt(x), toBigInt(y))
+	case 2:
+		return ratArith(op, toRat(x), toRat(y))
+	}
+	a, b := toFloat(x), toFloat(y)
+	switch op {
+	case token.ADD:
+		return createDouble(a + b), nil
+	case token.SUB:
+		return createDouble(a - b), nil
+	case token.MULT:
+		return createDouble(a * b), nil
+	case token.DIV:
+		return createDouble(a / b), nil
+	}
+	return nil, fmt.Errorf("invalid op %q", token.TokenName(op))
+}
+
+// intArith computes the operation on int64 values, it returns false if the result doesn't fit in an
+// int64 or is not an integer.
+func intArith(op token.Token, a, b int64) (*Object, bool) {
+	switch op {
+	case token.ADD:
+		r := a + b
+		if (a > 0 && b > 0 && r < 0) || (a < 0 && b < 0 && r >= 0) {
+			return nil, false
+		}
+		return createInt(r), true
+	case token.SUB:
+		r := a - b
+		if (a >= 0 && b < 0 && r < 0) || (a < 0 && b > 0 && r >= 0) {
+			return nil, false
+		}
+		return createInt(r), true
+	case token.MULT:
+		if a == 0 || b == 0 {
+			return createInt(0), true
+		}
+		r := a * b
+		if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return nil, false
+		}
+		return createInt(r), true
+	case token.DIV:
+		if b == 0 || a%b != 0 || (a == math.MinInt64 && b == -1) {
+			return nil, false
+		}
+		return createInt(a / b), true
+	}
+	return nil, false
+}
+
+func bigArith(op token.Token, a, b *big.Int) (*Object, error) {
+	switch op {
+	case token.ADD:
+		return createBigInt(new(big.Int).Add(a, b)), nil
+	case token.SUB:
+		return createBigInt(new(big.Int).Sub(a, b)), nil
+	case token.MULT:
+		return createBigInt(new(big.Int).Mul(a, b)), nil
+	case token.DIV:
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("Divide by zero")
+		}
+		r := new(big.Rat).SetFrac(a, b)
+		if r.IsInt() {
+			return createBigInt(new(big.Int).Set(r.Num())), nil
+		}
+		return createRatio(r), nil
+	}
+	return nil, fmt.Errorf("invalid op %q", token.TokenName(op))
+}
+
+func ratArith(op token.Token, a, b *big.Rat) (*Object, error) {
+	switch op {
+	case token.ADD:
+		return createRatio(new(big.Rat).Add(a, b)), nil
+	case token.SUB:
+		return createRatio(new(big.Rat).Sub(a, b)), nil
+	case token.MULT:
+		return createRatio(new(big.Rat).Mul(a, b)), nil
+	case token.DIV:
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("Divide by zero")
+		}
+		return createRatio(new(big.Rat).Quo(a, b)), nil
+	}
+	return nil, fmt.Errorf("invalid op %q", token.TokenName(op))
+}
+
+// compareNums returns -1, 0 or +1 depending on whether x is less than, equal to or greater than y.
+func compareNums(x, y *Object) int {
+	rank := numRank(x.Kind)
+	if r := numRank(y.Kind); r > rank {
+		rank = r
+	}
+	switch rank {
+	case 0:
+		a, b := x.Value.(int64), y.Value.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case 1:
+		return toBigInt(x).Cmp(toBigInt(y))
+	case 2:
+		return toRat(x).Cmp(toRat(y))
+	}
+	if x.Kind != y.Kind {
+		// A double is compared with the other kinds of numbers by its exact value, not by rounding
+		// them to doubles, so that the comparisons agree with =.
+		if a, ok := exactRat(x); ok {
+			if b, ok := exactRat(y); ok {
+				return a.Cmp(b)
+			}
+		}
+	}
+	a, b := toFloat(x), toFloat(y)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// exactRat returns the exact value of a number, false for the infinities and NaN which have none.
+func exactRat(obj *Object) (*big.Rat, bool) {
+	if obj.Kind != Double {
+		return toRat(obj), true
+	}
+	f := obj.Value.(float64)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false
+	}
+	return new(big.Rat).SetFloat64(f), true
+}
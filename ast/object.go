@@ -1,8 +1,17 @@
 package ast
 
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
 type Object struct {
 	Kind  ObjKind
 	Value interface{}
+	// Meta is the metadata of the definition which bound the object, nil for the other objects.
+	Meta *Meta
 }
 
 var NilObj = &Object{Kind: Nil, Value: nil}
@@ -13,9 +22,19 @@ type ObjKind int
 const (
 	Bad ObjKind = iota
 	Double
+	Int
+	BigInt
+	Ratio
 	Func
+	Builtin
 	Boolean
 	List
+	Vector
+	Map
+	Set
+	String
+	Sequence
+	LazySeq
 	Nil
 	Self
 )
@@ -26,12 +45,32 @@ func (o ObjKind) String() string {
 		return "Bad"
 	case Double:
 		return "Double"
+	case Int:
+		return "Int"
+	case BigInt:
+		return "BigInt"
+	case Ratio:
+		return "Ratio"
 	case Func:
 		return "Function"
+	case Builtin:
+		return "Builtin"
 	case Boolean:
 		return "Boolean"
 	case List:
 		return "List"
+	case Vector:
+		return "Vector"
+	case Map:
+		return "Map"
+	case Set:
+		return "Set"
+	case String:
+		return "String"
+	case Sequence:
+		return "Sequence"
+	case LazySeq:
+		return "LazySeq"
 	case Nil:
 		return "Nil"
 	case Self:
@@ -44,6 +83,25 @@ func createDouble(v float64) *Object {
 	return &Object{Kind: Double, Value: v}
 }
 
+func createInt(v int64) *Object {
+	return &Object{Kind: Int, Value: v}
+}
+
+func createBigInt(v *big.Int) *Object {
+	return &Object{Kind: BigInt, Value: v}
+}
+
+// createRatio creates a ratio object, a ratio with denominator 1 is normalized to an integer.
+func createRatio(v *big.Rat) *Object {
+	if v.IsInt() {
+		if n := v.Num(); n.IsInt64() {
+			return createInt(n.Int64())
+		}
+		return createBigInt(new(big.Int).Set(v.Num()))
+	}
+	return &Object{Kind: Ratio, Value: v}
+}
+
 func createBoolean(b bool) *Object {
 	return &Object{Kind: Boolean, Value: b}
 }
@@ -52,12 +110,221 @@ func createList(list []*Object) *Object {
 	return &Object{Kind: List, Value: list}
 }
 
+func createVector(list []*Object) *Object {
+	return &Object{Kind: Vector, Value: list}
+}
+
+func createString(s string) *Object {
+	return &Object{Kind: String, Value: s}
+}
+
+// NewStringList creates a list object of strings.
+func NewStringList(strs []string) *Object {
+	list := make([]*Object, len(strs))
+	for i, s := range strs {
+		list[i] = createString(s)
+	}
+	return createList(list)
+}
+
 func createFunc(sc *Scope, params []string, body Expr) *Object {
 	return &Object{Kind: Func, Value: &FuncValue{Closure: sc, Params: params, Body: body}}
 }
 
+// Apply calls a function or builtin object with the given arguments. The call counts as a step of
+// the evaluation the function belongs to and checks its limits.
+func Apply(fn *Object, args []*Object) (*Object, error) {
+	switch fn.Kind {
+	case Builtin:
+		builtin := fn.Value.(*BuiltinFunc)
+		if err := builtin.state.enter(); err != nil {
+			return nil, err
+		}
+		defer builtin.state.leave()
+		res, err := builtin.Fn(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := builtin.state.allocResult(res, args); err != nil {
+			return nil, err
+		}
+		return res, nil
+	case Func:
+		funObj := fn.Value.(*FuncValue)
+		if len(funObj.Params) != len(args) {
+			return nil, fmt.Errorf("Wrong number of arguments(%d), expect %d", len(args), len(funObj.Params))
+		}
+		st := funObj.Closure.state
+		if err := st.enter(); err != nil {
+			return nil, err
+		}
+		defer st.leave()
+		// The scope of the arguments is released when the call returns.
+		size := scopeSizeOf(len(args))
+		if err := st.alloc(size); err != nil {
+			return nil, err
+		}
+		defer st.free(size)
+		// Binding arguments in a new scope on top of function's closure, so recursive calls don't
+		// overwrite each other's arguments.
+		if err := checkArgHints(funObj, args); err != nil {
+			return nil, err
+		}
+		sc := NewScope(funObj.Closure)
+		for idx, param := range funObj.Params {
+			sc.Insert(param, args[idx])
+		}
+		if err := checkConditions("pre-condition", funObj, funObj.Pre, funObj.PreSource, sc); err != nil {
+			return nil, err
+		}
+		res, err := funObj.Body.Eval(sc)
+		if err != nil {
+			return nil, err
+		}
+		if funObj.Post != nil {
+			postScope := NewScope(sc)
+			postScope.Insert("%", res)
+			if err := checkConditions("post-condition", funObj, funObj.Post, funObj.PostSource, postScope); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkResultHint(funObj, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("The object is not a function object.")
+}
+
+// truthy reports whether obj counts as true in a condition, everything but nil and false does.
+func truthy(obj *Object) bool {
+	if obj.Kind == Boolean {
+		return obj.Value.(bool)
+	}
+	return obj.Kind != Nil
+}
+
 type FuncValue struct {
+	Name    string // Empty for anonymous functions.
 	Closure *Scope
 	Params  []string
 	Body    Expr
+	// ParamTags and ResultTag are the type hints checked when the function is called, see
+	// FuncExpr.
+	ParamTags []string
+	ResultTag string
+	// Pre and Post are the conditions checked before and after a call, with their texts in
+	// PreSource and PostSource, see FuncExpr.
+	Pre, Post             *ExprList
+	PreSource, PostSource []string
+}
+
+// BuiltinFunc is a function implemented in Go.
+type BuiltinFunc struct {
+	Name string
+	Fn   func(args []*Object) (*Object, error)
+	// state is the evaluation of the global scope defining the builtin.
+	state *evalState
+}
+
+func createBuiltin(st *evalState, name string, fn func(args []*Object) (*Object, error)) *Object {
+	return &Object{Kind: Builtin, Value: &BuiltinFunc{Name: name, Fn: fn, state: st}}
+}
+
+// MaxPrintLength is the number of elements of a collection printed by String, the ones after are
+// elided as ... so that printing an infinite sequence ends. Zero means no limit.
+var MaxPrintLength = 1000
+
+// String returns the object in Lisp syntax, e.g. strings are quoted. Numbers, strings, booleans,
+// nil and vectors of them read back as an equal object. Other objects don't: lists and sequences
+// print as (1 2), maps as {1 2, 3 4} and sets as #{1 2}, which have no literals, infinite and NaN
+// doubles as +Inf, -Inf and NaN, and functions as #<fn name>.
+func (o *Object) String() string {
+	var b strings.Builder
+	writeObject(&b, o, true)
+	return b.String()
+}
+
+// writeObject writes obj in Lisp syntax, strings are quoted only if readable is true.
+func writeObject(b *strings.Builder, obj *Object, readable bool) {
+	switch obj.Kind {
+	case Int:
+		b.WriteString(strconv.FormatInt(obj.Value.(int64), 10))
+	case BigInt:
+		b.WriteString(obj.Value.(*big.Int).String())
+		b.WriteString("N")
+	case Ratio:
+		b.WriteString(obj.Value.(*big.Rat).String())
+	case Double:
+		s := strconv.FormatFloat(obj.Value.(float64), 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			// Keep the decimal point so it reads back as a double.
+			s += ".0"
+		}
+		b.WriteString(s)
+	case Boolean:
+		b.WriteString(strconv.FormatBool(obj.Value.(bool)))
+	case Nil:
+		b.WriteString("nil")
+	case String:
+		if readable {
+			b.WriteString(strconv.Quote(obj.Value.(string)))
+		} else {
+			b.WriteString(obj.Value.(string))
+		}
+	case List, Sequence, LazySeq:
+		writeSeq(b, obj, "(", ")", readable)
+	case Vector:
+		writeSeq(b, obj, "[", "]", readable)
+	case Set:
+		writeSeq(b, obj, "#{", "}", readable)
+	case Map:
+		m := obj.Value.(*MapValue)
+		b.WriteString("{")
+		for i, key := range m.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeObject(b, key, readable)
+			b.WriteString(" ")
+			writeObject(b, m.vals[i], readable)
+		}
+		b.WriteString("}")
+	case Func:
+		if name := obj.Value.(*FuncValue).Name; name != "" {
+			fmt.Fprintf(b, "#<fn %s>", name)
+		} else {
+			b.WriteString("#<fn>")
+		}
+	case Builtin:
+		fmt.Fprintf(b, "#<fn %s>", obj.Value.(*BuiltinFunc).Name)
+	default:
+		fmt.Fprintf(b, "#<%s>", obj.Kind)
+	}
+}
+
+func writeSeq(b *strings.Builder, obj *Object, open, close string, readable bool) {
+	b.WriteString(open)
+	var seq Seq
+	var err error
+	if obj.Kind == Set {
+		seq = sliceSeqOf(obj.Value.(*SetValue).items)
+	} else {
+		seq, err = SeqOf(obj)
+	}
+	for i := 0; err == nil && seq != nil; i++ {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		if MaxPrintLength > 0 && i == MaxPrintLength {
+			b.WriteString("...")
+			break
+		}
+		writeObject(b, seq.First(), readable)
+		seq, err = seq.Next()
+	}
+	if err != nil {
+		fmt.Fprintf(b, "#<error %v>", err)
+	}
+	b.WriteString(close)
 }
@@ -0,0 +1,59 @@
+package ast_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+)
+
+func TestObjectString(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	evalString(t, sc, "(defn inc [n] (+ n 1))")
+	tests := []struct {
+		src, str string
+	}{
+		{"5050", "5050"},
+		{"(+ 1 0.5)", "1.5"},
+		{"(* 2.0 3)", "6.0"},
+		{"3/4", "3/4"},
+		{"123N", "123N"},
+		{"\"a\\\"b\"", "\"a\\\"b\""},
+		{"true", "true"},
+		{"nil", "nil"},
+		{"(list 1 \"a\" [2 3])", "(1 \"a\" [2 3])"},
+		{"(map inc [1 2])", "(2 3)"},
+		{"(hash-map 1 2 3 4)", "{1 2, 3 4}"},
+		{"(hash-set 1 2)", "#{1 2}"},
+		{"inc", "#<fn inc>"},
+		{"(fn [x] x)", "#<fn>"},
+		{"+", "#<fn +>"},
+	}
+	for _, test := range tests {
+		if str := evalString(t, sc, test.src).String(); str != test.str {
+			t.Errorf("%s: got %s, expect %s", test.src, str, test.str)
+		}
+	}
+
+	// Long collections are elided.
+	defer func(n int) { ast.MaxPrintLength = n }(ast.MaxPrintLength)
+	ast.MaxPrintLength = 3
+	for src, str := range map[string]string{"(range)": "(0 1 2 ...)", "[1 2 3]": "[1 2 3]", "(map inc (iterate inc 0))": "(1 2 3 ...)"} {
+		if got := evalString(t, sc, src).String(); got != str {
+			t.Errorf("%s: got %s, expect %s", src, got, str)
+		}
+	}
+}
+
+func TestPrinting(t *testing.T) {
+	var buf bytes.Buffer
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Stdout: &buf})
+	evalString(t, sc, "(do (print \"a\" 1) (println [\"b\"]) (pr \"c\") (prn \"d\" 2) (printf \"%d-%s-%v\" 3 \"e\" [4]))")
+	expect := "a 1[b]\n\"c\"\"d\" 2\n3-e-[4]"
+	if buf.String() != expect {
+		t.Errorf("got %q, expect %q", buf.String(), expect)
+	}
+	if obj := evalString(t, sc, "(pr-str \"x\" 1)"); obj.Value.(string) != "\"x\" 1" {
+		t.Errorf("pr-str: got %v", obj)
+	}
+}
@@ -0,0 +1,71 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// outputBuiltins returns the printing functions writing to w. print and println write objects
+// for humans, pr, prn and pr-str write them in readable form.
+func outputBuiltins(w io.Writer) map[string]func(args []*Object) (*Object, error) {
+	write := func(s string) (*Object, error) {
+		if _, err := io.WriteString(w, s); err != nil {
+			return nil, err
+		}
+		return NilObj, nil
+	}
+	return map[string]func(args []*Object) (*Object, error){
+		"print": func(args []*Object) (*Object, error) {
+			return write(joinObjects(args, false))
+		},
+		"println": func(args []*Object) (*Object, error) {
+			return write(joinObjects(args, false) + "\n")
+		},
+		"pr": func(args []*Object) (*Object, error) {
+			return write(joinObjects(args, true))
+		},
+		"prn": func(args []*Object) (*Object, error) {
+			return write(joinObjects(args, true) + "\n")
+		},
+		"pr-str": func(args []*Object) (*Object, error) {
+			return createString(joinObjects(args, true)), nil
+		},
+		"printf": func(args []*Object) (*Object, error) {
+			if err := checkArity("printf", args, 1, -1); err != nil {
+				return nil, err
+			}
+			if args[0].Kind != String {
+				return nil, fmt.Errorf("printf expects a format string, got %s", args[0].Kind)
+			}
+			return write(fmt.Sprintf(args[0].Value.(string), goValues(args[1:])...))
+		},
+	}
+}
+
+// joinObjects writes the objects separated by spaces.
+func joinObjects(objects []*Object, readable bool) string {
+	var b strings.Builder
+	for i, obj := range objects {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		writeObject(&b, obj, readable)
+	}
+	return b.String()
+}
+
+// goValues converts objects to Go values for formatting with the fmt package. Objects without a
+// natural Go value are formatted as themselves.
+func goValues(objects []*Object) []interface{} {
+	values := make([]interface{}, len(objects))
+	for i, obj := range objects {
+		switch obj.Kind {
+		case Int, BigInt, Ratio, Double, Boolean, String:
+			values[i] = obj.Value
+		default:
+			values[i] = obj
+		}
+	}
+	return values
+}
@@ -1,27 +1,112 @@
 package ast
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
 	"reflect"
+	"strings"
 
 	"github.com/easonliao/gofp/token"
 )
 
+// PrintMode selects the output format of Fprint.
+type PrintMode int
+
+const (
+	// TreeMode prints the node structs with their fields as a tree with dotted indentation.
+	TreeMode PrintMode = iota
+	// SExprMode prints the source code of the nodes, which parses back into the same tree.
+	SExprMode
+)
+
+// DefaultPrintWidth is the line width of SExprMode when no width is given.
+const DefaultPrintWidth = 80
+
+// PrintOptions controls the output of Fprint.
+type PrintOptions struct {
+	Mode PrintMode
+	// Positions prefixes each line with the position of the node starting on it.
+	Positions bool
+	// MaxDepth elides the nodes nested deeper than MaxDepth, 0 means no limit.
+	MaxDepth int
+	// Width is the line width of SExprMode, forms which don't fit are split over several lines.
+	Width int
+}
+
+// Print prints the tree of root to stdout.
 func Print(root Expr) {
-	var p printer
-	p.print(reflect.ValueOf(root))
+	Fprint(os.Stdout, root, nil)
+}
+
+// Fprint prints node to w in the format given by opts, the tree format is used if opts is nil.
+func Fprint(w io.Writer, node Expr, opts *PrintOptions) error {
+	p := &printer{w: w}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.Width <= 0 {
+		p.opts.Width = DefaultPrintWidth
+	}
+	switch p.opts.Mode {
+	case SExprMode:
+		p.printSExpr(toSExpr(node, 1, p.opts.MaxDepth))
+		p.printf("\n")
+	default:
+		p.print(reflect.ValueOf(node))
+	}
+	return p.err
 }
 
 type printer struct {
+	w      io.Writer
+	opts   PrintOptions
 	indent int
+	depth  int
+	// line is the current line, written out with its position when it's complete.
+	line bytes.Buffer
+	pos  token.Position
+	err  error
 }
 
+var (
+	exprType     = reflect.TypeOf((*Expr)(nil)).Elem()
+	positionType = reflect.TypeOf(token.Position{})
+)
+
 func (p *printer) print(x reflect.Value) {
-	//fmt.Println("[", x.Kind(), "]")
+	if !x.IsValid() {
+		p.printf("nil\n")
+		return
+	}
+	if x.CanInterface() {
+		// Arbitrary precision numbers are printed as values instead of their internal structure.
+		switch v := x.Interface().(type) {
+		case *big.Int, *big.Rat:
+			p.printf("%s", v)
+			p.printf("\n")
+			return
+		}
+	}
 	switch x.Kind() {
 	case reflect.Interface:
 		p.print(x.Elem())
 	case reflect.Ptr:
+		if x.IsNil() {
+			p.printf("nil\n")
+			return
+		}
+		if x.Type().Implements(exprType) {
+			p.markPos(x.Interface().(Expr).Pos())
+			p.depth++
+			defer func() { p.depth-- }()
+			if p.opts.MaxDepth > 0 && p.depth > p.opts.MaxDepth {
+				p.printf("%s {...}\n", x.Elem().Type())
+				return
+			}
+		}
 		p.print(x.Elem())
 	case reflect.Struct:
 		t := x.Type()
@@ -29,8 +114,10 @@ func (p *printer) print(x reflect.Value) {
 		p.printf("\n")
 		p.indent++
 		for i, n := 0, t.NumField(); i < n; i++ {
-			// exclude non-exported fields because their
-			// values cannot be accessed via reflection
+			// Positions are shown in a column of their own if asked for.
+			if t.Field(i).Type == positionType {
+				continue
+			}
 			name := t.Field(i).Name
 			value := x.Field(i)
 			p.printfWithIndent("%s: ", name)
@@ -53,34 +140,297 @@ func (p *printer) print(x reflect.Value) {
 		p.printfWithIndent("}")
 		p.printf("\n")
 	default:
-		v := x.Interface()
-		switch v := v.(type) {
+		switch v := x.Interface().(type) {
 		case string:
 			p.printf("%q", v)
-			p.printf("\n")
-			return
 		case float64, float32:
 			p.printf("%f", v)
-			p.printf("\n")
-			return
+		case ObjKind:
+			p.printf("%s", v)
 		case token.Token:
 			p.printf("%q", token.TokenName(v))
-			p.printf("\n")
-			return
-		case bool:
-			p.printf("%t", v)
-			p.printf("\n")
+		default:
+			p.printf("%v", v)
 		}
+		p.printf("\n")
+	}
+}
+
+// markPos records the position of a node starting on the current line.
+func (p *printer) markPos(pos token.Position) {
+	if !p.pos.IsValid() {
+		p.pos = pos
 	}
 }
 
+// printf formats to the current line, complete lines are written out.
 func (p *printer) printf(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
+	s := fmt.Sprintf(format, args...)
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			p.line.WriteString(s)
+			return
+		}
+		p.line.WriteString(s[:i])
+		p.flush()
+		s = s[i+1:]
+	}
 }
 
 func (p *printer) printfWithIndent(format string, args ...interface{}) {
 	for i := 0; i < p.indent; i++ {
-		fmt.Print(".  ")
+		p.line.WriteString(".  ")
 	}
 	p.printf(format, args...)
 }
+
+// flush writes out the current line, preceded by the position column if enabled.
+func (p *printer) flush() {
+	if p.opts.Positions {
+		pos := ""
+		if p.pos.IsValid() {
+			pos = p.pos.String()
+		}
+		p.write(fmt.Sprintf("%-8s", pos))
+	}
+	p.line.WriteByte('\n')
+	p.write(p.line.String())
+	p.line.Reset()
+	p.pos = token.Position{}
+}
+
+func (p *printer) write(s string) {
+	if p.err == nil {
+		_, p.err = io.WriteString(p.w, s)
+	}
+}
+
+// sexpr is the layout of a node printed as an S-expression.
+type sexpr struct {
+	pos token.Position
+	// text is the text of an atom, or the opening bracket of a list.
+	text  string
+	list  bool
+	items []*sexpr
+	close string
+	// inline is the number of items kept on the first line when the list is split.
+	inline int
+}
+
+func atom(pos token.Position, text string) *sexpr {
+	return &sexpr{pos: pos, text: text}
+}
+
+// form creates the layout of a parenthesized special form or call.
+func form(pos token.Position, inline int, items ...*sexpr) *sexpr {
+	return &sexpr{pos: pos, text: "(", list: true, items: items, close: ")", inline: inline}
+}
+
+func toSExpr(node Expr, depth, maxDepth int) *sexpr {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return atom(token.Position{}, "nil")
+	}
+	pos := node.Pos()
+	if maxDepth > 0 && depth > maxDepth {
+		return atom(pos, "...")
+	}
+	sub := func(node Expr) *sexpr {
+		return toSExpr(node, depth+1, maxDepth)
+	}
+	list := func(l *ExprList) []*sexpr {
+		if l == nil {
+			return nil
+		}
+		items := make([]*sexpr, len(l.Exprs))
+		for i, expr := range l.Exprs {
+			items[i] = sub(expr)
+		}
+		return items
+	}
+	// fnItems returns the parameter vector of a function followed by the type hint of its result.
+	fnItems := func(fn *FuncExpr) []*sexpr {
+		items := make([]*sexpr, len(fn.Params))
+		for i, param := range fn.Params {
+			items[i] = sub(param)
+			if i < len(fn.ParamTags) && fn.ParamTags[i] != "" {
+				items[i].text = "^" + fn.ParamTags[i] + " " + items[i].text
+			}
+		}
+		res := []*sexpr{{pos: fn.Pos(), text: "[", list: true, items: items, close: "]"}}
+		if fn.ResultTag != "" {
+			res = append(res, atom(fn.Pos(), "^"+fn.ResultTag))
+		}
+		if fn.Pre != nil || fn.Post != nil {
+			conds := &sexpr{pos: fn.Pos(), text: "{", list: true, close: "}"}
+			if fn.Pre != nil {
+				conds.items = append(conds.items, atom(fn.Pre.Pos(), ":pre"), &sexpr{pos: fn.Pre.Pos(), text: "[", list: true, items: list(fn.Pre), close: "]"})
+			}
+			if fn.Post != nil {
+				conds.items = append(conds.items, atom(fn.Post.Pos(), ":post"), &sexpr{pos: fn.Post.Pos(), text: "[", list: true, items: list(fn.Post), close: "]"})
+			}
+			res = append(res, conds)
+		}
+		return res
+	}
+	// defItems returns the keyword of a definition followed by its metadata map, name and docstring.
+	defItems := func(keyword string, meta []*MetaEntry, ident *IdentExpr, doc string) []*sexpr {
+		items := []*sexpr{atom(pos, keyword)}
+		if meta != nil {
+			m := &sexpr{pos: pos, text: "^{", list: true, close: "}"}
+			for _, entry := range meta {
+				m.items = append(m.items, atom(entry.Position, entry.Key), sub(entry.Value))
+			}
+			items = append(items, m)
+		}
+		items = append(items, sub(ident))
+		if doc != "" {
+			items = append(items, atom(pos, createString(doc).String()))
+		}
+		return items
+	}
+	switch n := node.(type) {
+	case *NilExpr:
+		return atom(pos, "nil")
+	case *IdentExpr:
+		return atom(pos, n.Name)
+	case *NumExpr:
+		return atom(pos, (&Object{Kind: n.Kind, Value: n.Value}).String())
+	case *BooleanExpr:
+		return atom(pos, fmt.Sprint(n.Bool))
+	case *StringExpr:
+		return atom(pos, createString(n.Value).String())
+	case *VectorExpr:
+		return &sexpr{pos: pos, text: "[", list: true, items: list(n.Exprs), close: "]"}
+	case *DefExpr:
+		items := defItems("def", n.Meta, n.Ident, n.Doc)
+		return form(pos, len(items), append(items, sub(n.Expr))...)
+	case *DefnExpr:
+		keyword := "defn"
+		if n.Private {
+			keyword = "defn-"
+		}
+		if fn, ok := n.Expr.(*FuncExpr); ok {
+			items := defItems(keyword, n.Meta, n.Ident, n.Doc)
+			// A docstring goes on a line of its own, followed by the parameters.
+			inline := len(items) - 1
+			items = append(items, fnItems(fn)...)
+			if n.Doc == "" {
+				inline = len(items)
+			}
+			return form(pos, inline, append(items, sub(fn.Expr))...)
+		}
+		items := defItems("def", n.Meta, n.Ident, n.Doc)
+		return form(pos, len(items), append(items, sub(n.Expr))...)
+	case *FuncExpr:
+		items := append([]*sexpr{atom(pos, "fn")}, fnItems(n)...)
+		return form(pos, len(items), append(items, sub(n.Expr))...)
+	case *ExprList:
+		return &sexpr{pos: pos, list: true, items: list(n)}
+	case *CallExpr:
+		return form(pos, 2, append([]*sexpr{sub(n.Fun)}, list(n.Args)...)...)
+	case *DoExpr:
+		return form(pos, 1, append([]*sexpr{atom(pos, "do")}, list(n.Exprs)...)...)
+	case *IfExpr:
+		items := []*sexpr{atom(pos, "if"), sub(n.Cond), sub(n.Then)}
+		if n.Else != nil {
+			items = append(items, sub(n.Else))
+		}
+		return form(pos, 2, items...)
+	case *BinaryOp:
+		return form(pos, 2, atom(pos, token.TokenName(n.Op)), sub(n.Left), sub(n.Right))
+	case *MultiOp:
+		return form(pos, 2, append([]*sexpr{atom(pos, token.TokenName(n.Op))}, list(n.Exprs)...)...)
+	case *BindExpr:
+		return &sexpr{pos: pos, list: true, items: []*sexpr{sub(n.Ident), sub(n.Value)}, inline: 2}
+	case *LetExpr:
+		bindings := &sexpr{pos: pos, text: "[", list: true, close: "]"}
+		for _, binding := range n.Bindings {
+			bindings.items = append(bindings.items, sub(binding.Ident), sub(binding.Value))
+		}
+		return form(pos, 2, atom(pos, "let"), bindings, sub(n.Body))
+	case *LazySeqExpr:
+		return form(pos, 1, atom(pos, "lazy-seq"), sub(n.Body))
+	case *AssertExpr:
+		items := []*sexpr{atom(pos, "assert"), sub(n.Cond)}
+		if n.Msg != nil {
+			items = append(items, sub(n.Msg))
+		}
+		return form(pos, 2, items...)
+	case *NsExpr:
+		items := []*sexpr{atom(pos, "ns"), sub(n.Name)}
+		if n.Doc != "" {
+			items = append(items, atom(pos, createString(n.Doc).String()))
+		}
+		return form(pos, 2, items...)
+	case *RequireExpr:
+		items := []*sexpr{atom(pos, "require")}
+		for _, spec := range n.Specs {
+			item := sub(spec)
+			item.text = "'" + item.text
+			items = append(items, item)
+		}
+		return form(pos, 2, items...)
+	case *RequireSpec:
+		if n.Alias == nil && n.Refer == nil && !n.ReferAll {
+			return sub(n.Module)
+		}
+		items := []*sexpr{sub(n.Module)}
+		if n.Alias != nil {
+			items = append(items, atom(pos, ":as"), sub(n.Alias))
+		}
+		if n.ReferAll {
+			items = append(items, atom(pos, ":refer"), atom(pos, ":all"))
+		} else if n.Refer != nil {
+			refer := &sexpr{pos: pos, text: "[", list: true, close: "]"}
+			for _, ident := range n.Refer {
+				refer.items = append(refer.items, sub(ident))
+			}
+			items = append(items, atom(pos, ":refer"), refer)
+		}
+		return &sexpr{pos: pos, text: "[", list: true, items: items, close: "]"}
+	}
+	return atom(pos, fmt.Sprintf("#<%T>", node))
+}
+
+// flat returns s printed on a single line.
+func (s *sexpr) flat() string {
+	if !s.list {
+		return s.text
+	}
+	items := make([]string, len(s.items))
+	for i, item := range s.items {
+		items[i] = item.flat()
+	}
+	return s.text + strings.Join(items, " ") + s.close
+}
+
+// printSExpr prints s on the current line if it fits, otherwise the items of lists following the
+// inline ones go on lines of their own, indented by two columns in parentheses and aligned in
+// brackets.
+func (p *printer) printSExpr(s *sexpr) {
+	col := p.line.Len()
+	if col == 0 {
+		p.markPos(s.pos)
+	}
+	if flat := s.flat(); !s.list || col+len(flat) <= p.opts.Width {
+		p.line.WriteString(flat)
+		return
+	}
+	indent := col + len(s.text)
+	if s.text == "(" {
+		indent++
+	}
+	p.line.WriteString(s.text)
+	for i, item := range s.items {
+		if i > 0 && i < s.inline {
+			p.line.WriteString(" ")
+		} else if i > 0 {
+			p.flush()
+			p.line.WriteString(strings.Repeat(" ", indent))
+			p.markPos(item.pos)
+		}
+		p.printSExpr(item)
+	}
+	p.line.WriteString(s.close)
+}
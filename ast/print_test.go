@@ -0,0 +1,76 @@
+package ast_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestFprintSExpr(t *testing.T) {
+	srcs := []string{
+		"(defn f [x] (let [a 1 b 2] (if (< a b) (map (fn [y] (+ y x 1/2 2.0 10000000000000000000000N)) [a b \"s\\n\"]) (do (println a) (lazy-seq nil)))))",
+		"(def x [true false nil -1])",
+		"((fn [] 1))",
+		"(defn area [^Double w h] ^Double {:pre [(> w 0) (> h 0)] :post [(>= % 0)]} (* w h))",
+		"(assert (= 1 1) \"msg\")",
+		"(ns my.app)",
+		"(require '[my.lib :as lib :refer [f g]] '[other :refer :all] 'm)",
+		"(defn- helper [x] (lib/f x))",
+		"(ns my.app \"The app.\")",
+		"(defn ^{:deprecated \"use g\" :added 2} area \"Computes the\n area.\" [w h] (* w h))",
+		"(def ^{:private true} answer \"The answer.\" 42)",
+	}
+	for _, src := range srcs {
+		expr, err := parser.ParseExpr([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := ast.Fprint(&b, expr, &ast.PrintOptions{Mode: ast.SExprMode, Width: 40}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(b.String(), "\n") < 2 && len(src) > 40 {
+			t.Errorf("expect %q to be split over lines, got\n%s", src, b.String())
+		}
+		again, err := parser.ParseExpr(b.Bytes())
+		if err != nil {
+			t.Fatalf("parse %q: %v", b.String(), err)
+		}
+		// Compare the trees without the positions.
+		var x, y bytes.Buffer
+		ast.Fprint(&x, expr, nil)
+		ast.Fprint(&y, again, nil)
+		if x.String() != y.String() {
+			t.Errorf("%q doesn't round-trip, printed as\n%s", src, b.String())
+		}
+	}
+}
+
+func TestFprintTree(t *testing.T) {
+	expr, err := parser.ParseExpr([]byte("(do\n  (+ 1 (* 2 3)))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	ast.Fprint(&b, expr, &ast.PrintOptions{Positions: true, MaxDepth: 3})
+	lines := strings.Split(b.String(), "\n")
+	for _, expect := range []string{"1:1     ast.DoExpr {", "2:3     .  .  .  0: ast.MultiOp {", "2:6     .  .  .  .  Exprs: ast.ExprList {...}"} {
+		found := false
+		for _, line := range lines {
+			found = found || line == expect
+		}
+		if !found {
+			t.Errorf("expect line %q in\n%s", expect, b.String())
+		}
+	}
+
+	// Nil children are printed instead of being dropped.
+	b.Reset()
+	ast.Fprint(&b, &ast.IfExpr{Cond: &ast.BooleanExpr{Bool: true}, Then: &ast.NilExpr{}}, nil)
+	if !strings.Contains(b.String(), "Else: nil\n") {
+		t.Errorf("expect nil else branch, got\n%s", b.String())
+	}
+}
@@ -3,10 +3,18 @@ package ast
 type Scope struct {
 	Outer   *Scope
 	Objects map[string]*Object
+	// state is shared with the outer scope, see EvalContext.
+	state *evalState
+	// ns is the namespace of the program or module the scope belongs to, see RequireExpr.
+	ns *namespace
 }
 
 func NewScope(outer *Scope) *Scope {
-	return &Scope{Outer: outer, Objects: make(map[string]*Object)}
+	sc := &Scope{Outer: outer, Objects: make(map[string]*Object)}
+	if outer != nil {
+		sc.state, sc.ns = outer.state, outer.ns
+	}
+	return sc
 }
 
 func (s *Scope) Lookup(name string) *Object {
@@ -17,6 +25,9 @@ func (s *Scope) Lookup(name string) *Object {
 		}
 		scope = scope.Outer
 	}
+	if alias, name, ok := splitQualified(name); ok && s.ns != nil {
+		return s.ns.lookupQualified(alias, name)
+	}
 	return nil
 }
 
@@ -0,0 +1,182 @@
+package ast
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/easonliao/gofp/token"
+)
+
+// Seq is an immutable, non-empty sequence of objects. Absence of a sequence, i.e. the empty sequence,
+// is represented by a nil Seq.
+type Seq interface {
+	// First returns the first element of the sequence.
+	First() *Object
+	// Next returns the elements after the first one, or nil if there are none.
+	Next() (Seq, error)
+}
+
+// SeqOf returns the sequence of elements in a collection object, or nil if the collection is empty.
+func SeqOf(obj *Object) (Seq, error) {
+	switch obj.Kind {
+	case Nil:
+		return nil, nil
+	case List, Vector:
+		return sliceSeqOf(obj.Value.([]*Object)), nil
+	case Map:
+		m := obj.Value.(*MapValue)
+		entries := make([]*Object, 0, len(m.keys))
+		for i, key := range m.keys {
+			entries = append(entries, createVector([]*Object{key, m.vals[i]}))
+		}
+		return sliceSeqOf(entries), nil
+	case Set:
+		return sliceSeqOf(obj.Value.(*SetValue).items), nil
+	case String:
+		return stringSeqOf(obj.Value.(string)), nil
+	case Sequence:
+		return obj.Value.(Seq), nil
+	case LazySeq:
+		return obj.Value.(*LazySeqValue).Seq()
+	}
+	return nil, fmt.Errorf("Don't know how to create sequence from %s", obj.Kind)
+}
+
+// seqable reports whether SeqOf accepts the kind of obj.
+func seqable(obj *Object) bool {
+	switch obj.Kind {
+	case Nil, List, Vector, Map, Set, String, Sequence, LazySeq:
+		return true
+	}
+	return false
+}
+
+// createSeq wraps a sequence into an object, the empty sequence becomes an empty list.
+func createSeq(seq Seq) *Object {
+	if seq == nil {
+		return createList(nil)
+	}
+	return &Object{Kind: Sequence, Value: seq}
+}
+
+// seqToSlice collects all the elements of a sequence, each of them counts as a step of st and is
+// counted in the memory held.
+func seqToSlice(st *evalState, seq Seq) ([]*Object, error) {
+	var objects []*Object
+	for seq != nil {
+		if err := st.step(); err != nil {
+			return nil, err
+		}
+		var err error
+		if objects, err = st.appendHeld(objects, seq.First()); err != nil {
+			return nil, err
+		}
+		if seq, err = seq.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// sliceSeq is the sequence of elements in lists and vectors.
+type sliceSeq struct {
+	items []*Object
+}
+
+func sliceSeqOf(items []*Object) Seq {
+	if len(items) == 0 {
+		return nil
+	}
+	return &sliceSeq{items: items}
+}
+
+func (s *sliceSeq) First() *Object {
+	return s.items[0]
+}
+
+func (s *sliceSeq) Next() (Seq, error) {
+	return sliceSeqOf(s.items[1:]), nil
+}
+
+// stringSeq is the sequence of characters in a string, each character is a string of length one.
+type stringSeq struct {
+	s string
+}
+
+func stringSeqOf(s string) Seq {
+	if len(s) == 0 {
+		return nil
+	}
+	return &stringSeq{s: s}
+}
+
+func (s *stringSeq) First() *Object {
+	_, w := utf8.DecodeRuneInString(s.s)
+	return createString(s.s[:w])
+}
+
+func (s *stringSeq) Next() (Seq, error) {
+	_, w := utf8.DecodeRuneInString(s.s)
+	return stringSeqOf(s.s[w:]), nil
+}
+
+// seqRest returns the elements after the first one as an object, without realizing them if they
+// are lazy.
+func seqRest(seq Seq) (*Object, error) {
+	if cons, ok := seq.(*consSeq); ok {
+		return cons.rest, nil
+	}
+	next, err := seq.Next()
+	if err != nil {
+		return nil, err
+	}
+	return createSeq(next), nil
+}
+
+// consSeq is an element prepended to a collection, the collection is only turned into a sequence
+// when it's needed so it may be an unrealized lazy sequence.
+type consSeq struct {
+	first *Object
+	rest  *Object
+}
+
+func (s *consSeq) First() *Object {
+	return s.first
+}
+
+func (s *consSeq) Next() (Seq, error) {
+	return SeqOf(s.rest)
+}
+
+// rangeSeq is the sequence of numbers from start (inclusive) to end (exclusive) by step. The range
+// is infinite if end is nil. Walking it counts steps of st.
+type rangeSeq struct {
+	start, end, step *Object
+	state            *evalState
+}
+
+func rangeSeqOf(st *evalState, start, end, step *Object) Seq {
+	if end == nil {
+		return &rangeSeq{start: start, step: step, state: st}
+	}
+	cmp := compareNums(start, end)
+	if sign := compareNums(step, createInt(0)); sign == 0 || (sign > 0 && cmp >= 0) || (sign < 0 && cmp <= 0) {
+		return nil
+	}
+	return &rangeSeq{start: start, end: end, step: step, state: st}
+}
+
+func (s *rangeSeq) First() *Object {
+	return s.start
+}
+
+func (s *rangeSeq) Next() (Seq, error) {
+	if err := s.state.step(); err != nil {
+		return nil, err
+	}
+	start, err := arith(token.ADD, s.start, s.step)
+	if err != nil {
+		return nil, err
+	}
+	return rangeSeqOf(s.state, start, s.end, s.step), nil
+}
@@ -0,0 +1,311 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If the result visitor w
+// is not nil, Walk visits each of the children of node with the visitor w, followed by a call of
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Expr) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling v.Visit(node); node must not be
+// nil. If the visitor w returned by v.Visit(node) is not nil, Walk is invoked recursively with
+// visitor w for each of the non-nil children of node, followed by a call of w.Visit(nil).
+func Walk(v Visitor, node Expr) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *NilExpr, *IdentExpr, *NumExpr, *BooleanExpr, *StringExpr:
+		// Nothing to do.
+
+	case *VectorExpr:
+		Walk(v, n.Exprs)
+
+	case *DefExpr:
+		walkMeta(v, n.Meta)
+		Walk(v, n.Ident)
+		Walk(v, n.Expr)
+
+	case *DefnExpr:
+		walkMeta(v, n.Meta)
+		Walk(v, n.Ident)
+		Walk(v, n.Expr)
+
+	case *FuncExpr:
+		for _, param := range n.Params {
+			Walk(v, param)
+		}
+		if n.Pre != nil {
+			Walk(v, n.Pre)
+		}
+		if n.Post != nil {
+			Walk(v, n.Post)
+		}
+		Walk(v, n.Expr)
+
+	case *ExprList:
+		for _, expr := range n.Exprs {
+			Walk(v, expr)
+		}
+
+	case *CallExpr:
+		Walk(v, n.Fun)
+		Walk(v, n.Args)
+
+	case *DoExpr:
+		Walk(v, n.Exprs)
+
+	case *IfExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+
+	case *BinaryOp:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *MultiOp:
+		Walk(v, n.Exprs)
+
+	case *BindExpr:
+		Walk(v, n.Ident)
+		Walk(v, n.Value)
+
+	case *LetExpr:
+		for _, binding := range n.Bindings {
+			Walk(v, binding)
+		}
+		Walk(v, n.Body)
+
+	case *LazySeqExpr:
+		Walk(v, n.Body)
+
+	case *AssertExpr:
+		Walk(v, n.Cond)
+		if n.Msg != nil {
+			Walk(v, n.Msg)
+		}
+
+	case *NsExpr:
+		Walk(v, n.Name)
+
+	case *RequireExpr:
+		for _, spec := range n.Specs {
+			Walk(v, spec)
+		}
+
+	case *RequireSpec:
+		Walk(v, n.Module)
+		if n.Alias != nil {
+			Walk(v, n.Alias)
+		}
+		for _, ident := range n.Refer {
+			Walk(v, ident)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Expr) bool
+
+func (f inspector) Visit(node Expr) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling f(node); node must not be
+// nil. If f returns true, Inspect invokes f recursively for each of the non-nil children of node,
+// followed by a call of f(nil).
+func Inspect(node Expr, f func(Expr) bool) {
+	Walk(inspector(f), node)
+}
+
+// walkMeta visits the values of a metadata map.
+func walkMeta(v Visitor, meta []*MetaEntry) {
+	for _, entry := range meta {
+		Walk(v, entry.Value)
+	}
+}
+
+// Rewrite returns a copy of the AST in which every node has been replaced by the result of f.
+// The tree is rewritten bottom-up: f is called on a node after its children have been rewritten,
+// and the node passed to f is already a copy holding the rewritten children. The original tree
+// is left unchanged.
+//
+// Identifiers, expression lists, bindings and require specs are held in fields of their own type,
+// so f must return a node of the same type for them, otherwise Rewrite panics.
+func Rewrite(node Expr, f func(Expr) Expr) Expr {
+	if node == nil {
+		return nil
+	}
+	var res Expr
+	switch n := node.(type) {
+	case *NilExpr:
+		res = &NilExpr{Position: n.Position}
+
+	case *IdentExpr:
+		res = &IdentExpr{Position: n.Position, Name: n.Name}
+
+	case *NumExpr:
+		res = &NumExpr{Position: n.Position, Kind: n.Kind, Value: n.Value}
+
+	case *BooleanExpr:
+		res = &BooleanExpr{Position: n.Position, Bool: n.Bool}
+
+	case *StringExpr:
+		res = &StringExpr{Position: n.Position, Value: n.Value}
+
+	case *VectorExpr:
+		res = &VectorExpr{Position: n.Position, Exprs: rewriteList(n.Exprs, f)}
+
+	case *DefExpr:
+		res = &DefExpr{Position: n.Position, Ident: rewriteIdent(n.Ident, f), Expr: Rewrite(n.Expr, f), Doc: n.Doc, Meta: rewriteMeta(n.Meta, f)}
+
+	case *DefnExpr:
+		res = &DefnExpr{Position: n.Position, Ident: rewriteIdent(n.Ident, f), Expr: Rewrite(n.Expr, f), Private: n.Private, Doc: n.Doc, Meta: rewriteMeta(n.Meta, f)}
+
+	case *FuncExpr:
+		params := make([]*IdentExpr, len(n.Params))
+		for i, param := range n.Params {
+			params[i] = rewriteIdent(param, f)
+		}
+		fn := &FuncExpr{Position: n.Position, Params: params, ParamTags: n.ParamTags, ResultTag: n.ResultTag, PreSource: n.PreSource, PostSource: n.PostSource}
+		if n.Pre != nil {
+			fn.Pre = rewriteList(n.Pre, f)
+		}
+		if n.Post != nil {
+			fn.Post = rewriteList(n.Post, f)
+		}
+		fn.Expr = Rewrite(n.Expr, f)
+		res = fn
+
+	case *ExprList:
+		exprs := make([]Expr, len(n.Exprs))
+		for i, expr := range n.Exprs {
+			exprs[i] = Rewrite(expr, f)
+		}
+		res = &ExprList{Position: n.Position, Exprs: exprs}
+
+	case *CallExpr:
+		res = &CallExpr{Position: n.Position, Fun: Rewrite(n.Fun, f), Args: rewriteList(n.Args, f)}
+
+	case *DoExpr:
+		res = &DoExpr{Position: n.Position, Exprs: rewriteList(n.Exprs, f)}
+
+	case *IfExpr:
+		res = &IfExpr{Position: n.Position, Cond: Rewrite(n.Cond, f), Then: Rewrite(n.Then, f),
+			Else: Rewrite(n.Else, f)}
+
+	case *BinaryOp:
+		res = &BinaryOp{Position: n.Position, Op: n.Op, Left: Rewrite(n.Left, f), Right: Rewrite(n.Right, f)}
+
+	case *MultiOp:
+		res = &MultiOp{Position: n.Position, Op: n.Op, Exprs: rewriteList(n.Exprs, f)}
+
+	case *BindExpr:
+		res = &BindExpr{Position: n.Position, Ident: rewriteIdent(n.Ident, f), Value: Rewrite(n.Value, f)}
+
+	case *LetExpr:
+		bindings := make([]*BindExpr, len(n.Bindings))
+		for i, binding := range n.Bindings {
+			bindings[i] = rewriteBinding(binding, f)
+		}
+		res = &LetExpr{Position: n.Position, Bindings: bindings, Body: Rewrite(n.Body, f)}
+
+	case *LazySeqExpr:
+		res = &LazySeqExpr{Position: n.Position, Body: Rewrite(n.Body, f)}
+
+	case *AssertExpr:
+		res = &AssertExpr{Position: n.Position, Cond: Rewrite(n.Cond, f), Msg: Rewrite(n.Msg, f), Source: n.Source}
+
+	case *NsExpr:
+		res = &NsExpr{Position: n.Position, Name: rewriteIdent(n.Name, f), Doc: n.Doc}
+
+	case *RequireExpr:
+		specs := make([]*RequireSpec, len(n.Specs))
+		for i, spec := range n.Specs {
+			specs[i] = rewriteSpec(spec, f)
+		}
+		res = &RequireExpr{Position: n.Position, Specs: specs}
+
+	case *RequireSpec:
+		spec := &RequireSpec{Position: n.Position, Module: rewriteIdent(n.Module, f), ReferAll: n.ReferAll}
+		if n.Alias != nil {
+			spec.Alias = rewriteIdent(n.Alias, f)
+		}
+		for _, ident := range n.Refer {
+			spec.Refer = append(spec.Refer, rewriteIdent(ident, f))
+		}
+		res = spec
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return f(res)
+}
+
+func rewriteBinding(n *BindExpr, f func(Expr) Expr) *BindExpr {
+	res := Rewrite(n, f)
+	binding, ok := res.(*BindExpr)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: binding rewritten to %T", res))
+	}
+	return binding
+}
+
+func rewriteSpec(n *RequireSpec, f func(Expr) Expr) *RequireSpec {
+	res := Rewrite(n, f)
+	spec, ok := res.(*RequireSpec)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: require spec rewritten to %T", res))
+	}
+	return spec
+}
+
+// rewriteMeta rewrites the values of a metadata map.
+func rewriteMeta(meta []*MetaEntry, f func(Expr) Expr) []*MetaEntry {
+	if meta == nil {
+		return nil
+	}
+	res := make([]*MetaEntry, len(meta))
+	for i, entry := range meta {
+		res[i] = &MetaEntry{Position: entry.Position, Key: entry.Key, Value: Rewrite(entry.Value, f)}
+	}
+	return res
+}
+
+func rewriteIdent(n *IdentExpr, f func(Expr) Expr) *IdentExpr {
+	res := Rewrite(n, f)
+	ident, ok := res.(*IdentExpr)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: identifier rewritten to %T", res))
+	}
+	return ident
+}
+
+func rewriteList(n *ExprList, f func(Expr) Expr) *ExprList {
+	res := Rewrite(n, f)
+	list, ok := res.(*ExprList)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: expression list rewritten to %T", res))
+	}
+	return list
+}
+
+// FreeNames returns the names used in expr which are not bound in it, the ones a function
+// captures from the scope where it's created. They include the operators, like +, which are
+// builtins.
+func FreeNames(expr Expr) map[string]bool {
+	names := make(map[string]bool)
+	expr.collectUnresolvedNames(NewScope(nil), names)
+	return names
+}
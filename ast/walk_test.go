@@ -0,0 +1,100 @@
+package ast_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+const walkSrc = `(do
+  (def x 1)
+  (defn f [a b] (if (< a b) (+ a x) (let [c [a b]] (lazy-seq (g c nil "s" true)))))
+  ((fn [y] y) 2))`
+
+func TestInspect(t *testing.T) {
+	expr, err := parser.ParseExpr([]byte(walkSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	counts := make(map[string]int)
+	depth, maxDepth := 0, 0
+	ast.Inspect(expr, func(node ast.Expr) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		counts[reflect.TypeOf(node).Elem().Name()]++
+		if ident, ok := node.(*ast.IdentExpr); ok {
+			names = append(names, ident.Name)
+		}
+		return true
+	})
+	if depth != 0 {
+		t.Errorf("unbalanced Visit(nil) calls, depth %d", depth)
+	}
+	expect := "x f a b a b a x c a b g c y y"
+	if got := strings.Join(names, " "); got != expect {
+		t.Errorf("expect identifiers %q, got %q", expect, got)
+	}
+	for _, kind := range []string{"DoExpr", "DefExpr", "DefnExpr", "FuncExpr", "IfExpr", "BinaryOp", "MultiOp",
+		"LetExpr", "BindExpr", "VectorExpr", "LazySeqExpr", "CallExpr", "NilExpr", "StringExpr", "BooleanExpr", "NumExpr"} {
+		if counts[kind] == 0 {
+			t.Errorf("%s not visited", kind)
+		}
+	}
+
+	// Returning false prunes the children.
+	visited := 0
+	ast.Inspect(expr, func(node ast.Expr) bool {
+		if node != nil {
+			visited++
+		}
+		_, isDo := node.(*ast.DoExpr)
+		return isDo
+	})
+	if visited != 2 {
+		t.Errorf("expect 2 nodes visited, got %d", visited)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	expr, err := parser.ParseExpr([]byte("(let [a 1] (+ a 2))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Double all the numbers and rename a to b.
+	rewritten := ast.Rewrite(expr, func(node ast.Expr) ast.Expr {
+		switch n := node.(type) {
+		case *ast.NumExpr:
+			return &ast.NumExpr{Kind: ast.Int, Value: n.Value.(int64) * 2}
+		case *ast.IdentExpr:
+			if n.Name == "a" {
+				return &ast.IdentExpr{Name: "b"}
+			}
+		}
+		return node
+	})
+	for _, test := range []struct {
+		expr   ast.Expr
+		expect string
+	}{{expr, "3"}, {rewritten, "6"}} {
+		obj, err := test.expr.Eval(ast.NewGlobalScope())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.String() != test.expect {
+			t.Errorf("expect %s, got %s", test.expect, obj)
+		}
+	}
+	if name := rewritten.(*ast.LetExpr).Bindings[0].Ident.Name; name != "b" {
+		t.Errorf("expect binding renamed to b, got %s", name)
+	}
+}
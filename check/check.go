@@ -0,0 +1,439 @@
+// Package check finds mistakes in gofp programs without running them.
+//
+// The checker reports names used before they are bound, calls to functions defined with defn or
+// fn with the wrong number of arguments, calls to values which are not functions, arguments and
+// results whose type is known not to satisfy the type hints of a function, and def or defn below
+// the top level as errors. Names qualified by the alias of a required module, like lib/f, are
+// assumed to be defined by the module, and undefined names are not reported after a require with
+// :refer :all, which binds names unknown to the checker. Bindings shadowing other bindings of the
+// program, and let bindings and parameters which are never used are reported as warnings, unless
+// their name starts with an underscore.
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/token"
+)
+
+// Severity tells errors, which make the program fail when it runs, from warnings.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found in a program.
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Msg      string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+}
+
+// Options controls the checker.
+type Options struct {
+	// Globals holds the names defined before the program runs. The builtins of
+	// ast.NewGlobalScope are used if it's nil.
+	Globals *ast.Scope
+}
+
+// Check checks the top level expressions of a program and returns the problems found, sorted by
+// position.
+func Check(exprs []ast.Expr, opts *Options) []*Diagnostic {
+	globals := (*ast.Scope)(nil)
+	if opts != nil {
+		globals = opts.Globals
+	}
+	if globals == nil {
+		globals = ast.NewGlobalScope()
+	}
+	c := &checker{globals: globals, scope: newScope(nil), aliases: make(map[string]bool)}
+	for _, expr := range exprs {
+		c.check(expr, true)
+	}
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.diags[i].Pos.Offset < c.diags[j].Pos.Offset
+	})
+	return c.diags
+}
+
+// HasErrors reports whether diags contains an error.
+func HasErrors(diags []*Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+type bindingKind int
+
+const (
+	globalBinding bindingKind = iota // Bound by a def or defn of the program.
+	paramBinding
+	letBinding
+)
+
+// binding is a name bound by the program.
+type binding struct {
+	kind bindingKind
+	pos  token.Position
+	used bool
+	// arity is the number of parameters of a function, -1 if the value is not a known function.
+	arity int
+	// notFunc is set if the value is known not to be a function.
+	notFunc bool
+	// tag is the type hint of a parameter.
+	tag string
+	// params, paramTags and resultTag are the parameter names and the type hints of a function.
+	params    []string
+	paramTags []string
+	resultTag string
+}
+
+type scope struct {
+	outer *scope
+	names map[string]*binding
+	// order keeps the names in binding order to report unused ones deterministically.
+	order []string
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: make(map[string]*binding)}
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (s *scope) insert(name string, b *binding) {
+	if _, ok := s.names[name]; !ok {
+		s.order = append(s.order, name)
+	}
+	s.names[name] = b
+}
+
+type checker struct {
+	globals *ast.Scope
+	scope   *scope
+	diags   []*Diagnostic
+	// aliases holds the names and aliases of the required modules, referAll is set after a
+	// require with :refer :all.
+	aliases  map[string]bool
+	referAll bool
+}
+
+func (c *checker) report(pos token.Position, severity Severity, format string, args ...interface{}) {
+	c.diags = append(c.diags, &Diagnostic{Pos: pos, Severity: severity, Msg: fmt.Sprintf(format, args...)})
+}
+
+// check checks expr, top is set for the expressions at the top level of the program or of a top
+// level do.
+func (c *checker) check(expr ast.Expr, top bool) {
+	switch n := expr.(type) {
+	case nil, *ast.NilExpr, *ast.NumExpr, *ast.BooleanExpr, *ast.StringExpr:
+		// Nothing to check.
+
+	case *ast.IdentExpr:
+		if b := c.scope.lookup(n.Name); b != nil {
+			b.used = true
+		} else if c.globals.Lookup(n.Name) == nil && !c.referAll && !c.aliases[alias(n.Name)] {
+			c.report(n.Pos(), Error, "%q is not defined", n.Name)
+		}
+
+	case *ast.VectorExpr:
+		c.checkList(n.Exprs)
+
+	case *ast.DefExpr:
+		if !top {
+			c.report(n.Pos(), Error, "def of %q is not at the top level", n.Ident.Name)
+		}
+		c.checkMeta(n.Meta)
+		c.check(n.Expr, false)
+		c.bind(n.Ident, globalBinding, valueBinding(c.scope, n.Expr))
+
+	case *ast.DefnExpr:
+		if !top {
+			c.report(n.Pos(), Error, "defn of %q is not at the top level", n.Ident.Name)
+		}
+		c.checkMeta(n.Meta)
+		// Bound before the body is checked since the function can call itself.
+		c.bind(n.Ident, globalBinding, valueBinding(c.scope, n.Expr))
+		c.check(n.Expr, false)
+
+	case *ast.FuncExpr:
+		c.push()
+		for i, param := range n.Params {
+			info := binding{arity: -1}
+			if i < len(n.ParamTags) {
+				info.tag = n.ParamTags[i]
+			}
+			c.bind(param, paramBinding, info)
+		}
+		c.checkList(n.Pre)
+		c.check(n.Expr, false)
+		if n.Post != nil {
+			c.push()
+			c.scope.insert("%", &binding{kind: paramBinding, arity: -1, tag: n.ResultTag, used: true})
+			c.checkList(n.Post)
+			c.scope = c.scope.outer
+		}
+		if n.ResultTag != "" {
+			if kinds, desc := c.knownKinds(n.Expr); !acceptsAny(n.ResultTag, kinds) {
+				c.report(n.Expr.Pos(), Error, "result must be %s, got %s", n.ResultTag, desc)
+			}
+		}
+		c.pop("parameter")
+
+	case *ast.ExprList:
+		c.checkList(n)
+
+	case *ast.CallExpr:
+		c.check(n.Fun, false)
+		c.checkList(n.Args)
+		c.checkCall(n)
+
+	case *ast.DoExpr:
+		if n.Exprs != nil {
+			for _, e := range n.Exprs.Exprs {
+				c.check(e, top)
+			}
+		}
+
+	case *ast.IfExpr:
+		c.check(n.Cond, false)
+		c.check(n.Then, false)
+		c.check(n.Else, false)
+
+	case *ast.BinaryOp:
+		c.check(n.Left, false)
+		c.check(n.Right, false)
+
+	case *ast.MultiOp:
+		c.checkList(n.Exprs)
+
+	case *ast.BindExpr:
+		c.check(n.Value, false)
+		c.bind(n.Ident, letBinding, valueBinding(c.scope, n.Value))
+
+	case *ast.LetExpr:
+		c.push()
+		for _, binding := range n.Bindings {
+			c.check(binding, false)
+		}
+		c.check(n.Body, false)
+		c.pop("let binding")
+
+	case *ast.LazySeqExpr:
+		c.check(n.Body, false)
+
+	case *ast.AssertExpr:
+		c.check(n.Cond, false)
+		c.check(n.Msg, false)
+
+	case *ast.NsExpr:
+		// Nothing to check.
+
+	case *ast.RequireExpr:
+		if !top {
+			c.report(n.Pos(), Error, "require is not at the top level")
+		}
+		for _, spec := range n.Specs {
+			c.aliases[spec.Module.Name] = true
+			if spec.Alias != nil {
+				c.aliases[spec.Alias.Name] = true
+			}
+			for _, ident := range spec.Refer {
+				c.bind(ident, globalBinding, binding{arity: -1})
+			}
+			c.referAll = c.referAll || spec.ReferAll
+		}
+
+	default:
+		// Nodes added to the AST but not to the checker are reported instead of crashing it.
+		c.report(n.Pos(), Error, "internal error: unexpected node type %T", n)
+	}
+}
+
+func (c *checker) checkList(l *ast.ExprList) {
+	if l == nil {
+		return
+	}
+	for _, e := range l.Exprs {
+		c.check(e, false)
+	}
+}
+
+// checkMeta checks the values of the metadata map of a definition.
+func (c *checker) checkMeta(meta []*ast.MetaEntry) {
+	for _, entry := range meta {
+		c.check(entry.Value, false)
+	}
+}
+
+// checkCall checks the callee of a call is a function taking the number of arguments given.
+func (c *checker) checkCall(call *ast.CallExpr) {
+	numArgs := 0
+	if call.Args != nil {
+		numArgs = len(call.Args.Exprs)
+	}
+	name := "function"
+	info := valueBinding(c.scope, call.Fun)
+	if ident, ok := call.Fun.(*ast.IdentExpr); ok {
+		name = fmt.Sprintf("%q", ident.Name)
+	}
+	if info.notFunc {
+		c.report(call.Pos(), Error, "%s is not a function", describe(call.Fun))
+		return
+	}
+	if info.arity >= 0 && info.arity != numArgs {
+		c.report(call.Pos(), Error, "wrong number of arguments to %s: got %d, want %d", name, numArgs, info.arity)
+		return
+	}
+	// The arguments whose type isn't known are checked when the function is called.
+	for i, tag := range info.paramTags {
+		if tag == "" {
+			continue
+		}
+		arg := call.Args.Exprs[i]
+		if kinds, desc := c.knownKinds(arg); !acceptsAny(tag, kinds) {
+			c.report(arg.Pos(), Error, "argument %s of %s must be %s, got %s", info.params[i], name, tag, desc)
+		}
+	}
+}
+
+// knownKinds returns the kinds of objects expr can evaluate to and their description, or nil if
+// they are not known.
+func (c *checker) knownKinds(expr ast.Expr) ([]ast.ObjKind, string) {
+	switch n := expr.(type) {
+	case *ast.NilExpr:
+		return []ast.ObjKind{ast.Nil}, "nil"
+	case *ast.NumExpr:
+		return []ast.ObjKind{n.Kind}, n.Kind.String()
+	case *ast.BooleanExpr, *ast.BinaryOp:
+		return []ast.ObjKind{ast.Boolean}, ast.Boolean.String()
+	case *ast.StringExpr:
+		return []ast.ObjKind{ast.String}, ast.String.String()
+	case *ast.VectorExpr:
+		return []ast.ObjKind{ast.Vector}, ast.Vector.String()
+	case *ast.MultiOp:
+		return ast.HintKinds("Number"), "Number"
+	case *ast.IdentExpr:
+		if b := c.scope.lookup(n.Name); b != nil && b.tag != "" {
+			return ast.HintKinds(b.tag), b.tag
+		}
+	case *ast.CallExpr:
+		if info := valueBinding(c.scope, n.Fun); info.resultTag != "" {
+			return ast.HintKinds(info.resultTag), info.resultTag
+		}
+	}
+	return nil, ""
+}
+
+// acceptsAny reports whether one of kinds satisfies a type hint, or kinds are not known.
+func acceptsAny(tag string, kinds []ast.ObjKind) bool {
+	if kinds == nil {
+		return true
+	}
+	for _, kind := range kinds {
+		if ast.HintAccepts(tag, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// alias returns the alias of the module qualifying a name like lib/f, or an empty string.
+func alias(name string) string {
+	if i := strings.IndexByte(name, '/'); i > 0 && i < len(name)-1 {
+		return name[:i]
+	}
+	return ""
+}
+
+// valueBinding returns what is known about the value of expr, for a name bound to it.
+func valueBinding(sc *scope, expr ast.Expr) binding {
+	switch n := expr.(type) {
+	case *ast.FuncExpr:
+		params := make([]string, len(n.Params))
+		for i, param := range n.Params {
+			params[i] = param.Name
+		}
+		return binding{arity: len(n.Params), params: params, paramTags: n.ParamTags, resultTag: n.ResultTag}
+	case *ast.IdentExpr:
+		if b := sc.lookup(n.Name); b != nil {
+			return binding{arity: b.arity, notFunc: b.notFunc, params: b.params, paramTags: b.paramTags, resultTag: b.resultTag}
+		}
+	case *ast.NilExpr, *ast.NumExpr, *ast.BooleanExpr, *ast.StringExpr, *ast.VectorExpr,
+		*ast.BinaryOp, *ast.MultiOp, *ast.LazySeqExpr:
+		return binding{arity: -1, notFunc: true}
+	}
+	return binding{arity: -1}
+}
+
+// describe names the kind of value of expr for error messages.
+func describe(expr ast.Expr) string {
+	switch n := expr.(type) {
+	case *ast.IdentExpr:
+		return fmt.Sprintf("%q", n.Name)
+	case *ast.NilExpr:
+		return "nil"
+	case *ast.NumExpr:
+		obj, _ := n.Eval(nil)
+		return "number " + obj.String()
+	case *ast.BooleanExpr:
+		return fmt.Sprintf("boolean %t", n.Bool)
+	case *ast.StringExpr:
+		return fmt.Sprintf("string %q", n.Value)
+	case *ast.VectorExpr:
+		return "vector"
+	}
+	return "value"
+}
+
+// bind binds a name in the current scope, warning if it shadows another binding of the program.
+func (c *checker) bind(ident *ast.IdentExpr, kind bindingKind, info binding) {
+	if kind != globalBinding || c.scope.outer != nil {
+		if prev := c.scope.lookup(ident.Name); prev != nil && !strings.HasPrefix(ident.Name, "_") {
+			c.report(ident.Pos(), Warning, "%q shadows the binding at %s", ident.Name, prev.pos)
+		}
+	}
+	info.kind, info.pos = kind, ident.Pos()
+	c.scope.insert(ident.Name, &info)
+}
+
+func (c *checker) push() {
+	c.scope = newScope(c.scope)
+}
+
+// pop leaves the current scope, warning about the bindings never used.
+func (c *checker) pop(what string) {
+	for _, name := range c.scope.order {
+		b := c.scope.names[name]
+		if !b.used && b.kind != globalBinding && !strings.HasPrefix(name, "_") {
+			c.report(b.pos, Warning, "%s %q is never used", what, name)
+		}
+	}
+	c.scope = c.scope.outer
+}
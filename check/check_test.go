@@ -0,0 +1,64 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		src    string
+		expect []string
+	}{
+		{"(defn f [x] (+ x 1)) (f 1)", nil},
+		{"(+ y 1)", []string{`1:4: error: "y" is not defined`}},
+		{"(defn f [] (g)) (defn g [] 1)", []string{`1:13: error: "g" is not defined`}},
+		{"(defn f [a b] a) (f 1)", []string{
+			`1:12: warning: parameter "b" is never used`,
+			`1:18: error: wrong number of arguments to "f": got 1, want 2`,
+		}},
+		{"((fn [x] x) 1 2)", []string{`1:1: error: wrong number of arguments to function: got 2, want 1`}},
+		{"(fn [] (def x 1))", []string{`1:8: error: def of "x" is not at the top level`}},
+		{"(do (def x 1) (defn f [] x))", nil},
+		{"(let [a 1 b 2] a)", []string{`1:11: warning: let binding "b" is never used`}},
+		{"(let [a 1 _b 2] (fn [a] a))", []string{
+			`1:7: warning: let binding "a" is never used`,
+			`1:22: warning: "a" shadows the binding at 1:7`,
+		}},
+		{"(def x 1) (x)", []string{`1:11: error: "x" is not a function`}},
+		{"(def v [1]) (defn f [] (v 0))", []string{`1:24: error: "v" is not a function`}},
+		{"((if true 1 2))", nil},
+		{"(defn area [^Double w ^Double h] ^Double (* w h)) (area 1.5 2)", []string{
+			`1:61: error: argument h of "area" must be Double, got Int`,
+		}},
+		{`(defn f [^Number x] ^String x) (defn g [^Seq l] (f (count l))) (g [1]) (g "a")`, []string{
+			`1:29: error: result must be String, got Number`,
+			`1:75: error: argument l of "g" must be Seq, got String`,
+		}},
+		{"(defn f [x] {:pre [(> x 0)] :post [(> % x)]} (* x 2)) (assert (f 1) msg)", []string{
+			`1:69: error: "msg" is not defined`,
+		}},
+		{"(defn fact [n] (if (= n 0) 1 (* n (fact (- n 1) 2))))", []string{
+			`1:35: error: wrong number of arguments to "fact": got 2, want 1`,
+		}},
+		{"(require '[my.lib :as lib :refer [f]]) (lib/g (f 1) my.lib/h other/x)", []string{
+			`1:62: error: "other/x" is not defined`,
+		}},
+		{"(defn f [] (require 'm))", []string{`1:12: error: require is not at the top level`}},
+	}
+	for _, test := range tests {
+		exprs, err := parser.ParseExprs([]byte(test.src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", test.src, err)
+		}
+		var got []string
+		for _, d := range Check(exprs, nil) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.expect, "\n") {
+			t.Errorf("%s: expect\n%s\ngot\n%s", test.src, strings.Join(test.expect, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
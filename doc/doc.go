@@ -0,0 +1,198 @@
+// Package doc extracts the documentation of gofp modules from their source and renders it as
+// Markdown or HTML.
+//
+// The documentation of a module is its ns docstring and the docstrings, parameters and metadata of
+// its public definitions, those made by def and defn at the top level. Definitions made by defn-
+// or with a true :private entry are left out.
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/module"
+	"github.com/easonliao/gofp/parser"
+	"github.com/easonliao/gofp/token"
+)
+
+// Module is the documentation of a module.
+type Module struct {
+	Name string
+	File string
+	Doc  string
+	Defs []*Def
+}
+
+// Def is the documentation of a public definition.
+type Def struct {
+	Name string
+	// Params are the parameters of a function, nil for the other definitions.
+	Params []string
+	Doc    string
+	// Deprecated is set by a :deprecated entry which isn't false or nil, Deprecation is its
+	// message if it's a string.
+	Deprecated  bool
+	Deprecation string
+	// Meta holds the other entries of the metadata map, with their values as written.
+	Meta []Entry
+	Pos  token.Position
+}
+
+// Entry is an entry of a metadata map.
+type Entry struct {
+	Key, Value string
+}
+
+// Usage returns a call of a function, like (area w h), or "" for the other definitions.
+func (d *Def) Usage() string {
+	if d.Params == nil {
+		return ""
+	}
+	return "(" + strings.Join(append([]string{d.Name}, d.Params...), " ") + ")"
+}
+
+// FromExprs returns the documentation of the module in file made of exprs. Its name is the one
+// declared by ns, or name if there is none.
+func FromExprs(name, file string, exprs []ast.Expr) *Module {
+	m := &Module{Name: name, File: file}
+	for _, expr := range exprs {
+		switch n := expr.(type) {
+		case *ast.NsExpr:
+			m.Name, m.Doc = n.Name.Name, trimDoc(n.Doc)
+		case *ast.DefExpr:
+			var params []string
+			if fn, ok := n.Expr.(*ast.FuncExpr); ok {
+				params = paramNames(fn)
+			}
+			m.add(n.Ident, params, n.Doc, n.Meta, false)
+		case *ast.DefnExpr:
+			params := []string{}
+			if fn, ok := n.Expr.(*ast.FuncExpr); ok {
+				params = paramNames(fn)
+			}
+			m.add(n.Ident, params, n.Doc, n.Meta, n.Private)
+		}
+	}
+	sort.SliceStable(m.Defs, func(i, j int) bool { return m.Defs[i].Name < m.Defs[j].Name })
+	return m
+}
+
+func (m *Module) add(ident *ast.IdentExpr, params []string, doc string, meta []*ast.MetaEntry, private bool) {
+	def := &Def{Name: ident.Name, Params: params, Doc: trimDoc(doc), Pos: ident.Pos()}
+	for _, entry := range meta {
+		switch entry.Key {
+		case ":private":
+			private = private || isTrue(entry.Value)
+		case ":doc":
+			if str, ok := entry.Value.(*ast.StringExpr); ok && def.Doc == "" {
+				def.Doc = trimDoc(str.Value)
+			}
+		case ":deprecated":
+			def.Deprecated = isTrue(entry.Value)
+			if str, ok := entry.Value.(*ast.StringExpr); ok {
+				def.Deprecation = str.Value
+			}
+		default:
+			def.Meta = append(def.Meta, Entry{entry.Key, sourceText(entry.Value)})
+		}
+	}
+	if !private {
+		m.Defs = append(m.Defs, def)
+	}
+}
+
+func paramNames(fn *ast.FuncExpr) []string {
+	params := make([]string, len(fn.Params))
+	for i, param := range fn.Params {
+		params[i] = param.Name
+	}
+	return params
+}
+
+// isTrue reports whether the value of a metadata entry is true, any value but false and nil is.
+func isTrue(expr ast.Expr) bool {
+	switch n := expr.(type) {
+	case *ast.NilExpr:
+		return false
+	case *ast.BooleanExpr:
+		return n.Bool
+	}
+	return true
+}
+
+func sourceText(expr ast.Expr) string {
+	var b bytes.Buffer
+	ast.Fprint(&b, expr, &ast.PrintOptions{Mode: ast.SExprMode})
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// trimDoc removes the indentation of the lines of a docstring, which are usually aligned with
+// the first one in the source.
+func trimDoc(doc string) string {
+	lines := strings.Split(strings.TrimSpace(doc), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Tree returns the documentation of the modules in the files and directory trees at paths,
+// sorted by name. The modules in a directory are named after their path relative to it, like
+// my.lib for my/lib.gofp, unless they declare another name with ns.
+func Tree(paths ...string) ([]*Module, error) {
+	var mods []*Module
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			name := strings.TrimSuffix(filepath.Base(root), module.Ext)
+			mod, err := parseFile(name, root)
+			if err != nil {
+				return nil, err
+			}
+			mods = append(mods, mod)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != module.Ext {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			name := strings.Replace(strings.TrimSuffix(filepath.ToSlash(rel), module.Ext), "/", ".", -1)
+			mod, err := parseFile(name, path)
+			if err != nil {
+				return err
+			}
+			mods = append(mods, mod)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(mods, func(i, j int) bool { return mods[i].Name < mods[j].Name })
+	return mods, nil
+}
+
+func parseFile(name, file string) (*Module, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := parser.ParseExprs(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return FromExprs(name, file, exprs), nil
+}
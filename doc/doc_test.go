@@ -0,0 +1,74 @@
+package doc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/parser"
+)
+
+const src = `(ns my.lib "Helpers.")
+(defn ^{:added 2} helper
+  "Adds one to x.
+   Twice."
+  [x]
+  (+ x 1))
+(defn- hidden [] 1)
+(def ^{:private true} secret 1)
+(def ^{:deprecated "use helper"} answer "The answer." 42)
+(def inc (fn [n] (+ n 1)))`
+
+func TestFromExprs(t *testing.T) {
+	exprs, err := parser.ParseExprs([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := FromExprs("lib", "lib.gofp", exprs)
+	if m.Name != "my.lib" || m.Doc != "Helpers." {
+		t.Errorf("expect module my.lib documented, got %s %q", m.Name, m.Doc)
+	}
+	var names []string
+	for _, def := range m.Defs {
+		names = append(names, def.Name)
+	}
+	if strings.Join(names, " ") != "answer helper inc" {
+		t.Fatalf("expect the public definitions answer, helper and inc, got %v", names)
+	}
+	answer, helper, inc := m.Defs[0], m.Defs[1], m.Defs[2]
+	if !answer.Deprecated || answer.Deprecation != "use helper" || answer.Doc != "The answer." || answer.Usage() != "" {
+		t.Errorf("unexpected documentation of answer: %+v", answer)
+	}
+	if helper.Doc != "Adds one to x.\nTwice." || helper.Usage() != "(helper x)" || len(helper.Meta) != 1 || helper.Meta[0] != (Entry{":added", "2"}) {
+		t.Errorf("unexpected documentation of helper: %+v", helper)
+	}
+	if inc.Usage() != "(inc n)" {
+		t.Errorf("expect the usage of inc to be (inc n), got %s", inc.Usage())
+	}
+}
+
+func TestRender(t *testing.T) {
+	exprs, err := parser.ParseExprs([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods := []*Module{FromExprs("", "lib.gofp", exprs), {Name: "other"}}
+	var md bytes.Buffer
+	if err := Markdown(&md, mods); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"- [my.lib](#mylib)\n", "## my.lib\n\nHelpers.\n", "### helper\n\n```clojure\n(helper x)\n```\n\nAdds one to x.\nTwice.\n\n- `:added` `2`\n", "**Deprecated.** use helper\n"} {
+		if !strings.Contains(md.String(), expect) {
+			t.Errorf("expect the Markdown to contain %q, got\n%s", expect, md.String())
+		}
+	}
+	var html bytes.Buffer
+	if err := HTML(&html, mods); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{`<h2 id="my.lib">my.lib</h2>`, `<h3 id="my.lib/helper">helper</h3>`, `<pre><code>(helper x)</code></pre>`} {
+		if !strings.Contains(html.String(), expect) {
+			t.Errorf("expect the HTML to contain %q, got\n%s", expect, html.String())
+		}
+	}
+}
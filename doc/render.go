@@ -0,0 +1,133 @@
+package doc
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// title returns the title of the documentation of mods.
+func title(mods []*Module) string {
+	if len(mods) == 1 {
+		return mods[0].Name
+	}
+	return "API documentation"
+}
+
+// Markdown writes the documentation of mods as Markdown, with a section for each module and a
+// subsection for each definition. An index of the modules comes first if there are several.
+func Markdown(w io.Writer, mods []*Module) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title(mods))
+	if len(mods) > 1 {
+		b.WriteString("\n")
+		for _, m := range mods {
+			fmt.Fprintf(&b, "- [%s](#%s)\n", m.Name, anchor(m.Name))
+		}
+	}
+	for _, m := range mods {
+		fmt.Fprintf(&b, "\n## %s\n", m.Name)
+		if m.Doc != "" {
+			fmt.Fprintf(&b, "\n%s\n", m.Doc)
+		}
+		for _, def := range m.Defs {
+			fmt.Fprintf(&b, "\n### %s\n", def.Name)
+			if usage := def.Usage(); usage != "" {
+				fmt.Fprintf(&b, "\n```clojure\n%s\n```\n", usage)
+			}
+			if def.Deprecated {
+				b.WriteString("\n**Deprecated.**")
+				if def.Deprecation != "" {
+					b.WriteString(" " + def.Deprecation)
+				}
+				b.WriteString("\n")
+			}
+			if def.Doc != "" {
+				fmt.Fprintf(&b, "\n%s\n", def.Doc)
+			}
+			if len(def.Meta) > 0 {
+				b.WriteString("\n")
+				for _, entry := range def.Meta {
+					fmt.Fprintf(&b, "- `%s` `%s`\n", entry.Key, entry.Value)
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// anchor returns the anchor of a Markdown heading as made by GitHub: lower case letters, digits,
+// hyphens and underscores with spaces turned to hyphens.
+func anchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var htmlTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
+	"paragraphs": func(s string) []string { return strings.Split(s, "\n\n") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: auto; }
+pre { background: #f4f4f4; padding: 0.5em; }
+.deprecated { color: #a00; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if gt (len .Modules) 1}}
+<ul>
+{{- range .Modules}}
+<li><a href="#{{.Name}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range $m := .Modules}}
+<h2 id="{{$m.Name}}">{{$m.Name}}</h2>
+{{- range paragraphs $m.Doc}}{{if .}}
+<p>{{.}}</p>{{end}}{{end}}
+{{- range $m.Defs}}
+<h3 id="{{$m.Name}}/{{.Name}}">{{.Name}}</h3>
+{{- with .Usage}}
+<pre><code>{{.}}</code></pre>
+{{- end}}
+{{- if .Deprecated}}
+<p class="deprecated"><strong>Deprecated.</strong>{{with .Deprecation}} {{.}}{{end}}</p>
+{{- end}}
+{{- range paragraphs .Doc}}{{if .}}
+<p>{{.}}</p>{{end}}{{end}}
+{{- with .Meta}}
+<dl>
+{{- range .}}
+<dt><code>{{.Key}}</code></dt><dd><code>{{.Value}}</code></dd>
+{{- end}}
+</dl>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes the documentation of mods as an HTML page, laid out like the Markdown one. The
+// modules and definitions have anchors of their name, like my.lib and my.lib/helper.
+func HTML(w io.Writer, mods []*Module) error {
+	return htmlTemplate.Execute(w, struct {
+		Title   string
+		Modules []*Module
+	}{title(mods), mods})
+}
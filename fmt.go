@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/easonliao/gofp/format"
+)
+
+func runFmt(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	write := fs.Bool("w", false, "write the result to the source file instead of stdout")
+	diff := fs.Bool("d", false, "print diffs instead of the formatted source")
+	width := fs.Int("width", format.DefaultWidth, "maximum line width")
+	if !cmd.parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+	opts := &format.Options{Width: *width}
+	if fs.NArg() == 0 {
+		if *write {
+			errorf(cmd, "cannot use -w with standard input")
+			return exitUsage
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		return formatFile(cmd, "<stdin>", src, opts, false, *diff)
+	}
+	code := exitOK
+	for _, file := range fs.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			errorf(cmd, "%v", err)
+			code = exitError
+			continue
+		}
+		if c := formatFile(cmd, file, src, opts, *write, *diff); c != exitOK {
+			code = c
+		}
+	}
+	return code
+}
+
+// formatFile formats the source of a file and writes it back, prints it or prints the diff.
+func formatFile(cmd *command, file string, src []byte, opts *format.Options, write, diff bool) int {
+	res, err := format.SourceWithOptions(src, opts)
+	if err != nil {
+		errorf(cmd, "%s: %v", file, err)
+		return exitError
+	}
+	if diff {
+		if !bytes.Equal(src, res) {
+			fmt.Print(unifiedDiff(file, string(src), string(res)))
+		}
+	}
+	if write {
+		if bytes.Equal(src, res) {
+			return exitOK
+		}
+		if err := ioutil.WriteFile(file, res, 0644); err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		return exitOK
+	}
+	if !diff {
+		os.Stdout.Write(res)
+	}
+	return exitOK
+}
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// unifiedDiff returns the differences from a to b in unified format.
+func unifiedDiff(name, a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// Edit script: one entry per line with ' ', '-' or '+'.
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, edit{' ', x[i]})
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', x[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', y[j]})
+			j++
+		}
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	// Group changes closer than twice the context into hunks.
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			n := end
+			for n < len(edits) && edits[n].op == ' ' {
+				n++
+			}
+			if n == len(edits) || n-end > 2*diffContext {
+				break
+			}
+			end = n
+		}
+		stop := end + diffContext
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+		// Line numbers of the hunk start in both files.
+		aLine, bLine := 1, 1
+		for _, e := range edits[:start] {
+			if e.op != '+' {
+				aLine++
+			}
+			if e.op != '-' {
+				bLine++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, e := range edits[start:stop] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine, aLen, bLine, bLen)
+		for _, e := range edits[start:stop] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+		k = stop
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,358 @@
+// Package format prints gofp source code in canonical layout.
+//
+// Forms which fit in the line width are printed on a single line. Otherwise special forms keep
+// their leading arguments on the first line and indent the body by two columns, function calls
+// align their arguments with the first one and binding vectors put a name and its value on each
+// line with the values aligned. Comments are kept where they were: at the end of a line or on a
+// line of their own.
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/easonliao/gofp/parser"
+	"github.com/easonliao/gofp/scanner"
+	"github.com/easonliao/gofp/token"
+)
+
+// DefaultWidth is the line width used when no width is given in the options.
+const DefaultWidth = 80
+
+// Options controls the layout of the formatted source.
+type Options struct {
+	// Width is the maximum width of a line, forms which don't fit are split over several lines.
+	Width int
+}
+
+// Source formats src in canonical layout. The source must parse without errors.
+func Source(src []byte) ([]byte, error) {
+	return SourceWithOptions(src, nil)
+}
+
+// SourceWithOptions formats src in canonical layout with the given options, the default options
+// are used if opts is nil.
+func SourceWithOptions(src []byte, opts *Options) ([]byte, error) {
+	if _, err := parser.ParseExprs(src); err != nil {
+		return nil, err
+	}
+	width := DefaultWidth
+	if opts != nil && opts.Width > 0 {
+		width = opts.Width
+	}
+	forms, err := read(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{width: width}
+	for i, n := range forms {
+		if i > 0 {
+			prev := forms[i-1]
+			switch {
+			case n.kind == comment && n.line == prev.endLine:
+				p.write(" ")
+			case n.line-prev.endLine > 1:
+				// Keep a single blank line between forms which were separated by blank lines.
+				p.write("\n\n")
+			default:
+				p.write("\n")
+			}
+		}
+		p.print(n, "")
+	}
+	if len(forms) > 0 {
+		p.write("\n")
+	}
+	return p.buf.Bytes(), nil
+}
+
+type nodeKind int
+
+const (
+	atom nodeKind = iota
+	comment
+	list
+	vector
+	braces // A condition map.
+)
+
+// node is a form or comment of the source.
+type node struct {
+	kind nodeKind
+	// text is the literal text of an atom or comment.
+	text     string
+	children []*node
+	// line and endLine are the lines where the node starts and ends in the source.
+	line, endLine int
+	// prefix is the quote or caret written before a form, like in '[my.lib :as lib] or
+	// ^{:deprecated true}.
+	prefix string
+}
+
+// bodyIndent gives the number of arguments special forms keep on their first line, the following
+// ones are the body indented by two columns.
+var bodyIndent = map[string]int{
+	"def":      1,
+	"defn":     2,
+	"defn-":    2,
+	"ns":       1,
+	"fn":       1,
+	"let":      1,
+	"if":       1,
+	"do":       0,
+	"lazy-seq": 0,
+}
+
+// reader builds the node tree from the tokens of the source.
+type reader struct {
+	s   scanner.Scanner
+	tok token.Token
+	lit string
+	pos token.Position
+	err error
+}
+
+func read(src []byte) ([]*node, error) {
+	r := &reader{}
+	r.s.InitMode(src, scanner.ScanComments)
+	r.next()
+	var forms []*node
+	for r.tok != token.EOF && r.err == nil {
+		forms = append(forms, r.readNode())
+	}
+	return forms, r.err
+}
+
+func (r *reader) next() {
+	if r.err != nil {
+		return
+	}
+	r.tok, r.lit, r.err = r.s.Next()
+	r.pos = r.s.Pos()
+}
+
+func (r *reader) readNode() *node {
+	n := &node{line: r.pos.Line, endLine: r.pos.Line}
+	switch r.tok {
+	case token.LPAREN, token.LBRACK, token.LBRACE:
+		n.kind = list
+		closing := token.RPAREN
+		switch r.tok {
+		case token.LBRACK:
+			n.kind, closing = vector, token.RBRACK
+		case token.LBRACE:
+			n.kind, closing = braces, token.RBRACE
+		}
+		r.next()
+		for r.tok != closing && r.tok != token.EOF && r.err == nil {
+			n.children = append(n.children, r.readNode())
+		}
+		n.endLine = r.pos.Line
+	case token.COMMENT:
+		n.kind, n.text = comment, r.lit
+	case token.CARET, token.QUOTE:
+		// A type hint is kept together with its tag, a quote or a metadata map with its form.
+		prefix := token.TokenName(r.tok)
+		r.next()
+		if r.tok == token.IDENT {
+			n.kind, n.text = atom, prefix+r.lit
+			break
+		}
+		form := r.readNode()
+		form.prefix, form.line = prefix, n.line
+		return form
+	default:
+		n.kind, n.text = atom, r.lit
+		if n.text == "" {
+			n.text = token.TokenName(r.tok)
+		}
+		n.endLine += strings.Count(n.text, "\n")
+	}
+	r.next()
+	return n
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	width int
+	col   int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = len(s) - i - 1
+	} else {
+		p.col += len(s)
+	}
+}
+
+// newline starts a new line indented to column indent.
+func (p *printer) newline(indent int) {
+	p.write("\n" + strings.Repeat(" ", indent))
+}
+
+// print prints n at the current column, ctx is the head of the enclosing list and tells binding
+// vectors from other vectors.
+func (p *printer) print(n *node, ctx string) {
+	if s, ok := flat(n); ok && p.col+len(s) <= p.width {
+		p.write(s)
+		return
+	}
+	if n.prefix != "" {
+		p.write(n.prefix)
+		form := *n
+		form.prefix = ""
+		n = &form
+	}
+	switch n.kind {
+	case atom, comment:
+		p.write(n.text)
+	case vector:
+		if ctx == "let" {
+			p.printBindings(n, "[", "]")
+		} else {
+			p.printElems(n, "[", "]", p.col+1, 0, "")
+		}
+	case braces:
+		p.printBindings(n, "{", "}")
+	case list:
+		p.printList(n)
+	}
+}
+
+func (p *printer) printList(n *node) {
+	if len(n.children) < 2 || n.children[0].kind != atom {
+		p.printElems(n, "(", ")", p.col+1, 0, "")
+		return
+	}
+	head := n.children[0].text
+	if k, ok := bodyIndent[head]; ok {
+		if head == "def" || head == "defn" || head == "defn-" {
+			k = definitionIndent(n, k)
+		}
+		p.printElems(n, "(", ")", p.col+2, k+1, head)
+		return
+	}
+	// Arguments are aligned with the first one, or indented by one column on the following lines
+	// if the first one doesn't fit after the function.
+	align := p.col + len(head) + 2
+	if first, ok := flat(n.children[1]); n.children[1].kind != comment && (!ok || align+len(first) <= p.width) {
+		p.printElems(n, "(", ")", align, 2, "")
+		return
+	}
+	p.printElems(n, "(", ")", p.col+1, 1, "")
+}
+
+// definitionIndent returns the number of arguments a definition keeps on its first line, k without
+// a metadata map or docstring. A metadata map stays on the first line before the name, a docstring
+// goes on a line of its own after it.
+func definitionIndent(n *node, k int) int {
+	name := 1
+	for name < len(n.children) && n.children[name].prefix == "^" {
+		name++
+	}
+	if doc := name + 1; doc < len(n.children) && n.children[doc].kind == atom && strings.HasPrefix(n.children[doc].text, `"`) {
+		return name
+	}
+	return k + name - 1
+}
+
+// printElems prints the elements of a list or vector between open and close. The first inline
+// elements are printed on the first line, the following ones on lines of their own indented to
+// column indent. Comments at the end of a line in the source stay there.
+func (p *printer) printElems(n *node, open, close string, indent, inline int, head string) {
+	p.write(open)
+	for i, c := range n.children {
+		if i > 0 {
+			prev := n.children[i-1]
+			switch {
+			case c.kind == comment && c.line == prev.endLine:
+				p.write(" ")
+			case i < inline && prev.kind != comment:
+				p.write(" ")
+			case c.kind == atom && strings.HasPrefix(c.text, "^") && prev.kind != comment:
+				// A type hint stays with the parameters it follows.
+				p.write(" ")
+			default:
+				p.newline(indent)
+			}
+		}
+		ctx := ""
+		if i == 1 {
+			ctx = head
+		}
+		p.print(c, ctx)
+	}
+	if len(n.children) > 0 && n.children[len(n.children)-1].kind == comment {
+		p.newline(indent)
+	}
+	p.write(close)
+}
+
+// printBindings prints a binding vector or a condition map with a key and its value on each line,
+// the values are aligned.
+func (p *printer) printBindings(n *node, open, close string) {
+	for _, c := range n.children {
+		if c.kind == comment {
+			p.printElems(n, open, close, p.col+1, 0, "")
+			return
+		}
+	}
+	indent := p.col + 1
+	nameWidth := 0
+	for i := 0; i < len(n.children); i += 2 {
+		if s, ok := flat(n.children[i]); ok && len(s) > nameWidth {
+			nameWidth = len(s)
+		}
+	}
+	p.write(open)
+	for i := 0; i < len(n.children); i += 2 {
+		if i > 0 {
+			p.newline(indent)
+		}
+		start := p.col
+		p.print(n.children[i], "")
+		if i+1 < len(n.children) {
+			pad := start + nameWidth + 1 - p.col
+			if pad < 1 {
+				pad = 1
+			}
+			p.write(strings.Repeat(" ", pad))
+			p.print(n.children[i+1], "")
+		}
+	}
+	p.write(close)
+}
+
+// flat returns n printed on a single line. It reports false if n contains a comment or a string
+// spanning several lines.
+func flat(n *node) (string, bool) {
+	if n.prefix != "" {
+		form := *n
+		form.prefix = ""
+		s, ok := flat(&form)
+		return n.prefix + s, ok
+	}
+	switch n.kind {
+	case comment:
+		return "", false
+	case atom:
+		return n.text, !strings.Contains(n.text, "\n")
+	}
+	parts := make([]string, len(n.children))
+	for i, c := range n.children {
+		s, ok := flat(c)
+		if !ok {
+			return "", false
+		}
+		parts[i] = s
+	}
+	switch n.kind {
+	case vector:
+		return "[" + strings.Join(parts, " ") + "]", true
+	case braces:
+		return "{" + strings.Join(parts, " ") + "}", true
+	}
+	return "(" + strings.Join(parts, " ") + ")", true
+}
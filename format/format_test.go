@@ -0,0 +1,46 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		src, expect string
+		width       int
+	}{
+		{"(+   1\n  2)", "(+ 1 2)\n", 0},
+		{"(def x 1)\n\n\n\n(def y 2) ; two\n", "(def x 1)\n\n(def y 2) ; two\n", 0},
+		{"(defn f [x] (if (< x 2) x (f (- x 1))))", "(defn f [x]\n  (if (< x 2)\n    x\n    (f (- x 1))))\n", 20},
+		{"(let [a 1 bcd 2] (+ a bcd))", "(let [a   1\n      bcd 2]\n  (+ a bcd))\n", 15},
+		{"(println 111111 222222 333333)", "(println 111111\n         222222\n         333333)\n", 20},
+		{"(do ; start\n(f)\n; last\n)", "(do ; start\n  (f)\n  ; last\n  )\n", 0},
+		{"[1 2 ; two\n 3]", "[1\n 2 ; two\n 3]\n", 0},
+		{"(defn area [^Double w   ^Double h] ^Double (* w h))", "(defn area [^Double w ^Double h] ^Double (* w h))\n", 0},
+		{"(defn f [x] {:pre [(> x 0)] :post [(> % x)]} (* x 2))", "(defn f [x]\n  {:pre  [(> x 0)]\n   :post [(> % x)]}\n  (* x 2))\n", 30},
+		{"(ns app)\n(require   '[my.lib :as lib :refer [f]]  'other)", "(ns app)\n(require '[my.lib :as lib :refer [f]] 'other)\n", 0},
+		{"(require '[my.lib :as lib] 'other)", "(require '[my.lib :as lib]\n         'other)\n", 30},
+		{"(defn   ^{:deprecated true} f \"Doubles x.\" [x] (* x 2))", "(defn ^{:deprecated true} f\n  \"Doubles x.\"\n  [x]\n  (* x 2))\n", 40},
+		{"(defn ^{:added 2} f [x] (* x 2))", "(defn ^{:added 2} f [x]\n  (* x 2))\n", 30},
+		{"(def x \"The answer.\" 42)", "(def x \"The answer.\" 42)\n", 0},
+		{"", "", 0},
+	}
+	for _, test := range tests {
+		res, err := SourceWithOptions([]byte(test.src), &Options{Width: test.width})
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if string(res) != test.expect {
+			t.Errorf("%q: expect\n%s\ngot\n%s", test.src, test.expect, res)
+		}
+		again, err := SourceWithOptions(res, &Options{Width: test.width})
+		if err != nil || string(again) != string(res) {
+			t.Errorf("%q: formatting is not idempotent, got\n%s", test.src, again)
+		}
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	if _, err := Source([]byte("(+ 1")); err == nil {
+		t.Error("expect error for incomplete source")
+	}
+}
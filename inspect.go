@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/check"
+	"github.com/easonliao/gofp/doc"
+	"github.com/easonliao/gofp/optimize"
+	"github.com/easonliao/gofp/parser"
+	"github.com/easonliao/gofp/scanner"
+	"github.com/easonliao/gofp/token"
+	"github.com/easonliao/gofp/types"
+)
+
+func runAST(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	sexpr := fs.Bool("sexpr", false, "print the expressions in S-expression syntax instead of the tree")
+	pos := fs.Bool("pos", false, "print the source positions in a column")
+	depth := fs.Int("depth", 0, "elide the nodes nested deeper than `n`, 0 for no limit")
+	asJSON := fs.Bool("json", false, "print the expressions as a JSON array, see ast.MarshalJSON for the schema")
+	dot := fs.Bool("dot", false, "print the trees as a Graphviz DOT graph")
+	optimized := fs.Bool("O", false, "print the expressions as optimized before they are run")
+	if !cmd.parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	src, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	exprs, err := parser.ParseExprs(src)
+	if err != nil {
+		errorf(cmd, "%s: %v", fs.Arg(0), err)
+		return exitError
+	}
+	if *optimized {
+		exprs = optimize.Exprs(exprs)
+	}
+	if *asJSON {
+		return printJSON(cmd, exprs)
+	}
+	if *dot {
+		if err := ast.FprintDot(os.Stdout, exprs...); err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		return exitOK
+	}
+	opts := &ast.PrintOptions{Positions: *pos, MaxDepth: *depth}
+	if *sexpr {
+		opts.Mode = ast.SExprMode
+	}
+	for _, expr := range exprs {
+		if err := ast.Fprint(os.Stdout, expr, opts); err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// printJSON prints the expressions of a program as a JSON array.
+func printJSON(cmd *command, exprs []ast.Expr) int {
+	nodes := make([]json.RawMessage, len(exprs))
+	for i, expr := range exprs {
+		data, err := ast.MarshalJSON(expr)
+		if err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		nodes[i] = data
+	}
+	data, err := json.MarshalIndent(nodes, "", "  ")
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	fmt.Printf("%s\n", data)
+	return exitOK
+}
+
+func runCallGraph(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	dot := fs.Bool("dot", false, "print the graph in Graphviz DOT format")
+	if !cmd.parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	var exprs []ast.Expr
+	for _, file := range fs.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		fileExprs, err := parser.ParseExprs(src)
+		if err != nil {
+			errorf(cmd, "%s: %v", file, err)
+			return exitError
+		}
+		exprs = append(exprs, fileExprs...)
+	}
+	g := ast.NewCallGraph(exprs)
+	if *dot {
+		if err := g.FprintDot(os.Stdout); err != nil {
+			errorf(cmd, "%v", err)
+			return exitError
+		}
+		return exitOK
+	}
+	for _, name := range g.Funcs {
+		if len(g.Calls[name]) == 0 {
+			fmt.Println(name)
+		}
+		for _, callee := range g.Calls[name] {
+			fmt.Printf("%s -> %s\n", name, callee)
+		}
+	}
+	return exitOK
+}
+
+func runTokens(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	if !cmd.parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	src, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	var s scanner.Scanner
+	s.InitMode(src, scanner.ScanComments)
+	for {
+		tok, lit, err := s.Next()
+		if err != nil {
+			errorf(cmd, "%s: %v", fs.Arg(0), err)
+			return exitError
+		}
+		if lit != "" && lit != token.TokenName(tok) {
+			fmt.Printf("%-8s %-10s %s\n", s.Pos(), token.TokenName(tok), lit)
+		} else {
+			fmt.Printf("%-8s %s\n", s.Pos(), token.TokenName(tok))
+		}
+		if tok == token.EOF {
+			return exitOK
+		}
+	}
+}
+
+func runCheck(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	inferTypes := fs.Bool("types", false, "infer the types of the programs and report type errors")
+	capsList := capsFlag(fs)
+	if !cmd.parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	caps, ok := parseCaps(cmd, *capsList)
+	if !ok {
+		return exitUsage
+	}
+	code := exitOK
+	for _, file := range fs.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			errorf(cmd, "%v", err)
+			code = exitError
+			continue
+		}
+		exprs, err := parser.ParseExprs(src)
+		if err != nil {
+			// Reported like the errors of the checker.
+			if e, ok := err.(*parser.Error); ok && e.Pos.IsValid() {
+				fmt.Printf("%s:%s: error: %s\n", file, e.Pos, e.Msg)
+			} else {
+				fmt.Printf("%s: %v\n", file, err)
+			}
+			code = exitError
+			continue
+		}
+		diags := check.Check(exprs, &check.Options{Globals: newScope(nil, caps, nil)})
+		for _, d := range diags {
+			fmt.Printf("%s:%s\n", file, d)
+		}
+		if check.HasErrors(diags) {
+			code = exitError
+			continue
+		}
+		// Types are only inferred for programs without errors, which would be reported twice.
+		if *inferTypes {
+			env := types.NewEnv()
+			env.Insert("*command-line-args*", types.MustParse("(List Str)"))
+			for _, err := range types.Check(exprs, env) {
+				fmt.Printf("%s:%s: error: %s\n", file, err.Pos, err.Msg)
+				code = exitError
+			}
+		}
+	}
+	return code
+}
+
+func runDoc(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	asHTML := fs.Bool("html", false, "print an HTML page instead of Markdown")
+	if !cmd.parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	mods, err := doc.Tree(paths...)
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	render := doc.Markdown
+	if *asHTML {
+		render = doc.HTML
+	}
+	if err := render(os.Stdout, mods); err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	return exitOK
+}
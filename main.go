@@ -1,57 +1,130 @@
+// Command gofp runs, inspects and checks gofp programs.
+//
+// Usage:
+//
+//	gofp <command> [arguments]
+//
+// Running gofp without a command starts the REPL, and gofp file.gofp is a shorthand for gofp run
+// file.gofp.
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+)
 
-	"github.com/easonliao/gofp/ast"
-	"github.com/easonliao/gofp/parser"
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The program or the check failed.
+	exitUsage = 2 // Invalid command line.
 )
 
+// command is a subcommand of gofp.
+type command struct {
+	name      string
+	usageLine string
+	short     string
+	// run runs the command with the arguments following its name and returns the exit code.
+	run func(cmd *command, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	// Assigned in init since the help command refers to the list itself.
+	commands = []*command{
+		{"run", "run [-ast] [-contracts=false] [-O=false] [-max-steps n] [-max-depth n] [-timeout d] [-max-memory n] [-caps list] [-path dirs] file.gofp [args...]", "run a program", runRun},
+		{"repl", "repl [-ast] [-history file] [-max-steps n] [-max-depth n] [-timeout d] [-max-memory n] [-caps list] [-path dirs]", "start an interactive session", runREPL},
+		{"eval", "eval [-contracts=false] [-O=false] [-max-steps n] [-max-depth n] [-timeout d] [-max-memory n] [-caps list] [-path dirs] -e expr [args...]", "evaluate expressions and print the last result", runEval},
+		{"ast", "ast [-sexpr|-json|-dot] [-pos] [-depth n] [-O] file.gofp", "print the syntax tree of a program", runAST},
+		{"callgraph", "callgraph [-dot] file.gofp...", "print which functions call which", runCallGraph},
+		{"tokens", "tokens file.gofp", "print the tokens of a program with their positions", runTokens},
+		{"check", "check [-types] [-caps list] file.gofp...", "check programs for errors without running them", runCheck},
+		{"fmt", "fmt [-w] [-d] [-width n] [file.gofp...]", "format programs in canonical layout", runFmt},
+		{"doc", "doc [-html] [dir|file.gofp...]", "print the API documentation of the modules in directory trees", runDoc},
+		{"help", "help [command]", "show help for a command", runHelp},
+	}
+}
+
 func main() {
-	file := os.Stdin
-	res := ast.NilObj
-
-	if len(os.Args) > 1 {
-		var err error
-		file, err = os.Open(os.Args[1])
-		if err != nil {
-			fmt.Println(err)
-			return
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		return runREPL(lookup("repl"), nil)
+	}
+	if cmd := lookup(args[0]); cmd != nil {
+		return cmd.run(cmd, args[1:])
+	}
+	if _, err := os.Stat(args[0]); err == nil {
+		// gofp file.gofp runs the file.
+		return runRun(lookup("run"), args)
+	}
+	fmt.Fprintf(os.Stderr, "gofp: unknown command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
 	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage:\n\n\tgofp <command> [arguments]\n\nThe commands are:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(w, "\nWithout a command gofp starts the REPL, gofp file.gofp runs the file.")
+}
 
-	reader := bufio.NewReader(file)
-	sc := ast.NewScope(nil)
+// flagSet creates the flag set of a command, errors are reported with the command's usage.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gofp %s\n", cmd.usageLine)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	for {
-		if file == os.Stdin {
-			fmt.Print(">")
-		}
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				fmt.Println(res)
-				return
-			}
-			fmt.Println(err)
-			return
-		}
-		expr, err := parser.ParseExpr([]byte(line))
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		ast.Print(expr)
-		res, err = expr.Eval(sc)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		if file == os.Stdin {
-			fmt.Println(res)
-		}
+// parseFlags parses the flags of a command and checks the number of remaining arguments is at
+// least min. It returns false if the command line is invalid.
+func (cmd *command) parseFlags(fs *flag.FlagSet, args []string, min int) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if fs.NArg() < min {
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+func runHelp(cmd *command, args []string) int {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return exitOK
+	}
+	c := lookup(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "gofp help: unknown command %q\n", args[0])
+		return exitUsage
 	}
+	fmt.Printf("usage: gofp %s\n\n%s.\n", c.usageLine, strings.ToUpper(c.short[:1])+c.short[1:])
+	return exitOK
+}
+
+// errorf prints an error message of a command to stderr.
+func errorf(cmd *command, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "gofp %s: %s\n", cmd.name, fmt.Sprintf(format, args...))
 }
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestDispatchExitCodes(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"eval", "-e", "(+ 1 2)"}, exitOK},
+		{[]string{"eval", "-e", "(undefined 1)"}, exitError},
+		{[]string{"eval"}, exitUsage},
+		{[]string{"run"}, exitUsage},
+		{[]string{"run", "no-such-file.gofp"}, exitError},
+		{[]string{"no-such-command"}, exitUsage},
+		{[]string{"help", "run"}, exitOK},
+	}
+	for _, test := range tests {
+		if code := dispatch(test.args); code != test.code {
+			t.Errorf("gofp %v: exit code %d, expect %d", test.args, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package module loads the modules required by gofp programs from a search path.
+//
+// The module my.lib is the file my/lib.gofp in the first directory of the search path which has
+// it, e.g. with the search path lib:vendor it's lib/my/lib.gofp or else vendor/my/lib.gofp.
+package module
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+// Ext is the extension of the files of modules.
+const Ext = ".gofp"
+
+// Loader loads modules from the directories of its search path.
+type Loader struct {
+	// Path is the list of directories searched in order.
+	Path []string
+	// FS is the file system of the directories, the host file system is used if FS is nil.
+	FS fs.FS
+	// Capabilities decides which files of the host file system may be read, like for the file
+	// builtins, all of them if it's nil.
+	Capabilities *ast.Capabilities
+}
+
+// SplitPath splits a search path made of directories separated by the OS path list separator,
+// like the GOFPPATH environment variable.
+func SplitPath(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return filepath.SplitList(list)
+}
+
+// File returns the file of a module relative to a directory of the search path.
+func File(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, `/\`) {
+			return "", fmt.Errorf("invalid module name %s", name)
+		}
+	}
+	return path.Join(parts...) + Ext, nil
+}
+
+// Load implements ast.Loader, it parses the file of the module found first on the search path.
+func (l *Loader) Load(name string) (string, []ast.Expr, error) {
+	rel, err := File(name)
+	if err != nil {
+		return "", nil, err
+	}
+	// A module found in a directory which may not be read is reported if it's not found elsewhere.
+	var denied error
+	for _, dir := range l.Path {
+		file, src, err := l.read(dir, rel)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if errors.Is(err, ast.ErrNoCapability) {
+			if denied == nil {
+				denied = fmt.Errorf("module %s: %w", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		exprs, err := parser.ParseExprs(src)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return file, exprs, nil
+	}
+	if denied != nil {
+		return "", nil, denied
+	}
+	if len(l.Path) == 0 {
+		return "", nil, fmt.Errorf("module %s not found, the search path is empty", name)
+	}
+	return "", nil, fmt.Errorf("module %s not found in %s", name, strings.Join(l.Path, string(filepath.ListSeparator)))
+}
+
+// read reads the file rel of dir and returns its name.
+func (l *Loader) read(dir, rel string) (string, []byte, error) {
+	if l.FS == nil {
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+		if l.Capabilities != nil {
+			src, err := l.Capabilities.ReadFile(file)
+			return file, src, err
+		}
+		src, err := os.ReadFile(file)
+		return file, src, err
+	}
+	file := path.Join(dir, rel)
+	src, err := fs.ReadFile(l.FS, file)
+	return file, src, err
+}
@@ -0,0 +1,64 @@
+package module
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gofp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"first/my/lib.gofp":  "(ns my.lib) (def x 1)",
+		"second/my/lib.gofp": "(ns my.lib) (def x 2) (def y 2)",
+		"second/bad.gofp":    "(ns bad",
+	}
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := &Loader{Path: []string{filepath.Join(dir, "first"), filepath.Join(dir, "second")}}
+
+	file, exprs, err := l.Load("my.lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := filepath.Join(dir, "first", "my", "lib.gofp"); file != expect || len(exprs) != 2 {
+		t.Errorf("expect the 2 expressions of %s, got %d from %s", expect, len(exprs), file)
+	}
+	for _, name := range []string{"bad", "missing", "my..lib", "my/lib", ""} {
+		if _, _, err := l.Load(name); err == nil {
+			t.Errorf("expect loading %q to fail", name)
+		} else if name == "bad" && !strings.Contains(err.Error(), "bad.gofp") {
+			t.Errorf("expect the error to name the file, got %v", err)
+		}
+	}
+
+	// The files are read if the capabilities grant it, a module is searched in the other
+	// directories of the path if it may not be read.
+	caps, err := ast.ParseCapabilities("fs:" + filepath.Join(dir, "second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Capabilities = caps
+	if file, _, err := l.Load("my.lib"); err != nil || file != filepath.Join(dir, "second", "my", "lib.gofp") {
+		t.Errorf("expect my.lib to be loaded from the second directory, got %s, %v", file, err)
+	}
+	l.Capabilities, _ = ast.ParseCapabilities("core")
+	if _, _, err := l.Load("my.lib"); !errors.Is(err, ast.ErrNoCapability) {
+		t.Errorf("expect loading my.lib to be denied, got %v", err)
+	}
+}
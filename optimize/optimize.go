@@ -0,0 +1,284 @@
+// Package optimize simplifies the syntax trees of gofp programs before they are evaluated.
+//
+// The optimizer folds arithmetic and comparisons of constants, prunes the branches of if
+// expressions with a constant condition when they don't use names, flattens nested do blocks,
+// drops the let bindings of constants which are never used, after replacing their uses by the
+// constants, and turns calls of function literals into let expressions.
+// Optimized programs evaluate to the same values and fail with the same errors: an expression
+// which fails, like (/ 1 0), is left to fail at run time. The operators are assumed to be defined,
+// by the core capability.
+package optimize
+
+import (
+	"sync"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/token"
+)
+
+// Exprs optimizes the top level expressions of a program.
+func Exprs(exprs []ast.Expr) []ast.Expr {
+	res := make([]ast.Expr, len(exprs))
+	for i, expr := range exprs {
+		res[i] = Expr(expr)
+	}
+	return res
+}
+
+// Expr returns an optimized copy of expr, expr is left unchanged.
+func Expr(expr ast.Expr) ast.Expr {
+	return ast.Rewrite(expr, simplify)
+}
+
+// simplify simplifies a node whose children are already simplified.
+func simplify(node ast.Expr) ast.Expr {
+	switch n := node.(type) {
+	case *ast.MultiOp:
+		if allConst(n.Exprs.Exprs, isNum) {
+			return fold(n)
+		}
+	case *ast.BinaryOp:
+		pred := isNum
+		if n.Op == token.EQ {
+			pred = isConst
+		}
+		if pred(n.Left) && pred(n.Right) {
+			return fold(n)
+		}
+	case *ast.IfExpr:
+		// Conditions which are not booleans fail at run time. The branch dropped must not use
+		// names, a function capturing a name which isn't defined fails when it's created.
+		if cond, ok := n.Cond.(*ast.BooleanExpr); ok {
+			kept, dropped := n.Then, n.Else
+			if !cond.Bool {
+				kept, dropped = n.Else, n.Then
+			}
+			if len(freeNames(dropped)) == 0 {
+				return kept
+			}
+		}
+	case *ast.DoExpr:
+		return flattenDo(n)
+	case *ast.LetExpr:
+		return pruneLet(propagate(n))
+	case *ast.CallExpr:
+		if fn, ok := n.Fun.(*ast.FuncExpr); ok {
+			return inline(n, fn)
+		}
+	}
+	return node
+}
+
+// operators is the scope where the constants are folded, with the builtins of the core capability
+// which define the operators. It's created on first use by fold.
+var (
+	operators     *ast.Scope
+	operatorsOnce sync.Once
+)
+
+// fold evaluates an expression on constants, it's left as is if it fails.
+func fold(expr ast.Expr) ast.Expr {
+	operatorsOnce.Do(func() {
+		caps, _ := ast.ParseCapabilities("core")
+		operators = ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps})
+	})
+	obj, err := expr.Eval(ast.NewScope(operators))
+	if err != nil {
+		return expr
+	}
+	switch obj.Kind {
+	case ast.Boolean:
+		return &ast.BooleanExpr{Position: expr.Pos(), Bool: obj.Value.(bool)}
+	case ast.Int, ast.BigInt, ast.Ratio, ast.Double:
+		return &ast.NumExpr{Position: expr.Pos(), Kind: obj.Kind, Value: obj.Value}
+	}
+	return expr
+}
+
+// freeNames returns the names used in expr which are not bound in it, except the operators.
+func freeNames(expr ast.Expr) map[string]bool {
+	names := ast.FreeNames(expr)
+	for _, op := range []token.Token{token.ADD, token.SUB, token.MULT, token.DIV, token.LT, token.GT, token.LE, token.GE, token.EQ} {
+		delete(names, token.TokenName(op))
+	}
+	return names
+}
+
+func isNum(expr ast.Expr) bool {
+	_, ok := expr.(*ast.NumExpr)
+	return ok
+}
+
+// isConst reports whether expr is a literal, which evaluates to itself and can't fail.
+func isConst(expr ast.Expr) bool {
+	switch n := expr.(type) {
+	case *ast.NilExpr, *ast.NumExpr, *ast.BooleanExpr, *ast.StringExpr:
+		return true
+	case *ast.VectorExpr:
+		return allConst(n.Exprs.Exprs, isConst)
+	}
+	return false
+}
+
+func allConst(exprs []ast.Expr, pred func(ast.Expr) bool) bool {
+	for _, expr := range exprs {
+		if !pred(expr) {
+			return false
+		}
+	}
+	return true
+}
+
+// flattenDo splices the do blocks nested in a do, and replaces a do of a single expression by the
+// expression.
+func flattenDo(n *ast.DoExpr) ast.Expr {
+	exprs := make([]ast.Expr, 0, len(n.Exprs.Exprs))
+	for i, expr := range n.Exprs.Exprs {
+		// An empty do is nil, it's only kept as the last expression whose value it gives.
+		if inner, ok := expr.(*ast.DoExpr); ok && (len(inner.Exprs.Exprs) > 0 || i < len(n.Exprs.Exprs)-1) {
+			exprs = append(exprs, inner.Exprs.Exprs...)
+		} else {
+			exprs = append(exprs, expr)
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return &ast.DoExpr{Position: n.Position, Exprs: &ast.ExprList{Position: n.Exprs.Position, Exprs: exprs}}
+}
+
+// pruneLet drops the bindings of constants which are not used by the following bindings or the
+// body, a let without bindings left is replaced by its body unless the body defines names, which
+// are bound in the scope of the let.
+func pruneLet(n *ast.LetExpr) ast.Expr {
+	used := freeNames(n.Body)
+	keep := make([]bool, len(n.Bindings))
+	for i := len(n.Bindings) - 1; i >= 0; i-- {
+		b := n.Bindings[i]
+		if !used[b.Ident.Name] && isConst(b.Value) {
+			continue
+		}
+		keep[i] = true
+		// The earlier bindings of the name are shadowed by this one.
+		delete(used, b.Ident.Name)
+		for name := range freeNames(b.Value) {
+			used[name] = true
+		}
+	}
+	var bindings []*ast.BindExpr
+	for i, b := range n.Bindings {
+		if keep[i] {
+			bindings = append(bindings, b)
+		}
+	}
+	if len(bindings) == 0 && !defines(n.Body) {
+		return n.Body
+	}
+	if len(bindings) == 0 || len(bindings) == len(n.Bindings) {
+		return n
+	}
+	return &ast.LetExpr{Position: n.Position, Bindings: bindings, Body: n.Body}
+}
+
+// inline turns a call of a function literal, ((fn [x y] body) a b), into (let [x a y b] body).
+// The call is kept if the function has type hints or conditions, which are checked on calls, if
+// it captures names whose lookup could fail when it's created, if its body defines names in the
+// scope of the call or if an argument uses a parameter bound before it by the let.
+func inline(call *ast.CallExpr, fn *ast.FuncExpr) ast.Expr {
+	args := call.Args.Exprs
+	if len(args) != len(fn.Params) || fn.ParamTags != nil || fn.ResultTag != "" || fn.Pre != nil || fn.Post != nil {
+		return call
+	}
+	if len(freeNames(fn)) > 0 || defines(fn.Expr) {
+		return call
+	}
+	bound := make(map[string]bool)
+	bindings := make([]*ast.BindExpr, len(args))
+	for i, arg := range args {
+		for name := range freeNames(arg) {
+			if bound[name] {
+				return call
+			}
+		}
+		param := fn.Params[i]
+		bound[param.Name] = true
+		bindings[i] = &ast.BindExpr{Position: param.Position, Ident: param, Value: arg}
+	}
+	if len(bindings) == 0 {
+		return fn.Expr
+	}
+	return pruneLet(propagate(&ast.LetExpr{Position: call.Position, Bindings: bindings, Body: fn.Expr}))
+}
+
+// propagate replaces the uses of the let bindings of constants by the constants, and simplifies
+// the expressions where they were replaced. A binding is only replaced if its name isn't bound
+// again in the let, so that every use of the name refers to it.
+func propagate(n *ast.LetExpr) *ast.LetExpr {
+	if defines(n.Body) {
+		return n
+	}
+	res := &ast.LetExpr{Position: n.Position, Bindings: append([]*ast.BindExpr(nil), n.Bindings...), Body: n.Body}
+	for i, b := range res.Bindings {
+		if !isConst(b.Value) || rebinds(b.Ident.Name, res, i+1) {
+			continue
+		}
+		replace := func(node ast.Expr) ast.Expr {
+			if ident, ok := node.(*ast.IdentExpr); ok && ident.Name == b.Ident.Name {
+				return b.Value
+			}
+			return node
+		}
+		for j := i + 1; j < len(res.Bindings); j++ {
+			later := res.Bindings[j]
+			res.Bindings[j] = &ast.BindExpr{Position: later.Position, Ident: later.Ident, Value: Expr(ast.Rewrite(later.Value, replace))}
+		}
+		res.Body = Expr(ast.Rewrite(res.Body, replace))
+	}
+	return res
+}
+
+// rebinds reports whether name is bound again by the bindings of n from the i-th one or in the
+// values and body.
+func rebinds(name string, n *ast.LetExpr, i int) bool {
+	found := false
+	check := func(node ast.Expr) bool {
+		switch node := node.(type) {
+		case *ast.FuncExpr:
+			for _, param := range node.Params {
+				found = found || param.Name == name
+			}
+			found = found || node.Post != nil && name == "%"
+		case *ast.BindExpr:
+			found = found || node.Ident.Name == name
+		case *ast.DefExpr:
+			found = found || node.Ident.Name == name
+		case *ast.DefnExpr:
+			found = found || node.Ident.Name == name
+		case *ast.RequireSpec:
+			// The names referred to by :refer :all are not known.
+			found = found || node.ReferAll
+			for _, ident := range node.Refer {
+				found = found || ident.Name == name
+			}
+		}
+		return !found
+	}
+	for _, b := range n.Bindings[i:] {
+		ast.Inspect(b, check)
+	}
+	ast.Inspect(n.Body, check)
+	return found
+}
+
+// defines reports whether expr contains a def, defn or require.
+func defines(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(node ast.Expr) bool {
+		switch node.(type) {
+		case *ast.DefExpr, *ast.DefnExpr, *ast.RequireExpr:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,109 @@
+package optimize
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+func sexpr(t *testing.T, expr ast.Expr) string {
+	var b bytes.Buffer
+	if err := ast.Fprint(&b, expr, &ast.PrintOptions{Mode: ast.SExprMode, Width: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		src, expect string
+	}{
+		{"(* 60 60 24)", "86400"},
+		{"(+ 1/2 0.5 (- 3))", "-2.0"},
+		{"(fn [x] (* x (* 60 60)))", "(fn [x] (* x 3600))"},
+		{"(< 1 2 )", "true"},
+		{`(= "a" "a")`, "true"},
+		{"(if (> 1 2) 1 b)", "b"},
+		{"(if (= 1 1) (+ 1 1) \"b\")", "2"},
+		// Dropping a name could hide that it's undefined.
+		{"(if (> 1 2) a b)", "(if false a b)"},
+		{"(if x 1 2)", "(if x 1 2)"},
+		{"(if nil 1 2)", "(if nil 1 2)"},
+		{"(/ 1 0)", "(/ 1 0)"},
+		{"(+ 1 (/ 1 0))", "(+ 1 (/ 1 0))"},
+		{"(do 1 (do 2 3) (do (do 4)))", "(do 1 2 3 4)"},
+		{"(do (do) 1)", "1"},
+		{"(do 1 (do))", "(do 1 (do))"},
+		{"(do (f))", "(f)"},
+		{"(let [a 1 b 2] (+ a 3))", "4"},
+		{"(let [a 1 b (f)] a)", "(let [b (f)] 1)"},
+		{"(let [a 1 b a a 2] (+ a b))", "(let [a 1 b a] (+ 2 b))"},
+		{"(let [a 1 a 2] a)", "2"},
+		{"(let [a 1] 2)", "2"},
+		{"(let [a 1] (def b 2))", "(let [a 1] (def b 2))"},
+		{"(let [a (f) b 2] (fn [b] (+ a b)))", "(let [a (f)] (fn [b] (+ a b)))"},
+		{"(let [a 2] (fn [x] (* a x)))", "(fn [x] (* 2 x))"},
+		{"((fn [x y] (+ x y)) 1 2)", "3"},
+		{"((fn [x y] (+ x y)) (f) 2)", "(let [x (f)] (+ x 2))"},
+		{"((fn [] (* 2 3)))", "6"},
+		{"((fn [x y] x) 1 x)", "((fn [x y] x) 1 x)"},
+		{"((fn [x] (g x)) 1)", "((fn [x] (g x)) 1)"},
+		{"((fn [^Int x] x) 1)", "((fn [^Int x] x) 1)"},
+		{"((fn [] (def y 1)))", "((fn [] (def y 1)))"},
+	}
+	for _, test := range tests {
+		expr, err := parser.ParseExpr([]byte(test.src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", test.src, err)
+		}
+		before := sexpr(t, expr)
+		if got := sexpr(t, Expr(expr)); got != test.expect {
+			t.Errorf("%s: expect %s, got %s", test.src, test.expect, got)
+		}
+		if after := sexpr(t, expr); after != before {
+			t.Errorf("%s: the original tree was changed to %s", test.src, after)
+		}
+	}
+}
+
+func TestSemantics(t *testing.T) {
+	srcs := []string{
+		"(defn f [n] (if (= n 0) (* 2 3 4) (+ n (f (- n 1))))) (f 10)",
+		"(let [a 1 b 2] (do (do a) ((fn [x y] (* x y)) a 5)))",
+		"(defn g [] (/ 1 0)) (g)",
+		"(if (< 1 2) (first []) 0)",
+		"((fn [x] (if x 1 2)) 3)",
+		"(fn [] (if true 1 undefined-name))",
+		// The errors of contracts report the conditions as written.
+		`(assert (= 1 2) "nope")`,
+		"(let [x 1] (assert (< x (- 2 2))))",
+		"((fn [x] {:pre [(< x (+ 1 1))]} x) 5)",
+		"((fn [x] {:post [(= % (* 2 3))]} x) 5)",
+	}
+	for _, src := range srcs {
+		exprs, err := parser.ParseExprs([]byte(src))
+		if err != nil {
+			t.Fatalf("parse %q: %v", src, err)
+		}
+		expect, expectErr := eval(exprs)
+		got, gotErr := eval(Exprs(exprs))
+		if got != expect || gotErr != expectErr {
+			t.Errorf("%s: expect %s %q, got %s %q", src, expect, expectErr, got, gotErr)
+		}
+	}
+}
+
+func eval(exprs []ast.Expr) (string, string) {
+	sc := ast.NewGlobalScope()
+	var res *ast.Object
+	for _, expr := range exprs {
+		var err error
+		if res, err = expr.Eval(sc); err != nil {
+			return "", err.Error()
+		}
+	}
+	return res.String(), ""
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/easonliao/gofp/ast"
 	"github.com/easonliao/gofp/scanner"
@@ -17,10 +19,43 @@ func ParseExpr(src []byte) (ast.Expr, error) {
 	return expr, p.err
 }
 
+// ParseExprs parses all the expressions in src.
+func ParseExprs(src []byte) ([]ast.Expr, error) {
+	var p parser
+	p.init(src)
+	exprs := make([]ast.Expr, 0)
+	for p.err == nil && p.tok != token.EOF {
+		exprs = append(exprs, p.parseExpr())
+	}
+	return exprs, p.err
+}
+
+// Error is a syntax error at the position of the offending token. Incomplete is set if the source
+// ends in the middle of an expression, so that more input could complete it.
+type Error struct {
+	Pos        token.Position
+	Msg        string
+	Incomplete bool
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// IsIncomplete reports whether err is a syntax error caused by incomplete input.
+func IsIncomplete(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Incomplete
+}
+
 type parser struct {
 	sc  scanner.Scanner
 	tok token.Token
 	lit string
+	pos token.Position // Position of tok.
 	err error
 }
 
@@ -33,6 +68,7 @@ func (p *parser) parseExpr() ast.Expr {
 	if p.err != nil {
 		return nil
 	}
+	pos := p.pos
 	if p.tok == token.LPAREN {
 		// If an expression starts with '(' it's a function call unless the first token after '(' is
 		// a keyword like 'if', 'fn', 'do', 'def'.
@@ -40,40 +76,61 @@ func (p *parser) parseExpr() ast.Expr {
 		p.next()
 		switch p.tok {
 		case token.FN:
-			return p.parseFun()
+			return p.parseFun(pos)
 		case token.IF:
-			return p.parseIf()
+			return p.parseIf(pos)
 		case token.DO:
-			return p.parseDoBlock()
+			return p.parseDoBlock(pos)
 		case token.DEF:
-			return p.parseDef()
-		case token.DEFN:
-			return p.parseDefn()
+			return p.parseDef(pos)
+		case token.DEFN, token.DEFN_PRIV:
+			return p.parseDefn(pos)
 		case token.LET:
-			return p.parseLet()
+			return p.parseLet(pos)
+		case token.LAZY_SEQ:
+			return p.parseLazySeq(pos)
+		case token.ASSERT:
+			return p.parseAssert(pos)
+		case token.NS:
+			return p.parseNs(pos)
+		case token.REQUIRE:
+			return p.parseRequire(pos)
 		case token.ADD, token.SUB, token.MULT, token.DIV:
-			return p.parseMultiOp()
+			return p.parseMultiOp(pos)
 		case token.LT, token.GT, token.LE, token.GE, token.EQ:
-			return p.parseBinaryOp()
+			return p.parseBinaryOp(pos)
 		case token.IDENT, token.LPAREN:
 			// It's a function call.
-			return p.parseCallExpr()
+			return p.parseCallExpr(pos)
 		}
 	} else {
 		// The first token of an expression is not '(', it can only be num or identifier.
 		switch p.tok {
 		case token.NUM:
 			return p.parseNum()
+		case token.STRING:
+			return p.parseString()
+		case token.LBRACK:
+			return p.parseVector()
 		case token.IDENT:
 			return p.parseIdent()
 		case token.TRUE:
 			p.next()
-			return &ast.BooleanExpr{Bool: true}
+			return &ast.BooleanExpr{Position: pos, Bool: true}
 		case token.FALSE:
 			p.next()
-			return &ast.BooleanExpr{Bool: false}
+			return &ast.BooleanExpr{Position: pos, Bool: false}
+		case token.NIL:
+			p.next()
+			return &ast.NilExpr{Position: pos}
 		case token.EOF:
-			return &ast.NilExpr{}
+			return &ast.NilExpr{Position: pos}
+		}
+		if p.tok.IsOperator() {
+			// Outside of call position an operator is a symbol referring to its builtin function.
+			ident := &ast.IdentExpr{Position: pos, Name: p.lit}
+			p.next()
+			return ident
 		}
 	}
 	p.errorf("unexpected token %s", token.TokenName(p.tok))
@@ -84,41 +141,178 @@ func (p *parser) parseIdent() *ast.IdentExpr {
 	if p.err != nil {
 		return nil
 	}
-	lit := p.lit
+	lit, pos := p.lit, p.pos
 	p.match(token.IDENT)
-	return &ast.IdentExpr{Name: lit}
+	return &ast.IdentExpr{Position: pos, Name: lit}
 }
 
 func (p *parser) parseNum() ast.Expr {
 	if p.err != nil {
 		return nil
 	}
-	lit := p.lit
+	lit, pos := p.lit, p.pos
 	p.match(token.NUM)
-	value, err := strconv.ParseFloat(lit, 64)
+	kind, value, err := parseNumLit(lit)
+	if err != nil {
+		p.errorAt(pos, "%s", err)
+		return nil
+	}
+	return &ast.NumExpr{Position: pos, Kind: kind, Value: value}
+}
+
+// parseNumLit converts a numeric literal accepted by the scanner into its value. Integers which
+// don't fit in an int64 become big integers, and ratios with denominator 1 become integers.
+func parseNumLit(lit string) (ast.ObjKind, interface{}, error) {
+	lit = strings.Replace(lit, "_", "", -1)
+	base := 10
+	if isPrefixedInt(lit) {
+		base = 0
+	}
+	if strings.HasSuffix(lit, "N") {
+		v, ok := new(big.Int).SetString(lit[:len(lit)-1], base)
+		if !ok {
+			return ast.Bad, nil, fmt.Errorf("invalid big integer literal %q", lit)
+		}
+		return ast.BigInt, v, nil
+	}
+	if strings.Contains(lit, "/") {
+		v, ok := new(big.Rat).SetString(lit)
+		if !ok {
+			return ast.Bad, nil, fmt.Errorf("invalid ratio literal %q", lit)
+		}
+		if !v.IsInt() {
+			return ast.Ratio, v, nil
+		}
+		if v.Num().IsInt64() {
+			return ast.Int, v.Num().Int64(), nil
+		}
+		return ast.BigInt, new(big.Int).Set(v.Num()), nil
+	}
+	if base == 10 && strings.ContainsAny(lit, ".eE") {
+		v, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return ast.Bad, nil, fmt.Errorf("invalid floating point literal %q", lit)
+		}
+		return ast.Double, v, nil
+	}
+	if v, err := strconv.ParseInt(lit, base, 64); err == nil {
+		return ast.Int, v, nil
+	}
+	v, ok := new(big.Int).SetString(lit, base)
+	if !ok {
+		return ast.Bad, nil, fmt.Errorf("invalid integer literal %q", lit)
+	}
+	return ast.BigInt, v, nil
+}
+
+// isPrefixedInt reports whether lit is a hexadecimal, octal or binary integer literal.
+func isPrefixedInt(lit string) bool {
+	lit = strings.TrimLeft(lit, "+-")
+	return len(lit) > 1 && lit[0] == '0' && strings.ContainsRune("xXoObB", rune(lit[1]))
+}
+
+func (p *parser) parseString() ast.Expr {
+	if p.err != nil {
+		return nil
+	}
+	lit, pos := p.lit, p.pos
+	p.match(token.STRING)
+	// Strings may span lines, like docstrings.
+	value, err := strconv.Unquote(strings.Replace(lit, "\n", `\n`, -1))
 	if err != nil {
-		p.errorf(err.Error())
+		p.errorAt(pos, "invalid string literal %s", lit)
 		return nil
 	}
-	return &ast.NumExpr{Value: value}
+	return &ast.StringExpr{Position: pos, Value: value}
+}
+
+func (p *parser) parseVector() *ast.VectorExpr {
+	if p.err != nil {
+		return nil
+	}
+	pos := p.pos
+	p.match(token.LBRACK)
+	exprs := p.parseExprList()
+	p.match(token.RBRACK)
+	return &ast.VectorExpr{Position: pos, Exprs: exprs}
 }
 
-func (p *parser) parseFun() ast.Expr {
+func (p *parser) parseFun(pos token.Position) ast.Expr {
 	if p.err != nil {
 		return nil
 	}
-	parameters := make([]*ast.IdentExpr, 0)
 	p.match(token.FN)
+	fn := p.parseParams(pos)
+	fn.Expr = p.parseExpr()
+	return fn
+}
+
+// parseParams parses the parameter vector of a function and the type hint of its result:
+// [^Tag1 param1 param2 ...] ^Tag.
+func (p *parser) parseParams(pos token.Position) *ast.FuncExpr {
+	fn := &ast.FuncExpr{Position: pos, Params: make([]*ast.IdentExpr, 0)}
 	p.match(token.LBRACK)
-	for p.tok == token.IDENT && p.err == nil {
-		parameters = append(parameters, p.parseIdent())
+	for (p.tok == token.IDENT || p.tok == token.CARET) && p.err == nil {
+		tag := p.parseHint()
+		if tag != "" && fn.ParamTags == nil {
+			fn.ParamTags = make([]string, len(fn.Params), len(fn.Params)+1)
+		}
+		if fn.ParamTags != nil {
+			fn.ParamTags = append(fn.ParamTags, tag)
+		}
+		fn.Params = append(fn.Params, p.parseIdent())
 	}
 	p.match(token.RBRACK)
-	body := p.parseExpr()
-	return &ast.FuncExpr{Params: parameters, Expr: body}
+	fn.ResultTag = p.parseHint()
+	p.parseConditions(fn)
+	return fn
+}
+
+// parseConditions parses the optional condition map of a function: {:pre [conds*] :post [conds*]}.
+func (p *parser) parseConditions(fn *ast.FuncExpr) {
+	if p.err != nil || p.tok != token.LBRACE {
+		return
+	}
+	p.next()
+	for p.err == nil && p.tok != token.RBRACE {
+		key, keyPos := p.lit, p.pos
+		p.match(token.IDENT)
+		if p.err != nil {
+			return
+		}
+		var conds *ast.ExprList
+		if p.tok == token.LBRACK {
+			conds = p.parseVector().Exprs
+		} else {
+			p.errorf("Expecting a vector of conditions after %s while get %s", key, token.TokenName(p.tok))
+		}
+		switch key {
+		case ":pre":
+			fn.Pre, fn.PreSource = conds, sources(conds)
+		case ":post":
+			fn.Post, fn.PostSource = conds, sources(conds)
+		default:
+			p.errorAt(keyPos, "unknown condition %s, expect :pre or :post", key)
+		}
+	}
+	p.match(token.RBRACE)
 }
 
-func (p *parser) parseIf() *ast.IfExpr {
+// parseHint parses an optional type hint ^Tag and returns the tag.
+func (p *parser) parseHint() string {
+	if p.err != nil || p.tok != token.CARET {
+		return ""
+	}
+	p.next()
+	tag, pos := p.lit, p.pos
+	p.match(token.IDENT)
+	if p.err == nil && !ast.IsHint(tag) {
+		p.errorAt(pos, "unknown type hint ^%s, expect one of %s", tag, strings.Join(ast.Hints(), ", "))
+	}
+	return tag
+}
+
+func (p *parser) parseIf(pos token.Position) *ast.IfExpr {
 	if p.err != nil {
 		return nil
 	}
@@ -126,63 +320,198 @@ func (p *parser) parseIf() *ast.IfExpr {
 	cond := p.parseExpr()
 	then := p.parseExpr()
 	else_ := p.parseExpr()
-	return &ast.IfExpr{Cond: cond, Then: then, Else: else_}
+	return &ast.IfExpr{Position: pos, Cond: cond, Then: then, Else: else_}
+}
+
+func (p *parser) parseLazySeq(pos token.Position) *ast.LazySeqExpr {
+	if p.err != nil {
+		return nil
+	}
+	p.match(token.LAZY_SEQ)
+	return &ast.LazySeqExpr{Position: pos, Body: p.parseExpr()}
+}
+
+func (p *parser) parseAssert(pos token.Position) *ast.AssertExpr {
+	if p.err != nil {
+		return nil
+	}
+	p.match(token.ASSERT)
+	expr := &ast.AssertExpr{Position: pos, Cond: p.parseExpr()}
+	if expr.Cond != nil {
+		expr.Source = ast.SourceText(expr.Cond)
+	}
+	if p.canStartExpr() {
+		expr.Msg = p.parseExpr()
+	}
+	return expr
+}
+
+// sources returns the texts of conditions, taken as they are written since the conditions may be
+// optimized before they are checked.
+func sources(conds *ast.ExprList) []string {
+	if conds == nil {
+		return nil
+	}
+	res := make([]string, len(conds.Exprs))
+	for i, cond := range conds.Exprs {
+		if cond != nil {
+			res[i] = ast.SourceText(cond)
+		}
+	}
+	return res
 }
 
-func (p *parser) parseCallExpr() *ast.CallExpr {
+func (p *parser) parseCallExpr(pos token.Position) *ast.CallExpr {
 	if p.err != nil {
 		return nil
 	}
 	fun := p.parseExpr()
 	args := p.parseExprList()
-	return &ast.CallExpr{Fun: fun, Args: args}
+	return &ast.CallExpr{Position: pos, Fun: fun, Args: args}
 }
 
-func (p *parser) parseDoBlock() *ast.DoExpr {
+func (p *parser) parseDoBlock(pos token.Position) *ast.DoExpr {
 	if p.err != nil {
 		return nil
 	}
 	p.match(token.DO)
 	exprs := p.parseExprList()
-	return &ast.DoExpr{Exprs: exprs}
+	return &ast.DoExpr{Position: pos, Exprs: exprs}
 }
 
 func (p *parser) parseExprList() *ast.ExprList {
+	pos := p.pos
 	exprs := make([]ast.Expr, 0)
 	for p.err == nil && p.canStartExpr() {
 		exprs = append(exprs, p.parseExpr())
 	}
-	return &ast.ExprList{Exprs: exprs}
+	return &ast.ExprList{Position: pos, Exprs: exprs}
 }
 
-func (p *parser) parseDef() *ast.DefExpr {
+func (p *parser) parseDef(pos token.Position) *ast.DefExpr {
 	if p.err != nil {
 		return nil
 	}
 	p.match(token.DEF)
-	ident := p.parseIdent()
-	expr := p.parseExpr()
-	return &ast.DefExpr{Ident: ident, Expr: expr}
+	def := &ast.DefExpr{Position: pos, Meta: p.parseMeta()}
+	def.Ident = p.parseIdent()
+	def.Expr = p.parseExpr()
+	if str, ok := def.Expr.(*ast.StringExpr); ok && p.canStartExpr() {
+		// The string was the docstring, followed by the value.
+		def.Doc, def.Expr = str.Value, p.parseExpr()
+	}
+	return def
 }
 
-func (p *parser) parseDefn() *ast.DefnExpr {
+// parseMeta parses the optional metadata map of a definition: ^{:key value ...}.
+func (p *parser) parseMeta() []*ast.MetaEntry {
+	if p.err != nil || p.tok != token.CARET {
+		return nil
+	}
+	p.next()
+	p.match(token.LBRACE)
+	meta := make([]*ast.MetaEntry, 0)
+	for p.err == nil && p.tok != token.RBRACE {
+		entry := &ast.MetaEntry{Position: p.pos, Key: p.lit}
+		p.match(token.IDENT)
+		if p.err == nil && !strings.HasPrefix(entry.Key, ":") {
+			p.errorAt(entry.Position, "metadata key %s must start with :", entry.Key)
+		}
+		entry.Value = p.parseExpr()
+		meta = append(meta, entry)
+	}
+	p.match(token.RBRACE)
+	return meta
+}
+
+// parseDoc parses an optional docstring.
+func (p *parser) parseDoc() string {
+	if p.err != nil || p.tok != token.STRING {
+		return ""
+	}
+	if str, ok := p.parseString().(*ast.StringExpr); ok {
+		return str.Value
+	}
+	return ""
+}
+
+func (p *parser) parseDefn(pos token.Position) *ast.DefnExpr {
 	if p.err != nil {
 		return nil
 	}
-	p.match(token.DEFN)
-	ident := p.parseIdent()
-	p.match(token.LBRACK)
-	parameters := make([]*ast.IdentExpr, 0)
-	for p.tok == token.IDENT && p.err == nil {
-		parameters = append(parameters, p.parseIdent())
+	defn := &ast.DefnExpr{Position: pos, Private: p.tok == token.DEFN_PRIV}
+	p.next()
+	defn.Meta = p.parseMeta()
+	defn.Ident = p.parseIdent()
+	defn.Doc = p.parseDoc()
+	fnExpr := p.parseParams(pos)
+	fnExpr.Expr = p.parseExpr()
+	defn.Expr = fnExpr
+	return defn
+}
+
+func (p *parser) parseNs(pos token.Position) *ast.NsExpr {
+	if p.err != nil {
+		return nil
 	}
-	p.match(token.RBRACK)
-	body := p.parseExpr()
-	fnExpr := &ast.FuncExpr{Params: parameters, Expr: body}
-	return &ast.DefnExpr{Ident: ident, Expr: fnExpr}
+	p.match(token.NS)
+	ns := &ast.NsExpr{Position: pos, Name: p.parseIdent()}
+	ns.Doc = p.parseDoc()
+	return ns
 }
 
-func (p *parser) parseBinaryOp() *ast.BinaryOp {
+// parseRequire parses the quoted module specs of require: 'name or '[name :as alias :refer [names]],
+// :refer :all refers to all the names of the module.
+func (p *parser) parseRequire(pos token.Position) *ast.RequireExpr {
+	if p.err != nil {
+		return nil
+	}
+	p.match(token.REQUIRE)
+	expr := &ast.RequireExpr{Position: pos}
+	for p.err == nil && p.tok != token.RPAREN {
+		p.match(token.QUOTE)
+		if p.err != nil {
+			break
+		}
+		spec := &ast.RequireSpec{Position: p.pos}
+		if p.tok != token.LBRACK {
+			spec.Module = p.parseIdent()
+			expr.Specs = append(expr.Specs, spec)
+			continue
+		}
+		p.next()
+		spec.Module = p.parseIdent()
+		for p.err == nil && p.tok != token.RBRACK {
+			key, keyPos := p.lit, p.pos
+			p.match(token.IDENT)
+			switch {
+			case p.err != nil:
+			case key == ":as":
+				spec.Alias = p.parseIdent()
+			case key == ":refer" && p.tok == token.IDENT && p.lit == ":all":
+				spec.ReferAll = true
+				p.next()
+			case key == ":refer":
+				p.match(token.LBRACK)
+				spec.Refer = make([]*ast.IdentExpr, 0)
+				for p.err == nil && p.tok == token.IDENT {
+					spec.Refer = append(spec.Refer, p.parseIdent())
+				}
+				p.match(token.RBRACK)
+			default:
+				p.errorAt(keyPos, "unknown require option %s, expect :as or :refer", key)
+			}
+		}
+		p.match(token.RBRACK)
+		expr.Specs = append(expr.Specs, spec)
+	}
+	if p.err == nil && len(expr.Specs) == 0 {
+		p.errorf("require expects module specs")
+	}
+	return expr
+}
+
+func (p *parser) parseBinaryOp(pos token.Position) *ast.BinaryOp {
 	if p.err != nil {
 		return nil
 	}
@@ -190,21 +519,28 @@ func (p *parser) parseBinaryOp() *ast.BinaryOp {
 	p.next()
 	left := p.parseExpr()
 	right := p.parseExpr()
-	return &ast.BinaryOp{Op: op, Left: left, Right: right}
+	return &ast.BinaryOp{Position: pos, Op: op, Left: left, Right: right}
 }
 
-func (p *parser) parseMultiOp() *ast.MultiOp {
+func (p *parser) parseMultiOp(pos token.Position) *ast.MultiOp {
 	if p.err != nil {
 		return nil
 	}
 	op := p.tok
 	p.next()
 	exprs := p.parseExprList()
-	return &ast.MultiOp{Op: op, Exprs: exprs}
+	return &ast.MultiOp{Position: pos, Op: op, Exprs: exprs}
 }
 
 func (p *parser) next() {
-	p.tok, p.lit, p.err = p.sc.Next()
+	var err error
+	p.tok, p.lit, err = p.sc.Next()
+	p.pos = p.sc.Pos()
+	if e, ok := err.(*scanner.Error); ok {
+		p.err = &Error{Pos: e.Pos, Msg: e.Msg}
+	} else if err != nil {
+		p.err = &Error{Pos: p.pos, Msg: err.Error(), Incomplete: err == scanner.ErrUnterminated}
+	}
 }
 
 func (p *parser) match(tok token.Token) {
@@ -218,7 +554,7 @@ func (p *parser) match(tok token.Token) {
 	p.next()
 }
 
-func (p *parser) parseLet() *ast.LetExpr {
+func (p *parser) parseLet(pos token.Position) *ast.LetExpr {
 	if p.err != nil {
 		return nil
 	}
@@ -230,23 +566,37 @@ func (p *parser) parseLet() *ast.LetExpr {
 		bindings = append(bindings, p.parseBindingPair())
 	}
 	p.match(token.RBRACK)
-	return &ast.LetExpr{Bindings: bindings, Body: p.parseExpr()}
+	return &ast.LetExpr{Position: pos, Bindings: bindings, Body: p.parseExpr()}
 }
 
 func (p *parser) parseBindingPair() *ast.BindExpr {
+	if p.err != nil {
+		return nil
+	}
 	ident := p.parseIdent()
 	expr := p.parseExpr()
-	return &ast.BindExpr{Ident: ident, Value: expr}
+	return &ast.BindExpr{Position: ident.Position, Ident: ident, Value: expr}
 }
 
 // check whether current token can be a start of an expression.
 func (p *parser) canStartExpr() bool {
-	if p.tok == token.LPAREN || p.tok == token.IDENT || p.tok == token.NUM {
+	switch p.tok {
+	case token.LPAREN, token.LBRACK, token.IDENT, token.NUM, token.STRING, token.TRUE, token.FALSE, token.NIL:
 		return true
 	}
-	return false
+	return p.tok.IsOperator()
 }
 
+// errorf reports a syntax error at the current token.
 func (p *parser) errorf(format string, a ...interface{}) {
-	p.err = fmt.Errorf(format, a...)
+	p.errorAt(p.pos, format, a...)
+}
+
+// errorAt reports a syntax error at pos, for a token already matched. Only the first error is
+// kept.
+func (p *parser) errorAt(pos token.Position, format string, a ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	p.err = &Error{Pos: pos, Msg: fmt.Sprintf(format, a...), Incomplete: p.tok == token.EOF}
 }
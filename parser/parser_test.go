@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/easonliao/gofp/ast"
 )
 
 func TestParser(t *testing.T) {
@@ -38,3 +42,129 @@ func TestParser(t *testing.T) {
 		t.Error("error")
 	}
 }
+
+func TestParseHints(t *testing.T) {
+	expr, err := ParseExpr([]byte("(defn area [^Double w h] ^Number (* w h))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := expr.(*ast.DefnExpr).Expr.(*ast.FuncExpr)
+	if len(fn.Params) != 2 || fmt.Sprint(fn.ParamTags) != "[Double ]" || fn.ResultTag != "Number" {
+		t.Errorf("unexpected hints %q %q", fn.ParamTags, fn.ResultTag)
+	}
+	expr, err = ParseExpr([]byte("(fn [x y] x)"))
+	if err != nil || expr.(*ast.FuncExpr).ParamTags != nil {
+		t.Errorf("expect no hints, got %v %v", expr, err)
+	}
+	expr, err = ParseExpr([]byte("(fn [x] ^Int {:pre [(> x 0) x] :post [(< % x)]} (- x 1))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn := expr.(*ast.FuncExpr); fn.Pre == nil || len(fn.Pre.Exprs) != 2 || fn.Post == nil || len(fn.Post.Exprs) != 1 {
+		t.Errorf("unexpected conditions %v %v", fn.Pre, fn.Post)
+	}
+	for _, src := range []string{"(fn [^Foo x] x)", "(fn [^Int] 1)", "(fn [x] ^ 1)", "(fn [x] {:pre x} x)", "(fn [x] {:when [x]} x)", "(assert)"} {
+		if _, err := ParseExpr([]byte(src)); err == nil {
+			t.Errorf("%s: expect an error", src)
+		}
+	}
+}
+
+func TestParseDoc(t *testing.T) {
+	expr, err := ParseExpr([]byte("(defn ^{:added 2} f \"Doubles\n  x.\" [x] (* x 2))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defn := expr.(*ast.DefnExpr)
+	if defn.Doc != "Doubles\n  x." || len(defn.Meta) != 1 || defn.Meta[0].Key != ":added" {
+		t.Errorf("unexpected docstring %q and metadata %v", defn.Doc, defn.Meta)
+	}
+	// A string alone is the value of def, not its docstring.
+	expr, err = ParseExpr([]byte(`(def s "value")`))
+	if err != nil || expr.(*ast.DefExpr).Doc != "" {
+		t.Errorf("expect no docstring, got %v %v", expr, err)
+	}
+	expr, err = ParseExpr([]byte(`(def s "doc" "value")`))
+	if err != nil || expr.(*ast.DefExpr).Doc != "doc" {
+		t.Errorf("expect the docstring doc, got %v %v", expr, err)
+	}
+	for _, src := range []string{"(def ^{added 2} x 1)", "(def ^{:added} x 1)", "(defn ^Int f [] 1)", "(defn f \"doc\")"} {
+		if _, err := ParseExpr([]byte(src)); err == nil {
+			t.Errorf("%s: expect an error", src)
+		}
+	}
+}
+
+func TestParseNum(t *testing.T) {
+	tests := []struct {
+		src   string
+		kind  ast.ObjKind
+		value string
+	}{
+		{"42", ast.Int, "42"},
+		{"-5", ast.Int, "-5"},
+		{"007", ast.Int, "7"},
+		{"0xFF", ast.Int, "255"},
+		{"0b1010", ast.Int, "10"},
+		{"0o17", ast.Int, "15"},
+		{"1_000_000", ast.Int, "1000000"},
+		{"1e-9", ast.Double, "1e-09"},
+		{"1.5", ast.Double, "1.5"},
+		{"3/4", ast.Ratio, "3/4"},
+		{"4/2", ast.Int, "2"},
+		{"123N", ast.BigInt, "123"},
+		{"99999999999999999999", ast.BigInt, "99999999999999999999"},
+	}
+	for _, test := range tests {
+		expr, err := ParseExpr([]byte(test.src))
+		if err != nil {
+			t.Errorf("parse %q: %v", test.src, err)
+			continue
+		}
+		num := expr.(*ast.NumExpr)
+		if num.Kind != test.kind || fmt.Sprint(num.Value) != test.value {
+			t.Errorf("parse %q: got %s %v", test.src, num.Kind, num.Value)
+		}
+	}
+	if _, err := ParseExpr([]byte("(+ 1.2.3 1)")); err == nil {
+		t.Error("error")
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	for _, src := range []string{"(+ 1 2", "(defn f [x]", "(let [a", "[1 2", "(print \"abc"} {
+		if _, err := ParseExprs([]byte(src)); !IsIncomplete(err) {
+			t.Errorf("%q: expect incomplete, got %v", src, err)
+		}
+	}
+	for _, src := range []string{"(+ 1 2))", "(< 1)", "(def 1 2)", "1.2.3"} {
+		if _, err := ParseExprs([]byte(src)); err == nil || IsIncomplete(err) {
+			t.Errorf("%q: expect syntax error, got %v", src, err)
+		}
+	}
+	exprs, err := ParseExprs([]byte("(def a 1) (+ a 1)\n a"))
+	if err != nil || len(exprs) != 3 {
+		t.Errorf("got %d expressions, %v", len(exprs), err)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		src, expect string
+	}{
+		{"(+ 1 2))", "1:8: unexpected token )"},
+		{"(def x\n  \"a)", "2:3: string literal not terminated"},
+		{"(fn [^Foo x] x)", "1:7: unknown type hint ^Foo, expect one of "},
+		{"(def ^{doc 1} x 1)", "1:8: metadata key doc must start with :"},
+		{"(fn [x] {:pro [x]} x)", "1:10: unknown condition :pro, expect :pre or :post"},
+		{"(require '[a :with b])", "1:14: unknown require option :with, expect :as or :refer"},
+		{"(+ 1 #)", "1:6: unrecognized token #"},
+		{"(+ 1 2..)", "1:6: invalid number literal"},
+	}
+	for _, test := range tests {
+		_, err := ParseExprs([]byte(test.src))
+		if e, ok := err.(*Error); !ok || !strings.HasPrefix(e.Error(), test.expect) {
+			t.Errorf("%q: expect error %q, got %v", test.src, test.expect, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package repl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+)
+
+// command is a meta-command of the REPL, entered as ':name arg'.
+type command struct {
+	usage string
+	help  string
+	// run executes the command and reports whether the REPL should quit.
+	run func(r *REPL, arg string) (bool, error)
+}
+
+var commands map[string]*command
+
+func init() {
+	// Assigned in init since :help refers to the table itself.
+	commands = map[string]*command{
+		"ast":     {":ast on|off|tree|sexpr", "turn printing the AST of expressions on or off, or set its format", cmdAST},
+		"env":     {":env", "list the global bindings with their kinds", cmdEnv},
+		"type":    {":type expr", "infer and print the type of expr without evaluating it", cmdType},
+		"time":    {":time expr", "evaluate expr and print how long it took", cmdTime},
+		"load":    {":load file", "evaluate all the expressions in file", cmdLoad},
+		"reset":   {":reset", "discard all the definitions", cmdReset},
+		"doc":     {":doc name", "show the documentation of a special form or binding", cmdDoc},
+		"history": {":history", "list the input history", cmdHistory},
+		"quit":    {":quit", "leave the REPL", cmdQuit},
+		"help":    {":help", "list the commands", cmdHelp},
+	}
+}
+
+// specialForms documents the forms which are not functions.
+var specialForms = map[string]string{
+	"def":      "(def ^{meta*}? name doc? expr)\n  Binds name to the value of expr in the global scope, with the docstring and metadata map\n  read by doc and meta.",
+	"defn":     "(defn ^{meta*}? name doc? [^Tag? params*] ^Tag? {:pre [conds*] :post [conds*]}? body)\n  Defines a function which may call itself by name. Type hints like ^Double and the conditions\n  are checked on calls, % is the result in post-conditions.",
+	"fn":       "(fn [^Tag? params*] ^Tag? body)\n  Creates a function capturing the names it uses.",
+	"let":      "(let [name expr ...] body)\n  Evaluates body with the names bound in order.",
+	"if":       "(if cond then else)\n  Evaluates then if cond is true, else otherwise.",
+	"do":       "(do exprs*)\n  Evaluates exprs in order and returns the value of the last one.",
+	"lazy-seq": "(lazy-seq body)\n  Returns a sequence which evaluates body the first time it's used.",
+	"assert":   "(assert expr message?)\n  Fails with the source of expr and message if expr is false or nil.",
+	"defn-":    "(defn- name [params*] body)\n  Defines a function like defn which other modules can't use.",
+	"ns":       "(ns name doc?)\n  Names the namespace of the program or module, a module must use the name it's required by.",
+	"require":  "(require '[name :as alias :refer [names*]]*)\n  Loads the modules once from the search path, their names are used as alias/name or\n  name/name, and the names referred to, or all of them with :refer :all, unqualified.",
+}
+
+// runCommand runs a meta-command line and reports whether the REPL should quit.
+func (r *REPL) runCommand(line string) bool {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(r.Out, "unknown command :%s, type :help for the list of commands\n", name)
+		return false
+	}
+	quit, err := cmd.run(r, arg)
+	if err != nil {
+		fmt.Fprintln(r.Out, err)
+	}
+	return quit
+}
+
+func cmdAST(r *REPL, arg string) (bool, error) {
+	switch arg {
+	case "on":
+		r.ShowAST = true
+	case "off":
+		r.ShowAST = false
+	case "tree":
+		r.ShowAST, r.ASTOptions.Mode = true, ast.TreeMode
+	case "sexpr":
+		r.ShowAST, r.ASTOptions.Mode = true, ast.SExprMode
+	case "":
+		fmt.Fprintf(r.Out, "ast is %s\n", map[bool]string{true: "on", false: "off"}[r.ShowAST])
+	default:
+		return false, fmt.Errorf("usage: %s", commands["ast"].usage)
+	}
+	return false, nil
+}
+
+func cmdEnv(r *REPL, arg string) (bool, error) {
+	names := make([]string, 0, len(r.Scope.Objects))
+	for name := range r.Scope.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintf(r.Out, "%-*s %s\n", width, name, r.Scope.Objects[name].Kind)
+	}
+	return false, nil
+}
+
+// evalArg parses and evaluates the expression given as argument of a command.
+func (r *REPL) evalArg(usage, arg string) (*ast.Object, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("usage: %s", usage)
+	}
+	expr, err := parser.ParseExpr([]byte(arg))
+	if err != nil {
+		return nil, err
+	}
+	return r.eval(expr)
+}
+
+func cmdType(r *REPL, arg string) (bool, error) {
+	if arg == "" {
+		return false, fmt.Errorf("usage: %s", commands["type"].usage)
+	}
+	expr, err := parser.ParseExpr([]byte(arg))
+	if err != nil {
+		return false, err
+	}
+	t, err := r.types.Infer(expr)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintln(r.Out, t)
+	return false, nil
+}
+
+func cmdTime(r *REPL, arg string) (bool, error) {
+	start := time.Now()
+	obj, err := r.evalArg(commands["time"].usage, arg)
+	elapsed := time.Since(start)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintln(r.Out, obj)
+	fmt.Fprintf(r.Out, "Elapsed time: %v\n", elapsed)
+	return false, nil
+}
+
+func cmdLoad(r *REPL, arg string) (bool, error) {
+	if arg == "" {
+		return false, fmt.Errorf("usage: %s", commands["load"].usage)
+	}
+	src, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return false, err
+	}
+	exprs, err := parser.ParseExprs(src)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", arg, err)
+	}
+	res := ast.NilObj
+	for _, expr := range exprs {
+		if res, err = r.eval(expr); err != nil {
+			return false, fmt.Errorf("%s: %v", arg, err)
+		}
+	}
+	fmt.Fprintln(r.Out, res)
+	return false, nil
+}
+
+func cmdReset(r *REPL, arg string) (bool, error) {
+	r.reset()
+	return false, nil
+}
+
+func cmdDoc(r *REPL, arg string) (bool, error) {
+	if arg == "" {
+		return false, fmt.Errorf("usage: %s", commands["doc"].usage)
+	}
+	if doc, ok := specialForms[arg]; ok {
+		fmt.Fprintf(r.Out, "%s\n  Special form.\n", doc)
+		return false, nil
+	}
+	obj := r.Scope.Lookup(arg)
+	if obj == nil {
+		return false, fmt.Errorf("%q is not defined.", arg)
+	}
+	fmt.Fprint(r.Out, ast.Doc(arg, obj))
+	return false, nil
+}
+
+func cmdHistory(r *REPL, arg string) (bool, error) {
+	for i, line := range r.ed.History() {
+		fmt.Fprintf(r.Out, "%4d  %s\n", i+1, line)
+	}
+	return false, nil
+}
+
+func cmdQuit(r *REPL, arg string) (bool, error) {
+	return true, nil
+}
+
+func cmdHelp(r *REPL, arg string) (bool, error) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.Out, "%-24s %s\n", commands[name].usage, commands[name].help)
+	}
+	return false, nil
+}
@@ -0,0 +1,475 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// maxHistory is the number of lines kept in the history.
+const maxHistory = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEsc       = 27
+	keyBackspace = 127
+)
+
+// Keys sent as escape sequences are mapped to runes in the private use area.
+const (
+	keyUp = 0xE000 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// Editor reads lines from a terminal with cursor movement, history browsing, reverse search, paren
+// matching and tab completion. If the input is not a terminal, lines are read as they are.
+type Editor struct {
+	// Complete returns the candidates for completing the word ending at pos in line, and the
+	// position where the word starts.
+	Complete func(line string, pos int) (start int, candidates []string)
+
+	in      *os.File
+	out     io.Writer
+	r       *bufio.Reader
+	history []string
+}
+
+// NewEditor creates an editor reading from in and echoing to out.
+func NewEditor(in *os.File, out io.Writer) *Editor {
+	return &Editor{in: in, out: out, r: bufio.NewReader(in)}
+}
+
+// IsTerminal reports whether the editor reads from a terminal and supports line editing.
+func (e *Editor) IsTerminal() bool {
+	return isTerminal(e.in.Fd())
+}
+
+// editingUnsupported reports whether the editor reads from a terminal on a platform where line
+// editing isn't supported, so lines are read as they are.
+func (e *Editor) editingUnsupported() bool {
+	if editingSupported {
+		return false
+	}
+	fi, err := e.in.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// History returns the lines in the history, oldest first.
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// AddHistory appends a line to the history, empty lines and repeats of the last line are ignored.
+func (e *Editor) AddHistory(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// LoadHistory appends the lines read from r to the history.
+func (e *Editor) LoadHistory(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		e.AddHistory(s.Text())
+	}
+	return s.Err()
+}
+
+// ReadLine prints the prompt and reads a line, without the trailing newline. It returns io.EOF at
+// the end of input or when Ctrl-D is pressed on an empty line, and ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.IsTerminal() {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	state, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restore(e.in.Fd(), state)
+	return e.edit(prompt)
+}
+
+// lineState is the state of the line being edited.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// histIdx is the index of the history entry shown, len(history) for the new line which is
+	// saved in line while browsing.
+	histIdx int
+	line    []rune
+}
+
+func (e *Editor) edit(prompt string) (string, error) {
+	st := &lineState{prompt: prompt, histIdx: len(e.history)}
+	e.refresh(st)
+	var lastKey rune
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case keyCR, keyLF:
+			e.write("\r\n")
+			return string(st.buf), nil
+		case keyCtrlC:
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(st.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			st.delete(st.pos, st.pos+1)
+		case keyBackspace, keyCtrlH:
+			if st.pos > 0 {
+				st.delete(st.pos-1, st.pos)
+			}
+		case keyDelete:
+			st.delete(st.pos, st.pos+1)
+		case keyLeft, keyCtrlB:
+			if st.pos > 0 {
+				st.pos--
+			}
+		case keyRight, keyCtrlF:
+			if st.pos < len(st.buf) {
+				st.pos++
+			}
+		case keyHome, keyCtrlA:
+			st.pos = 0
+		case keyEnd, keyCtrlE:
+			st.pos = len(st.buf)
+		case keyCtrlK:
+			st.delete(st.pos, len(st.buf))
+		case keyCtrlU:
+			st.delete(0, st.pos)
+		case keyCtrlW:
+			start := st.pos
+			for start > 0 && unicode.IsSpace(st.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(st.buf[start-1]) && !isDelimiter(st.buf[start-1]) {
+				start--
+			}
+			st.delete(start, st.pos)
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyUp, keyCtrlP:
+			e.browseHistory(st, -1)
+		case keyDown, keyCtrlN:
+			e.browseHistory(st, 1)
+		case keyTab:
+			e.complete(st, lastKey == keyTab)
+		case keyCtrlR:
+			if done := e.reverseSearch(st); done {
+				e.write("\r\n")
+				return string(st.buf), nil
+			}
+		case keyEsc, keyUnknown, keyCtrlG:
+			// Ignored.
+		default:
+			if unicode.IsPrint(key) {
+				st.insert(key)
+			}
+		}
+		lastKey = key
+		e.refresh(st)
+	}
+}
+
+func (st *lineState) insert(r rune) {
+	st.buf = append(st.buf, 0)
+	copy(st.buf[st.pos+1:], st.buf[st.pos:])
+	st.buf[st.pos] = r
+	st.pos++
+}
+
+// delete removes the runes in buf[from:to] and moves the cursor to from.
+func (st *lineState) delete(from, to int) {
+	if to > len(st.buf) {
+		to = len(st.buf)
+	}
+	if from >= to {
+		return
+	}
+	st.buf = append(st.buf[:from], st.buf[to:]...)
+	st.pos = from
+}
+
+func (st *lineState) set(line []rune) {
+	st.buf = append([]rune(nil), line...)
+	st.pos = len(st.buf)
+}
+
+func (e *Editor) browseHistory(st *lineState, delta int) {
+	idx := st.histIdx + delta
+	if idx < 0 || idx > len(e.history) {
+		return
+	}
+	if st.histIdx == len(e.history) {
+		st.line = append([]rune(nil), st.buf...)
+	}
+	st.histIdx = idx
+	if idx == len(e.history) {
+		st.set(st.line)
+	} else {
+		st.set([]rune(e.history[idx]))
+	}
+}
+
+// complete completes the word before the cursor. If the candidates share no longer prefix and the
+// tab key was pressed twice, they are listed.
+func (e *Editor) complete(st *lineState, list bool) {
+	if e.Complete == nil {
+		return
+	}
+	before := string(st.buf[:st.pos])
+	start, candidates := e.Complete(string(st.buf), len(before))
+	if len(candidates) == 0 {
+		e.write("\a")
+		return
+	}
+	word := []rune(before[start:])
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, []rune(c))
+	}
+	if len(prefix) > len(word) {
+		st.delete(st.pos-len(word), st.pos)
+		for _, r := range prefix {
+			st.insert(r)
+		}
+		return
+	}
+	if len(candidates) == 1 {
+		return
+	}
+	if !list {
+		e.write("\a")
+		return
+	}
+	e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+}
+
+func commonPrefix(a, b []rune) []rune {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// reverseSearch searches the history backward incrementally as the user types. It reports true if
+// the line was accepted with enter, otherwise the match found is left in the line for editing.
+func (e *Editor) reverseSearch(st *lineState) bool {
+	var query []rune
+	original := append([]rune(nil), st.buf...)
+	idx := len(e.history)
+	match := ""
+	search := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				idx, match = i, e.history[i]
+				return
+			}
+		}
+	}
+	for {
+		e.write(fmt.Sprintf("\r(reverse-i-search)`%s': %s\x1b[K", string(query), match))
+		key, err := e.readKey()
+		if err != nil {
+			return false
+		}
+		switch key {
+		case keyCtrlR:
+			if idx > 0 {
+				search(idx - 1)
+			}
+		case keyBackspace, keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				idx, match = len(e.history), ""
+				search(idx - 1)
+			}
+		case keyCtrlG, keyCtrlC:
+			st.set(original)
+			return false
+		case keyCR, keyLF:
+			st.set([]rune(match))
+			return true
+		default:
+			if unicode.IsPrint(key) && key < keyUp {
+				query = append(query, key)
+				// The current match is kept if it still contains the longer query.
+				if idx == len(e.history) {
+					idx--
+				}
+				search(idx)
+				continue
+			}
+			st.set([]rune(match))
+			return false
+		}
+	}
+}
+
+// readKey reads a key press, escape sequences for cursor keys are decoded.
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.r.ReadRune()
+	if err != nil || r != keyEsc {
+		return r, err
+	}
+	if e.r.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	r, _, err = e.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return keyUnknown, nil
+	}
+	// Control sequence: parameters followed by a final byte in range 0x40 - 0x7e.
+	var params []rune
+	for {
+		r, _, err = e.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params = append(params, r)
+	}
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return keyUnknown, nil
+}
+
+// refresh redraws the line, highlighting the opening paren matching a closing one before the
+// cursor.
+func (e *Editor) refresh(st *lineState) {
+	var b bytes.Buffer
+	b.WriteString("\r")
+	b.WriteString(st.prompt)
+	match := -1
+	if st.pos > 0 {
+		match = matchingParen(st.buf, st.pos-1)
+	}
+	for i, r := range st.buf {
+		if i == match {
+			b.WriteString("\x1b[1;7m")
+			b.WriteRune(r)
+			b.WriteString("\x1b[0m")
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("\x1b[K\r")
+	if n := len([]rune(st.prompt)) + st.pos; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", n)
+	}
+	e.write(b.String())
+}
+
+// matchingParen returns the index of the opening paren matching the closing one at i, or -1.
+func matchingParen(buf []rune, i int) int {
+	var open rune
+	switch buf[i] {
+	case ')':
+		open = '('
+	case ']':
+		open = '['
+	case '}':
+		open = '{'
+	default:
+		return -1
+	}
+	depth := 0
+	for j := i; j >= 0; j-- {
+		switch buf[j] {
+		case buf[i]:
+			depth++
+		case open:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func isDelimiter(r rune) bool {
+	return strings.ContainsRune("()[]{}\"", r)
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
@@ -0,0 +1,187 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/parser"
+	"github.com/easonliao/gofp/token"
+	"github.com/easonliao/gofp/types"
+)
+
+// REPL reads expressions from the user, evaluates them and prints the results.
+type REPL struct {
+	// Scope is where expressions are evaluated, a new one is created by NewScope if it's nil.
+	Scope *ast.Scope
+	// NewScope creates the global scope when the REPL starts or is reset, ast.NewGlobalScope is
+	// used if it's nil.
+	NewScope func() *ast.Scope
+	Out      io.Writer
+	// HistoryFile is where the input history is kept across sessions, no history is saved if it's
+	// empty.
+	HistoryFile string
+	// ShowAST makes the REPL print the AST of every expression before its result.
+	ShowAST bool
+	// ASTOptions controls how the AST is printed.
+	ASTOptions ast.PrintOptions
+	// Limits bounds the evaluation of each expression, nil means the defaults of ast.EvalContext.
+	Limits *ast.Limits
+
+	ed    *Editor
+	types *types.Env
+}
+
+// Run runs the read-eval-print loop on input from in until the end of input or the :quit command.
+func (r *REPL) Run(in *os.File) error {
+	if r.Scope == nil {
+		r.reset()
+	}
+	if r.types == nil {
+		r.types = types.NewEnv()
+	}
+	ed := NewEditor(in, r.Out)
+	ed.Complete = r.complete
+	r.ed = ed
+	if ed.editingUnsupported() {
+		fmt.Fprintln(r.Out, "Line editing is not supported on this platform, lines are read as typed.")
+	}
+	history := r.openHistory(ed)
+	if history != nil {
+		defer history.Close()
+	}
+	// Lines of a form which is not complete yet.
+	var pending []byte
+	for {
+		prompt := ">"
+		if len(pending) > 0 {
+			prompt = "..."
+		}
+		line, err := ed.ReadLine(prompt)
+		if err == ErrInterrupted {
+			pending = pending[:0]
+			continue
+		}
+		if err == io.EOF {
+			if len(pending) > 0 {
+				_, err = parser.ParseExprs(pending)
+				fmt.Fprintln(r.Out, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ed.AddHistory(line)
+		if history != nil && strings.TrimSpace(line) != "" {
+			fmt.Fprintln(history, line)
+		}
+		if len(pending) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.runCommand(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+		pending = append(append(pending, line...), '\n')
+		exprs, err := parser.ParseExprs(pending)
+		if parser.IsIncomplete(err) {
+			// Keep reading continuation lines until the form is complete.
+			continue
+		}
+		pending = pending[:0]
+		if err != nil {
+			fmt.Fprintln(r.Out, err)
+			continue
+		}
+		for _, expr := range exprs {
+			if r.ShowAST {
+				ast.Fprint(r.Out, expr, &r.ASTOptions)
+			}
+			res, err := r.eval(expr)
+			if err != nil {
+				fmt.Fprintln(r.Out, err)
+				break
+			}
+			// The types of the definitions are kept for :type, an expression which can't be typed
+			// leaves its names untyped.
+			r.types.Infer(expr)
+			fmt.Fprintln(r.Out, res)
+		}
+	}
+}
+
+// eval evaluates expr in the scope within the limits, an interrupt stops the evaluation.
+func (r *REPL) eval(expr ast.Expr) (*ast.Object, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return ast.EvalContext(ctx, expr, r.Scope, r.Limits)
+}
+
+// reset replaces the scope with a fresh global scope.
+func (r *REPL) reset() {
+	if r.NewScope != nil {
+		r.Scope = r.NewScope()
+	} else {
+		r.Scope = ast.NewGlobalScope()
+	}
+	r.types = types.NewEnv()
+}
+
+// openHistory loads the history file into the editor and opens it for appending new lines.
+func (r *REPL) openHistory(ed *Editor) *os.File {
+	if r.HistoryFile == "" || !ed.IsTerminal() {
+		return nil
+	}
+	if f, err := os.Open(r.HistoryFile); err == nil {
+		ed.LoadHistory(f)
+		f.Close()
+	}
+	f, err := os.OpenFile(r.HistoryFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// complete returns the names defined in the scope and the special forms starting with the word
+// before pos.
+func (r *REPL) complete(line string, pos int) (int, []string) {
+	start := pos
+	for start > 0 && !strings.ContainsRune(" \t()[]{}\"',", rune(line[start-1])) {
+		start--
+	}
+	word := line[start:pos]
+	seen := make(map[string]bool)
+	var candidates []string
+	add := func(name string) {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	for sc := r.Scope; sc != nil; sc = sc.Outer {
+		for name := range sc.Objects {
+			add(name)
+		}
+	}
+	for _, name := range token.Keywords() {
+		add(name)
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// DefaultHistoryFile returns the path of the history file in the user's home directory.
+func DefaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gofp_history")
+}
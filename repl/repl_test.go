@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/ast"
+)
+
+func TestComplete(t *testing.T) {
+	sc := ast.NewGlobalScope()
+	sc.Insert("reducer", ast.NilObj)
+	r := &REPL{Scope: ast.NewScope(sc)}
+	start, candidates := r.complete("(redu", 5)
+	if start != 1 || !reflect.DeepEqual(candidates, []string{"reduce", "reducer"}) {
+		t.Errorf("got %d %v", start, candidates)
+	}
+	if _, candidates := r.complete("(lazy", 5); !reflect.DeepEqual(candidates, []string{"lazy-seq"}) {
+		t.Errorf("got %v", candidates)
+	}
+}
+
+func TestMatchingParen(t *testing.T) {
+	buf := []rune("(f [1 (g)] 2)")
+	if i := matchingParen(buf, len(buf)-1); i != 0 {
+		t.Errorf("got %d", i)
+	}
+	if i := matchingParen(buf, 9); i != 3 {
+		t.Errorf("got %d", i)
+	}
+	if i := matchingParen(buf, 1); i != -1 {
+		t.Errorf("got %d", i)
+	}
+}
+
+func runInput(t *testing.T, r *REPL, input string) string {
+	in, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+	var out bytes.Buffer
+	r.Out = &out
+	if err := r.Run(in); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestCommands(t *testing.T) {
+	r := &REPL{}
+	out := runInput(t, r, "(def x 1.5)\n:type x\n:env\n:time (+ 1 2)\n:doc if\n:ast on\n:reset\nx\n:history\n:quit\n(+ 5 5)\n")
+	// The kinds printed by :env are aligned after the longest name.
+	width := 0
+	for name := range ast.NewGlobalScope().Objects {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	env := "\nx" + strings.Repeat(" ", width) + "Double\n"
+	for _, s := range []string{">nil\n", ">Num\n", env, "3\nElapsed time: ", "(if cond then else)",
+		"\"x\" is not defined.", "   2  :type x\n"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output doesn't contain %q:\n%s", s, out)
+		}
+	}
+	if !r.ShowAST || strings.Contains(out, "10\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	r := &REPL{Limits: &ast.Limits{MaxSteps: 1000}}
+	out := runInput(t, r, "(defn loop [n] (loop n))\n(loop 1)\n:time (loop 1)\n(+ 1 2)\n")
+	for _, s := range []string{"exceeded the limit of 1000 steps", ">3\n"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output doesn't contain %q:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || netbsd
+// +build darwin dragonfly freebsd netbsd
+
+package repl
+
+import "syscall"
+
+// The requests of ioctl reading and setting the termios of a terminal.
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
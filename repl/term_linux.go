@@ -0,0 +1,9 @@
+package repl
+
+import "syscall"
+
+// The requests of ioctl reading and setting the termios of a terminal.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
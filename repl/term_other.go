@@ -0,0 +1,25 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd
+
+package repl
+
+import "errors"
+
+// editingSupported reports whether terminals can be put in raw mode for line editing.
+const editingSupported = false
+
+type termState struct{}
+
+// isTerminal always reports false on platforms without raw mode support, so the editor falls back
+// to plain line reading.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
+
+func restore(fd uintptr, state *termState) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd
+// +build linux darwin dragonfly freebsd netbsd
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// editingSupported reports whether terminals can be put in raw mode for line editing.
+const editingSupported = true
+
+type termState struct {
+	termios syscall.Termios
+}
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether fd refers to a terminal.
+func isTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, ioctlGetTermios, &t) == nil
+}
+
+// makeRaw puts the terminal into raw mode, so input is read key by key without echo, and returns
+// the previous state to restore.
+func makeRaw(fd uintptr) (*termState, error) {
+	var old termState
+	if err := ioctl(fd, ioctlGetTermios, &old.termios); err != nil {
+		return nil, err
+	}
+	raw := old.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func restore(fd uintptr, state *termState) error {
+	return ioctl(fd, ioctlSetTermios, &state.termios)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/module"
+	"github.com/easonliao/gofp/optimize"
+	"github.com/easonliao/gofp/parser"
+	"github.com/easonliao/gofp/repl"
+)
+
+// newScope creates the global scope of a program with the builtins granted by caps, binding the
+// program arguments to *command-line-args*. The modules it requires are loaded by loader.
+func newScope(args []string, caps *ast.Capabilities, loader ast.Loader) *ast.Scope {
+	sc := ast.NewGlobalScopeWithOptions(&ast.Options{Capabilities: caps, Loader: loader})
+	sc.Insert("*command-line-args*", ast.NewStringList(args))
+	return sc
+}
+
+// limitFlags defines the flags limiting the evaluation on fs, the limits are set when fs is parsed.
+func limitFlags(fs *flag.FlagSet) *ast.Limits {
+	limits := &ast.Limits{}
+	fs.Int64Var(&limits.MaxSteps, "max-steps", 0, "stop after `n` function calls, 0 for no limit")
+	fs.IntVar(&limits.MaxDepth, "max-depth", 0, "limit the call depth to `n`, 0 for the default")
+	fs.DurationVar(&limits.Timeout, "timeout", 0, "stop after the `duration`, 0 for no limit")
+	fs.Int64Var(&limits.MaxMemory, "max-memory", 0, "stop when more than `n` bytes are held, 0 for no limit")
+	return limits
+}
+
+// capsFlag defines the flag choosing the capabilities of programs on fs.
+func capsFlag(fs *flag.FlagSet) *string {
+	return fs.String("caps", "", "grant only the comma separated `capabilities`, e.g. core,io,fs:readonly")
+}
+
+// pathFlag defines the flag giving the search path of the modules on fs.
+func pathFlag(fs *flag.FlagSet) *string {
+	return fs.String("path", os.Getenv("GOFPPATH"), "search the modules in the `dirs` separated by "+string(filepath.ListSeparator))
+}
+
+// newLoader returns the loader of the modules searched in dir, then in the directories of path,
+// whose files are read if caps grants it.
+func newLoader(dir, path string, caps *ast.Capabilities) *module.Loader {
+	return &module.Loader{Path: append([]string{dir}, module.SplitPath(path)...), Capabilities: caps}
+}
+
+// parseCaps parses the value of the capabilities flag, empty grants all the capabilities.
+func parseCaps(cmd *command, caps string) (*ast.Capabilities, bool) {
+	if caps == "" {
+		return ast.AllCapabilities(), true
+	}
+	c, err := ast.ParseCapabilities(strings.Split(caps, ",")...)
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return nil, false
+	}
+	return c, true
+}
+
+// evalSource parses, optimizes if asked to and evaluates all the expressions in src within the
+// limits, and returns the value of the last one. An interrupt stops the evaluation. The optimizer
+// folds the operators, it must not be asked for unless sc has the core capability.
+func evalSource(sc *ast.Scope, src []byte, showAST, optimized bool, limits *ast.Limits) (*ast.Object, error) {
+	exprs, err := parser.ParseExprs(src)
+	if err != nil {
+		return nil, err
+	}
+	if optimized {
+		exprs = optimize.Exprs(exprs)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	res := ast.NilObj
+	for _, expr := range exprs {
+		if showAST {
+			ast.Fprint(os.Stdout, expr, nil)
+		}
+		if res, err = ast.EvalContext(ctx, expr, sc, limits); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func runRun(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	showAST := fs.Bool("ast", false, "print the syntax tree of each expression before evaluating it")
+	contracts := fs.Bool("contracts", true, "check pre-conditions, post-conditions and assertions")
+	optimized := fs.Bool("O", true, "optimize the program before running it")
+	limits := limitFlags(fs)
+	capsList := capsFlag(fs)
+	path := pathFlag(fs)
+	if !cmd.parseFlags(fs, args, 1) {
+		return exitUsage
+	}
+	caps, ok := parseCaps(cmd, *capsList)
+	if !ok {
+		return exitUsage
+	}
+	ast.CheckContracts = *contracts
+	file := fs.Arg(0)
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	if _, err := evalSource(newScope(fs.Args()[1:], caps, newLoader(filepath.Dir(file), *path, caps)), src, *showAST, *optimized && caps.Has("core"), limits); err != nil {
+		errorf(cmd, "%s: %v", file, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runEval(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	src := fs.String("e", "", "the expressions to evaluate")
+	contracts := fs.Bool("contracts", true, "check pre-conditions, post-conditions and assertions")
+	optimized := fs.Bool("O", true, "optimize the expressions before evaluating them")
+	limits := limitFlags(fs)
+	capsList := capsFlag(fs)
+	path := pathFlag(fs)
+	if !cmd.parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+	caps, ok := parseCaps(cmd, *capsList)
+	if !ok {
+		return exitUsage
+	}
+	ast.CheckContracts = *contracts
+	if *src == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	res, err := evalSource(newScope(fs.Args(), caps, newLoader(".", *path, caps)), []byte(*src), false, *optimized && caps.Has("core"), limits)
+	if err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	fmt.Println(res)
+	return exitOK
+}
+
+func runREPL(cmd *command, args []string) int {
+	fs := cmd.flagSet()
+	showAST := fs.Bool("ast", false, "print the syntax tree of each expression before its result")
+	history := fs.String("history", repl.DefaultHistoryFile(), "the file keeping the input history")
+	limits := limitFlags(fs)
+	capsList := capsFlag(fs)
+	path := pathFlag(fs)
+	if !cmd.parseFlags(fs, args, 0) {
+		return exitUsage
+	}
+	caps, ok := parseCaps(cmd, *capsList)
+	if !ok {
+		return exitUsage
+	}
+	r := &repl.REPL{
+		NewScope:    func() *ast.Scope { return newScope(fs.Args(), caps, newLoader(".", *path, caps)) },
+		Out:         os.Stdout,
+		HistoryFile: *history,
+		ShowAST:     *showAST,
+		Limits:      limits,
+	}
+	if err := r.Run(os.Stdin); err != nil {
+		errorf(cmd, "%v", err)
+		return exitError
+	}
+	return exitOK
+}
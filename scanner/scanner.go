@@ -1,52 +1,89 @@
 package scanner
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/easonliao/gofp/token"
 )
 
+// ErrUnterminated is returned when the source ends in a string literal.
+var ErrUnterminated = errors.New("string literal not terminated")
+
+// Error is an error in the source, at the position of the token being scanned.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Mode controls the scanner behavior.
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota // Return comments as COMMENT tokens instead of skipping them.
+)
+
 type Scanner struct {
-	src      []byte
-	offset   int
-	rdoffset int
-	err      error
-	ch       rune
+	src        []byte
+	mode       Mode
+	offset     int
+	rdoffset   int
+	lineOffset int // Offset of the current line.
+	line       int
+	pos        token.Position // Position of the last token.
+	err        error
+	ch         rune
 }
 
 func (s *Scanner) Init(src []byte) {
-	s.src = src
+	s.InitMode(src, 0)
+}
+
+// InitMode prepares the scanner to tokenize src with the given mode.
+func (s *Scanner) InitMode(src []byte, mode Mode) {
+	*s = Scanner{src: src, mode: mode, line: 1}
 	s.next()
 }
 
+// Pos returns the position of the last token returned by Next.
+func (s *Scanner) Pos() token.Position {
+	return s.pos
+}
+
 func (s *Scanner) Next() (tok token.Token, lit string, err error) {
 	s.skipWhitespaces()
+	s.pos = token.Position{Offset: s.offset, Line: s.line, Column: s.offset - s.lineOffset + 1}
 
 	switch ch := s.ch; {
-	case isLetter(ch):
-		lit = s.scanIdent()
-		tok = token.Lookup(lit)
+	case ch == ';':
+		// Comments are only returned in ScanComments mode, otherwise skipped as whitespaces.
+		lit = s.scanComment()
+		tok = token.COMMENT
 
-	case isDigit(ch):
+	case isDigit(ch), (ch == '-' || ch == '+') && isDigit(s.peek()):
 		lit = s.scanNum()
 		tok = token.NUM
 
+	case isSymbolStart(ch):
+		// Keywords and operators like 'if' and '<=' are symbols with special meaning.
+		lit = s.scanIdent()
+		tok = token.Lookup(lit)
+
+	case ch == '"':
+		lit = s.scanString()
+		tok = token.STRING
+
 	default:
 		switch ch {
 		case -1:
 			tok = token.EOF
-		case '+':
-			tok = token.ADD
-		case '-':
-			tok = token.SUB
-		case '/':
-			tok = token.DIV
-		case '*':
-			tok = token.MULT
-		case '=':
-			tok = token.EQ
 		case '[':
 			tok = token.LBRACK
 		case ']':
@@ -55,27 +92,21 @@ func (s *Scanner) Next() (tok token.Token, lit string, err error) {
 			tok = token.LPAREN
 		case ')':
 			tok = token.RPAREN
+		case '{':
+			tok = token.LBRACE
+		case '}':
+			tok = token.RBRACE
 		case ',':
 			tok = token.COMMA
-		case '>':
-			tok = token.GT
-		case '<':
-			tok = token.LT
+		case '^':
+			tok = token.CARET
+		case '\'':
+			tok = token.QUOTE
 		default:
-			s.errorf("unregonized token %c", ch)
+			s.errorf("unrecognized token %c", ch)
 		}
 		lit = ""
 		s.next()
-		if tok == token.LT || tok == token.GT {
-			if s.ch == '=' {
-				if tok == token.LT {
-					tok = token.LE
-				} else {
-					tok = token.GE
-				}
-				s.next()
-			}
-		}
 	}
 	err = s.err
 	return
@@ -83,27 +114,132 @@ func (s *Scanner) Next() (tok token.Token, lit string, err error) {
 
 func (s *Scanner) scanIdent() string {
 	off := s.offset
-	for isLetter(s.ch) || isDigit(s.ch) {
+	for isSymbolChar(s.ch) {
 		s.next()
 	}
 	return string(s.src[off:s.offset])
 }
 
-func (s *Scanner) scanNum() string {
+// scanString scans a double quoted string literal, the returned literal includes the quotes and
+// escape sequences are kept as written.
+func (s *Scanner) scanString() string {
 	off := s.offset
-	for isDigit(s.ch) {
+	s.next()
+	for s.ch != '"' {
+		if s.ch == -1 {
+			if s.err == nil {
+				s.err = ErrUnterminated
+			}
+			return string(s.src[off:s.offset])
+		}
+		if s.ch == '\\' {
+			s.next()
+			if s.ch == -1 {
+				continue
+			}
+		}
 		s.next()
 	}
-	if s.ch == '.' {
+	s.next()
+	return string(s.src[off:s.offset])
+}
+
+// scanNum scans a numeric literal. The accepted forms are
+//
+//	[+-]digits[.digits][e[+-]digits]  integer or floating point number
+//	[+-]0x... [+-]0o... [+-]0b...     hexadecimal, octal and binary integer
+//	[+-]digits/digits                 ratio
+//	[+-]<integer>N                    big integer
+//
+// A single underscore may separate successive digits, e.g. 1_000_000.
+func (s *Scanner) scanNum() string {
+	off := s.offset
+	if s.ch == '-' || s.ch == '+' {
 		s.next()
-		for isDigit(s.ch) {
+	}
+	base := 10
+	if s.ch == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			s.next()
+			s.next()
+		}
+	}
+	if !s.scanDigits(base) {
+		return s.invalidNum(off, "expecting digits")
+	}
+	isInt := true
+	if base == 10 {
+		if s.ch == '.' {
+			isInt = false
+			s.next()
+			s.scanDigits(10)
+		}
+		if s.ch == 'e' || s.ch == 'E' {
+			isInt = false
+			s.next()
+			if s.ch == '-' || s.ch == '+' {
+				s.next()
+			}
+			if !s.scanDigits(10) {
+				return s.invalidNum(off, "exponent has no digits")
+			}
+		}
+		if s.ch == '/' && isInt {
 			s.next()
+			if !s.scanDigits(10) {
+				return s.invalidNum(off, "ratio denominator has no digits")
+			}
+			isInt = false
 		}
 	}
+	if s.ch == 'N' && isInt {
+		s.next()
+	}
+	if isSymbolChar(s.ch) {
+		return s.invalidNum(off, fmt.Sprintf("unexpected %q", s.ch))
+	}
 	return string(s.src[off:s.offset])
 }
 
+// scanDigits consumes digits of the given base, allowing an underscore between two digits. It
+// reports whether at least one digit was consumed.
+func (s *Scanner) scanDigits(base int) bool {
+	n := 0
+	for {
+		if digitVal(s.ch) < base {
+			n++
+		} else if s.ch != '_' || n == 0 || digitVal(s.peek()) >= base {
+			break
+		}
+		s.next()
+	}
+	return n > 0
+}
+
+// invalidNum skips the rest of a malformed numeric literal starting at off and records an error
+// describing it.
+func (s *Scanner) invalidNum(off int, reason string) string {
+	for isSymbolChar(s.ch) {
+		s.next()
+	}
+	lit := string(s.src[off:s.offset])
+	s.errorf("invalid number literal %q: %s", lit, reason)
+	return lit
+}
+
 func (s *Scanner) next() {
+	if s.ch == '\n' {
+		s.line++
+		s.lineOffset = s.rdoffset
+	}
 	if s.rdoffset == len(s.src) {
 		s.offset = len(s.src)
 		s.ch = -1
@@ -118,15 +254,40 @@ func (s *Scanner) next() {
 	}
 }
 
+// peek returns the character following the current one without advancing the scanner.
+func (s *Scanner) peek() rune {
+	if s.rdoffset == len(s.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRune(s.src[s.rdoffset:])
+	return r
+}
+
 func (s *Scanner) skipWhitespaces() {
-	for s.ch == ' ' || s.ch == '\t' || s.ch == '\n' || s.ch == '\r' {
+	for {
+		switch {
+		case s.ch == ' ' || s.ch == '\t' || s.ch == '\n' || s.ch == '\r':
+			s.next()
+		case s.ch == ';' && s.mode&ScanComments == 0:
+			s.scanComment()
+		default:
+			return
+		}
+	}
+}
+
+// scanComment scans a comment from ';' to the end of the line.
+func (s *Scanner) scanComment() string {
+	off := s.offset
+	for s.ch != '\n' && s.ch != -1 {
 		s.next()
 	}
+	return strings.TrimRight(string(s.src[off:s.offset]), " \t\r")
 }
 
 func (s *Scanner) errorf(format string, a ...interface{}) {
-	if s.err != nil {
-		s.err = fmt.Errorf(format, a)
+	if s.err == nil {
+		s.err = &Error{Pos: s.pos, Msg: fmt.Sprintf(format, a...)}
 	}
 }
 
@@ -137,9 +298,32 @@ func isLetter(ch rune) bool {
 	return false
 }
 
+// isSymbolStart reports whether ch can start a symbol. Besides letters, symbols may contain some
+// punctuation so that names like 'even?', 'set!', '->', '%' and ':pre' can be written. A '+' or
+// '-' followed by a digit starts a number instead.
+func isSymbolStart(ch rune) bool {
+	return isLetter(ch) || strings.ContainsRune("+-*/<>=!?&.%:", ch)
+}
+
+func isSymbolChar(ch rune) bool {
+	return isSymbolStart(ch) || isDigit(ch)
+}
+
 func isDigit(ch rune) bool {
 	if '0' <= ch && ch <= '9' || ch >= 0x80 && unicode.IsDigit(ch) {
 		return true
 	}
 	return false
 }
+
+func digitVal(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	}
+	return 16 // larger than any legal base.
+}
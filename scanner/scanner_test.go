@@ -8,13 +8,13 @@ import (
 
 func TestScanner(t *testing.T) {
 	var s Scanner
-	s.Init([]byte("a=1.1 b=2()[]<><=>="))
+	s.Init([]byte("a = 1.1 b = 2()[]< > <= >="))
 	tok, lit, _ := s.Next()
 	if tok != token.IDENT || lit != "a" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.EQ || lit != "" {
+	if tok != token.EQ || lit != "=" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
@@ -26,7 +26,7 @@ func TestScanner(t *testing.T) {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.EQ || lit != "" {
+	if tok != token.EQ || lit != "=" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
@@ -50,19 +50,19 @@ func TestScanner(t *testing.T) {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.LT || lit != "" {
+	if tok != token.LT || lit != "<" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.GT || lit != "" {
+	if tok != token.GT || lit != ">" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.LE || lit != "" {
+	if tok != token.LE || lit != "<=" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
-	if tok != token.GE || lit != "" {
+	if tok != token.GE || lit != ">=" {
 		t.Error("error")
 	}
 	tok, lit, _ = s.Next()
@@ -70,3 +70,95 @@ func TestScanner(t *testing.T) {
 		t.Error("error")
 	}
 }
+
+func TestScanNum(t *testing.T) {
+	valid := []string{"0", "-5", "+5", "1.5", "1.", "1e-9", "2.5E10", "0xFF", "-0x1f", "0o17", "0b1010",
+		"1_000_000", "0xFF_FF", "3/4", "-3/4", "123N", "0xFFN"}
+	for _, lit := range valid {
+		var s Scanner
+		s.Init([]byte(lit))
+		tok, l, err := s.Next()
+		if tok != token.NUM || l != lit || err != nil {
+			t.Errorf("scan %q: got %s %q %v", lit, token.TokenName(tok), l, err)
+		}
+	}
+	invalid := []string{"1.2.3", "1_", "1__0", "0x", "1e", "3/", "12abc", "1.5N", "3/4N", "0b102"}
+	for _, lit := range invalid {
+		var s Scanner
+		s.Init([]byte(lit))
+		if _, _, err := s.Next(); err == nil {
+			t.Errorf("scan %q: expect error", lit)
+		}
+	}
+}
+
+func TestScanSymbol(t *testing.T) {
+	tests := []struct {
+		src string
+		tok token.Token
+	}{
+		{"even?", token.IDENT},
+		{"set!", token.IDENT},
+		{"->", token.IDENT},
+		{"list*", token.IDENT},
+		{"str->int", token.IDENT},
+		{"my-fn", token.IDENT},
+		{"-foo", token.IDENT},
+		{"a.b", token.IDENT},
+		{"&", token.IDENT},
+		{"-", token.SUB},
+		{"+", token.ADD},
+		{"*", token.MULT},
+		{"/", token.DIV},
+		{"<=", token.LE},
+		{"=", token.EQ},
+		{"-5", token.NUM},
+		{"+5", token.NUM},
+	}
+	for _, test := range tests {
+		var s Scanner
+		s.Init([]byte(test.src))
+		tok, lit, err := s.Next()
+		if tok != test.tok || lit != test.src || err != nil {
+			t.Errorf("scan %q: got %s %q %v", test.src, token.TokenName(tok), lit, err)
+		}
+	}
+	var s Scanner
+	s.Init([]byte("(- x 1)"))
+	for _, tok := range []token.Token{token.LPAREN, token.SUB, token.IDENT, token.NUM, token.RPAREN, token.EOF} {
+		if got, _, _ := s.Next(); got != tok {
+			t.Errorf("expect %s, got %s", token.TokenName(tok), token.TokenName(got))
+		}
+	}
+}
+
+func TestScanPositionAndComments(t *testing.T) {
+	src := "(a ; first\n  \"b\nc\" d)"
+	var s Scanner
+	s.InitMode([]byte(src), ScanComments)
+	expects := []struct {
+		tok       token.Token
+		lit       string
+		line, col int
+	}{
+		{token.LPAREN, "", 1, 1},
+		{token.IDENT, "a", 1, 2},
+		{token.COMMENT, "; first", 1, 4},
+		{token.STRING, "\"b\nc\"", 2, 3},
+		{token.IDENT, "d", 3, 4},
+		{token.RPAREN, "", 3, 5},
+		{token.EOF, "", 3, 6},
+	}
+	for _, e := range expects {
+		tok, lit, err := s.Next()
+		if pos := s.Pos(); tok != e.tok || lit != e.lit || pos.Line != e.line || pos.Column != e.col || err != nil {
+			t.Errorf("got %s %q at %s, expect %s %q at %d:%d", token.TokenName(tok), lit, pos, token.TokenName(e.tok), e.lit, e.line, e.col)
+		}
+	}
+	s.Init([]byte(src))
+	for _, tok := range []token.Token{token.LPAREN, token.IDENT, token.STRING} {
+		if got, _, _ := s.Next(); got != tok {
+			t.Errorf("expect %s, got %s", token.TokenName(tok), token.TokenName(got))
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package token
+
+import "fmt"
+
+// Position is a location in the source.
+type Position struct {
+	Offset int // Byte offset, starting at 0.
+	Line   int // Line number, starting at 1.
+	Column int // Column number in bytes, starting at 1.
+}
+
+// IsValid reports whether the position is known.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
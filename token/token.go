@@ -11,6 +11,7 @@ const (
 
 	literal_beg
 	NUM    // '1.2'
+	STRING // '"abc"'
 	LT     // '<'
 	GT     // '>'
 	LE     // '<='
@@ -20,7 +21,11 @@ const (
 	RBRACK // ']'
 	LPAREN // '('
 	RPAREN // ')'
+	LBRACE // '{'
+	RBRACE // '}'
 	COMMA  // ','
+	CARET  // '^', starts a type hint or a metadata map.
+	QUOTE  // "'", quotes the module specs of require.
 	ADD    // '+'
 	SUB    // '-'
 	MULT   // '*'
@@ -28,43 +33,62 @@ const (
 	literal_end
 
 	keyword_beg
-	TRUE  // 'true'
-	FALSE // 'false'
-	DO    // 'do'
-	DEF   // 'def', declare variable.
-	DEFN  // 'defn', declare function.
-	LET   // 'let'
-	IF    // 'if'
-	FN    // 'fn'
+	TRUE      // 'true'
+	FALSE     // 'false'
+	NIL       // 'nil'
+	DO        // 'do'
+	DEF       // 'def', declare variable.
+	DEFN      // 'defn', declare function.
+	LET       // 'let'
+	IF        // 'if'
+	FN        // 'fn'
+	LAZY_SEQ  // 'lazy-seq'
+	ASSERT    // 'assert'
+	DEFN_PRIV // 'defn-', declare private function.
+	NS        // 'ns'
+	REQUIRE   // 'require'
 	keyword_end
 )
 
 var tokens = [...]string{
-	ILLEGAL: "[ILLEGAL]",
-	EOF:     "[EOF]",
-	NUM:     "[NUM]",
-	LT:      "<",
-	GT:      ">",
-	LE:      "<=",
-	GE:      ">=",
-	EQ:      "=",
-	LBRACK:  "[",
-	RBRACK:  "]",
-	LPAREN:  "(",
-	RPAREN:  ")",
-	COMMA:   ",",
-	ADD:     "+",
-	SUB:     "-",
-	MULT:    "*",
-	DIV:     "/",
-	TRUE:    "true",
-	FALSE:   "false",
-	DO:      "do",
-	DEF:     "def",
-	DEFN:    "defn",
-	LET:     "let",
-	IF:      "if",
-	FN:      "fn",
+	ILLEGAL:   "[ILLEGAL]",
+	EOF:       "[EOF]",
+	COMMENT:   "[COMMENT]",
+	IDENT:     "[IDENT]",
+	NUM:       "[NUM]",
+	STRING:    "[STRING]",
+	LT:        "<",
+	GT:        ">",
+	LE:        "<=",
+	GE:        ">=",
+	EQ:        "=",
+	LBRACK:    "[",
+	RBRACK:    "]",
+	LPAREN:    "(",
+	RPAREN:    ")",
+	LBRACE:    "{",
+	RBRACE:    "}",
+	COMMA:     ",",
+	CARET:     "^",
+	QUOTE:     "'",
+	ADD:       "+",
+	SUB:       "-",
+	MULT:      "*",
+	DIV:       "/",
+	TRUE:      "true",
+	FALSE:     "false",
+	NIL:       "nil",
+	DO:        "do",
+	DEF:       "def",
+	DEFN:      "defn",
+	LET:       "let",
+	IF:        "if",
+	FN:        "fn",
+	LAZY_SEQ:  "lazy-seq",
+	ASSERT:    "assert",
+	DEFN_PRIV: "defn-",
+	NS:        "ns",
+	REQUIRE:   "require",
 }
 
 var keywords map[string]Token
@@ -74,6 +98,19 @@ func init() {
 	for i := keyword_beg; i < keyword_end; i++ {
 		keywords[tokens[i]] = i
 	}
+	// Operators are scanned as symbols and looked up like keywords.
+	for _, op := range []Token{LT, GT, LE, GE, EQ, ADD, SUB, MULT, DIV} {
+		keywords[tokens[op]] = op
+	}
+}
+
+// IsOperator reports whether tok is one of the arithmetic or comparison operators.
+func (tok Token) IsOperator() bool {
+	switch tok {
+	case LT, GT, LE, GE, EQ, ADD, SUB, MULT, DIV:
+		return true
+	}
+	return false
 }
 
 func Lookup(ident string) Token {
@@ -83,8 +120,17 @@ func Lookup(ident string) Token {
 	return IDENT
 }
 
+// Keywords returns the names of all the keywords, i.e. the special forms.
+func Keywords() []string {
+	names := make([]string, 0, keyword_end-keyword_beg-1)
+	for i := keyword_beg + 1; i < keyword_end; i++ {
+		names = append(names, tokens[i])
+	}
+	return names
+}
+
 func TokenName(tok Token) string {
-	if int(tok) > len(tokens) {
+	if tok < 0 || int(tok) >= len(tokens) {
 		return "[INVALID TOKEN]"
 	}
 	return tokens[tok]
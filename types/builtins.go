@@ -0,0 +1,177 @@
+package types
+
+import (
+	"sync"
+
+	"github.com/easonliao/gofp/ast"
+)
+
+// builtin is the type of a builtin function.
+type builtin struct {
+	// value is the type of the function used as a value, where its sequences have no type.
+	value *Scheme
+	// arities maps a number of arguments to the type of the calls passing them.
+	arities map[int]*Scheme
+	// rest is the type of the calls with a number of arguments not in arities, its last parameter
+	// is repeated for every argument.
+	rest *Scheme
+}
+
+// call returns the type of a call to b with n arguments, or nil if b can't take n arguments.
+func (b *builtin) call(in *inferer, n, level int) *Func {
+	if s, ok := b.arities[n]; ok {
+		return in.instantiate(s, level).(*Func)
+	}
+	if b.rest == nil {
+		return nil
+	}
+	f := in.instantiate(b.rest, level).(*Func)
+	fixed := f.Params[:len(f.Params)-1]
+	if n < len(fixed) {
+		return nil
+	}
+	params := append([]Type(nil), fixed...)
+	for len(params) < n {
+		params = append(params, f.Params[len(f.Params)-1])
+	}
+	return &Func{Params: params, Result: f.Result}
+}
+
+// sig returns a builtin with the given types, one for each arity.
+func sig(types ...string) *builtin {
+	b := &builtin{arities: make(map[int]*Scheme)}
+	for _, t := range types {
+		s := MustParse(t)
+		if b.value == nil {
+			b.value = asValue(s)
+		}
+		b.arities[len(s.Type.(*Func).Params)] = s
+	}
+	return b
+}
+
+// variadic returns a builtin with the type of a value and of calls with any number of arguments.
+func variadic(value, rest string) *builtin {
+	b := &builtin{rest: MustParse(rest)}
+	if value != "" {
+		b.value = asValue(MustParse(value))
+	}
+	return b
+}
+
+// asValue returns the type of a builtin used as a value. The arguments of the calls through the
+// value aren't known, so its sequences may be any collection.
+func asValue(s *Scheme) *Scheme {
+	value := &Scheme{Vars: s.Vars}
+	value.Type = value.untypeSeqs(s.Type)
+	return value
+}
+
+// untypeSeqs replaces the sequences in t by new variables of s.
+func (s *Scheme) untypeSeqs(t Type) Type {
+	switch t := t.(type) {
+	case *Con:
+		if t.Name == "Seq" {
+			v := &Var{ID: -len(s.Vars) - 1}
+			s.Vars = append(s.Vars[:len(s.Vars):len(s.Vars)], v)
+			return v
+		}
+		args := make([]Type, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = s.untypeSeqs(arg)
+		}
+		return &Con{Name: t.Name, Args: args}
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, param := range t.Params {
+			params[i] = s.untypeSeqs(param)
+		}
+		return &Func{Params: params, Result: s.untypeSeqs(t.Result)}
+	}
+	return t
+}
+
+// seqArgs replaces the sequence parameters of a call to a builtin by the types of the arguments
+// passed: strings when the elements are Str, and arguments of unknown type which may be maps or
+// sets. Lists and the other arguments are expected to be lists of the elements.
+func seqArgs(fn *Func, args []Type) {
+	for i, param := range fn.Params {
+		seq, ok := param.(*Con)
+		if !ok || seq.Name != "Seq" {
+			continue
+		}
+		elem := seq.Args[0]
+		fn.Params[i] = List(elem)
+		switch arg := prune(args[i]).(type) {
+		case *Var:
+			fn.Params[i] = arg
+		case *Con:
+			if arg.Name == "Str" && unify(elem, Str) {
+				fn.Params[i] = arg
+			}
+		}
+	}
+}
+
+// builtins holds the types of the builtins which can be typed, the others can be used with any
+// type.
+var builtins = map[string]*builtin{
+	"+":          variadic("(-> Num Num Num)", "(-> Num Num)"),
+	"-":          variadic("(-> Num Num Num)", "(-> Num Num)"),
+	"*":          variadic("(-> Num Num Num)", "(-> Num Num)"),
+	"/":          variadic("(-> Num Num Num)", "(-> Num Num)"),
+	"<":          variadic("(-> Num Num Bool)", "(-> Num Bool)"),
+	">":          variadic("(-> Num Num Bool)", "(-> Num Bool)"),
+	"<=":         variadic("(-> Num Num Bool)", "(-> Num Bool)"),
+	">=":         variadic("(-> Num Num Bool)", "(-> Num Bool)"),
+	"=":          variadic("(-> a a Bool)", "(-> a Bool)"),
+	"list":       variadic("", "(-> a (List a))"),
+	"vector":     variadic("", "(-> a (List a))"),
+	"concat":     variadic("", "(-> (Seq a) (List a))"),
+	"interleave": variadic("", "(-> (Seq a) (List a))"),
+	"count":      sig("(-> a Num)"),
+	"first":      sig("(-> (Seq a) a)"),
+	"rest":       sig("(-> (Seq a) (List a))"),
+	"next":       sig("(-> (Seq a) (List a))"),
+	"seq":        sig("(-> (Seq a) (List a))"),
+	"sort":       sig("(-> (Seq a) (List a))", "(-> (-> a a b) (Seq a) (List a))"),
+	"cycle":      sig("(-> (Seq a) (List a))"),
+	"doall":      sig("(-> a a)"),
+	"dorun":      sig("(-> (Seq a) Nil)"),
+	"cons":       sig("(-> a (Seq a) (List a))"),
+	"map":        sig("(-> (-> a b) (Seq a) (List b))", "(-> (-> a b c) (Seq a) (Seq b) (List c))"),
+	"filter":     sig("(-> (-> a Bool) (Seq a) (List a))"),
+	"remove":     sig("(-> (-> a Bool) (Seq a) (List a))"),
+	"reduce":     sig("(-> (-> a a a) (Seq a) a)", "(-> (-> b a b) b (Seq a) b)"),
+	"take":       sig("(-> Num (Seq a) (List a))"),
+	"drop":       sig("(-> Num (Seq a) (List a))"),
+	"range":      sig("(-> Num (List Num))", "(-> (List Num))", "(-> Num Num (List Num))", "(-> Num Num Num (List Num))"),
+	"sort-by":    sig("(-> (-> a b) (Seq a) (List a))", "(-> (-> a b) (-> b b c) (Seq a) (List a))"),
+	"partition":  sig("(-> Num (Seq a) (List (List a)))", "(-> Num Num (Seq a) (List (List a)))"),
+	"iterate":    sig("(-> (-> a a) a (List a))"),
+	"repeat":     sig("(-> a (List a))", "(-> Num a (List a))"),
+	"rand":       sig("(-> Num)", "(-> Num Num)"),
+	"rand-int":   sig("(-> Num Num)"),
+	"rand-nth":   sig("(-> (Seq a) a)"),
+	"arglists":   sig("(-> a (List (List Str)))"),
+
+	"current-time-millis": sig("(-> Num)"),
+	"nano-time":           sig("(-> Num)"),
+	"slurp":               sig("(-> Str Str)"),
+	"line-seq":            sig("(-> Str (List Str))"),
+	"file-exists?":        sig("(-> Str Bool)"),
+	"list-dir":            sig("(-> Str (List Str))"),
+}
+
+// untyped holds the names of the builtins without a type in builtins, like the printing
+// functions taking arguments of any type. It's created on first use by isBuiltin.
+var (
+	untyped     *ast.Scope
+	untypedOnce sync.Once
+)
+
+// isBuiltin reports whether name is a builtin, typed or not.
+func isBuiltin(name string) bool {
+	untypedOnce.Do(func() { untyped = ast.NewGlobalScope() })
+	return untyped.Lookup(name) != nil
+}
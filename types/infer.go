@@ -0,0 +1,490 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/easonliao/gofp/ast"
+	"github.com/easonliao/gofp/token"
+)
+
+// Error is a type error in a program.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Env maps the names bound in a program to their types.
+type Env struct {
+	outer *Env
+	names map[string]*Scheme
+	// in is shared by all the environments of a program and creates the type variables.
+	in *inferer
+}
+
+// NewEnv creates the global environment holding the types of the builtins.
+func NewEnv() *Env {
+	return &Env{names: make(map[string]*Scheme), in: &inferer{}}
+}
+
+// Lookup returns the type of a name bound in env or one of its outer environments, or nil.
+func (env *Env) Lookup(name string) *Scheme {
+	for ; env != nil; env = env.outer {
+		if s, ok := env.names[name]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Insert binds a name to a type.
+func (env *Env) Insert(name string, s *Scheme) {
+	env.names[name] = s
+}
+
+func (env *Env) child() *Env {
+	return &Env{outer: env, names: make(map[string]*Scheme), in: env.in}
+}
+
+// Infer infers the type of a top level expression. Names bound by def and defn are added to env,
+// so that the following expressions can use them.
+func (env *Env) Infer(expr ast.Expr) (t Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			t, err = nil, e
+		}
+	}()
+	return env.in.infer(env, expr, 0), nil
+}
+
+// Check infers the types of the top level expressions of a program in env, or in a new
+// environment if env is nil, and returns the type errors found. An expression with an error
+// doesn't bind its name, so the following uses of the name are reported as well.
+func Check(exprs []ast.Expr, env *Env) []*Error {
+	if env == nil {
+		env = NewEnv()
+	}
+	var errs []*Error
+	for _, expr := range exprs {
+		if _, err := env.Infer(expr); err != nil {
+			errs = append(errs, err.(*Error))
+		}
+	}
+	return errs
+}
+
+type inferer struct {
+	nextID int
+	// aliases holds the names and aliases of the required modules, referAll is set after a
+	// require with :refer :all. The names of modules are not typed.
+	aliases  map[string]bool
+	referAll bool
+}
+
+func (in *inferer) fresh(level int) *Var {
+	in.nextID++
+	return &Var{ID: in.nextID, level: level}
+}
+
+// errorf aborts the inference of the current top level expression with a type error.
+func errorf(pos token.Position, format string, args ...interface{}) {
+	panic(&Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// instantiate returns a copy of the type of s with fresh variables for the quantified ones.
+func (in *inferer) instantiate(s *Scheme, level int) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	vars := make(map[*Var]Type, len(s.Vars))
+	for _, v := range s.Vars {
+		vars[v] = in.fresh(level)
+	}
+	return substitute(s.Type, vars)
+}
+
+func substitute(t Type, vars map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := vars[t]; ok {
+			return s
+		}
+		return t
+	case *Con:
+		if len(t.Args) == 0 {
+			return t
+		}
+		args := make([]Type, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = substitute(arg, vars)
+		}
+		return &Con{Name: t.Name, Args: args}
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, param := range t.Params {
+			params[i] = substitute(param, vars)
+		}
+		return &Func{Params: params, Result: substitute(t.Result, vars)}
+	}
+	return t
+}
+
+// generalize quantifies the variables of t created deeper than level, i.e. not bound in the
+// environment of the binding.
+func generalize(t Type, level int) *Scheme {
+	s := &Scheme{Type: t}
+	seen := make(map[*Var]bool)
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level > level && !seen[t] {
+				seen[t] = true
+				s.Vars = append(s.Vars, t)
+			}
+		case *Con:
+			for _, arg := range t.Args {
+				collect(arg)
+			}
+		case *Func:
+			for _, param := range t.Params {
+				collect(param)
+			}
+			collect(t.Result)
+		}
+	}
+	collect(t)
+	return s
+}
+
+// unify makes a and b the same type, it reports false if they can't be.
+func unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if va, ok := a.(*Var); ok {
+		if a == b {
+			return true
+		}
+		if occurs(va, b) {
+			return false
+		}
+		va.Instance = b
+		return true
+	}
+	if _, ok := b.(*Var); ok {
+		return unify(b, a)
+	}
+	switch a := a.(type) {
+	case *Con:
+		b, ok := b.(*Con)
+		if !ok || a.Name != b.Name || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !unify(a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *Func:
+		b, ok := b.(*Func)
+		if !ok || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return unify(a.Result, b.Result)
+	}
+	return false
+}
+
+// occurs reports whether v occurs in t, and lowers the level of the variables of t to the level
+// of v since t takes the place of v.
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t.level > v.level {
+			t.level = v.level
+		}
+		return t == v
+	case *Con:
+		for _, arg := range t.Args {
+			if occurs(v, arg) {
+				return true
+			}
+		}
+	case *Func:
+		for _, param := range t.Params {
+			if occurs(v, param) {
+				return true
+			}
+		}
+		return occurs(v, t.Result)
+	}
+	return false
+}
+
+// expect unifies the type of an expression with the type required by its context.
+func expect(expr ast.Expr, got, want Type, context string) {
+	if !unify(want, got) {
+		strs := typeStrings(want, got)
+		_, v1 := prune(want).(*Var)
+		_, v2 := prune(got).(*Var)
+		if v1 || v2 {
+			// Unifying a variable only fails when it occurs in the other type.
+			errorf(expr.Pos(), "%s has an infinite type: %s = %s", context, strs[0], strs[1])
+		}
+		errorf(expr.Pos(), "%s must be %s, got %s", context, strs[0], strs[1])
+	}
+}
+
+func (in *inferer) infer(env *Env, expr ast.Expr, level int) Type {
+	switch n := expr.(type) {
+	case *ast.NilExpr:
+		return in.fresh(level)
+
+	case *ast.NumExpr:
+		return Num
+
+	case *ast.BooleanExpr:
+		return Bool
+
+	case *ast.StringExpr:
+		return Str
+
+	case *ast.IdentExpr:
+		if s := env.Lookup(n.Name); s != nil {
+			return in.instantiate(s, level)
+		}
+		if b, ok := builtins[n.Name]; ok && b.value != nil {
+			return in.instantiate(b.value, level)
+		}
+		if isBuiltin(n.Name) || in.referAll {
+			return in.fresh(level)
+		}
+		if i := strings.IndexByte(n.Name, '/'); i > 0 && in.aliases[n.Name[:i]] {
+			return in.fresh(level)
+		}
+		errorf(n.Pos(), "%q is not defined", n.Name)
+
+	case *ast.VectorExpr:
+		elem := in.fresh(level)
+		for _, e := range n.Exprs.Exprs {
+			expect(e, in.infer(env, e, level), elem, "vector element")
+		}
+		return List(elem)
+
+	case *ast.DefExpr:
+		in.inferMeta(env, n.Meta, level)
+		t := in.infer(env, n.Expr, level+1)
+		top(env).Insert(n.Ident.Name, generalize(t, level))
+		return in.fresh(level)
+
+	case *ast.DefnExpr:
+		in.inferMeta(env, n.Meta, level)
+		// The function is monomorphic in its own body.
+		self := in.fresh(level + 1)
+		inner := env.child()
+		inner.Insert(n.Ident.Name, &Scheme{Type: self})
+		t := in.infer(inner, n.Expr, level+1)
+		expect(n, t, self, "recursive use of "+n.Ident.Name)
+		top(env).Insert(n.Ident.Name, generalize(t, level))
+		return in.fresh(level)
+
+	case *ast.FuncExpr:
+		inner := env.child()
+		params := make([]Type, len(n.Params))
+		for i, param := range n.Params {
+			var t Type = in.fresh(level)
+			if i < len(n.ParamTags) {
+				if hint := in.hintType(n.ParamTags[i], level); hint != nil {
+					t = hint
+				}
+			}
+			params[i] = t
+			inner.Insert(param.Name, &Scheme{Type: t})
+		}
+		if n.Pre != nil {
+			in.infer(inner, n.Pre, level)
+		}
+		result := in.infer(inner, n.Expr, level)
+		if hint := in.hintType(n.ResultTag, level); hint != nil {
+			expect(n.Expr, result, hint, "result")
+		}
+		if n.Post != nil {
+			post := inner.child()
+			post.Insert("%", &Scheme{Type: result})
+			in.infer(post, n.Post, level)
+		}
+		return &Func{Params: params, Result: result}
+
+	case *ast.ExprList:
+		var t Type = in.fresh(level)
+		for _, e := range n.Exprs {
+			t = in.infer(env, e, level)
+		}
+		return t
+
+	case *ast.CallExpr:
+		return in.inferCall(env, n, level)
+
+	case *ast.DoExpr:
+		return in.infer(env, n.Exprs, level)
+
+	case *ast.IfExpr:
+		expect(n.Cond, in.infer(env, n.Cond, level), Bool, "condition of if")
+		t := in.infer(env, n.Then, level)
+		if n.Else != nil {
+			expect(n.Else, in.infer(env, n.Else, level), t, "else branch of if")
+		}
+		return t
+
+	case *ast.BinaryOp:
+		left, right := in.infer(env, n.Left, level), in.infer(env, n.Right, level)
+		if n.Op == token.EQ {
+			expect(n.Right, right, left, "operand of =")
+		} else {
+			expect(n.Left, left, Num, "operand of "+token.TokenName(n.Op))
+			expect(n.Right, right, Num, "operand of "+token.TokenName(n.Op))
+		}
+		return Bool
+
+	case *ast.MultiOp:
+		for _, e := range n.Exprs.Exprs {
+			expect(e, in.infer(env, e, level), Num, "operand of "+token.TokenName(n.Op))
+		}
+		return Num
+
+	case *ast.BindExpr:
+		t := in.infer(env, n.Value, level+1)
+		env.Insert(n.Ident.Name, generalize(t, level))
+		return t
+
+	case *ast.LetExpr:
+		inner := env.child()
+		for _, binding := range n.Bindings {
+			in.infer(inner, binding, level)
+		}
+		return in.infer(inner, n.Body, level)
+
+	case *ast.LazySeqExpr:
+		t := List(in.fresh(level))
+		expect(n.Body, in.infer(env, n.Body, level), t, "body of lazy-seq")
+		return t
+
+	case *ast.AssertExpr:
+		in.infer(env, n.Cond, level)
+		if n.Msg != nil {
+			in.infer(env, n.Msg, level)
+		}
+		return in.fresh(level)
+
+	case *ast.NsExpr:
+		return in.fresh(level)
+
+	case *ast.RequireExpr:
+		if in.aliases == nil {
+			in.aliases = make(map[string]bool)
+		}
+		for _, spec := range n.Specs {
+			in.aliases[spec.Module.Name] = true
+			if spec.Alias != nil {
+				in.aliases[spec.Alias.Name] = true
+			}
+			for _, ident := range spec.Refer {
+				top(env).Insert(ident.Name, generalize(in.fresh(level+1), level))
+			}
+			in.referAll = in.referAll || spec.ReferAll
+		}
+		return in.fresh(level)
+	}
+	panic(fmt.Sprintf("types: unexpected node type %T", expr))
+}
+
+// inferMeta infers the types of the values of a metadata map, which may have any type.
+func (in *inferer) inferMeta(env *Env, meta []*ast.MetaEntry, level int) {
+	for _, entry := range meta {
+		in.infer(env, entry.Value, level)
+	}
+}
+
+// hintType returns the type of the values satisfying a type hint, or nil if the type hint doesn't
+// have one.
+func (in *inferer) hintType(tag string, level int) Type {
+	switch tag {
+	case "Int", "BigInt", "Ratio", "Double", "Number":
+		return Num
+	case "String":
+		return Str
+	case "Boolean":
+		return Bool
+	case "List", "Vector", "Seq":
+		return List(in.fresh(level))
+	}
+	return nil
+}
+
+// top returns the global environment, where def binds names.
+func top(env *Env) *Env {
+	for env.outer != nil {
+		env = env.outer
+	}
+	return env
+}
+
+func (in *inferer) inferCall(env *Env, call *ast.CallExpr, level int) Type {
+	args := make([]Type, len(call.Args.Exprs))
+	for i, arg := range call.Args.Exprs {
+		args[i] = in.infer(env, arg, level)
+	}
+	result := in.fresh(level)
+	want := &Func{Params: args, Result: result}
+	// Builtins taking a variable number of arguments have a type for each arity.
+	if ident, ok := call.Fun.(*ast.IdentExpr); ok && env.Lookup(ident.Name) == nil {
+		if b, ok := builtins[ident.Name]; ok {
+			fn := b.call(in, len(args), level)
+			if fn == nil {
+				errorf(call.Pos(), "wrong number of arguments to %s: %d", ident.Name, len(args))
+			}
+			seqArgs(fn, args)
+			in.unifyCall(call, ident.Name, fn, want)
+			return result
+		}
+	}
+	fn := in.infer(env, call.Fun, level)
+	name := "function"
+	if ident, ok := call.Fun.(*ast.IdentExpr); ok {
+		name = ident.Name
+	}
+	in.unifyCall(call, name, fn, want)
+	return result
+}
+
+// unifyCall unifies the type of the function called with the type of the call, reporting the
+// argument which doesn't match.
+func (in *inferer) unifyCall(call *ast.CallExpr, name string, fn Type, want *Func) {
+	if f, ok := prune(fn).(*Func); ok {
+		if len(f.Params) != len(want.Params) {
+			errorf(call.Pos(), "wrong number of arguments to %s: got %d, want %d", name, len(want.Params), len(f.Params))
+		}
+		for i, param := range f.Params {
+			expect(call.Args.Exprs[i], want.Params[i], param, fmt.Sprintf("argument %d of %s", i+1, name))
+		}
+		expect(call, f.Result, want.Result, "result of "+name)
+		return
+	}
+	if _, ok := prune(fn).(*Var); !ok {
+		errorf(call.Pos(), "%s is not a function, it has type %s", name, fn)
+	}
+	expect(call.Fun, fn, want, name)
+}
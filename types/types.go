@@ -0,0 +1,274 @@
+// Package types infers Hindley-Milner types for gofp programs.
+//
+// All the numbers have type Num. Lists, vectors and sequences have type (List a) and functions
+// (-> a b c) for a function taking an a and a b and returning a c. nil may be used as a value of
+// any type, since it stands for the empty sequence as well as for no value. Names bound with def,
+// defn and let are polymorphic: (defn id [x] x) has type (-> a a) and can be applied to values of
+// different types.
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/easonliao/gofp/scanner"
+	"github.com/easonliao/gofp/token"
+)
+
+// Type is a type of gofp values.
+type Type interface {
+	String() string
+}
+
+type (
+	// Var is a type variable, Instance is set once it's unified with another type.
+	Var struct {
+		ID       int
+		Instance Type
+		// level is the nesting depth of the let binding where the variable was created, used to
+		// decide which variables can be generalized.
+		level int
+	}
+
+	// Con is a type constructor applied to type arguments, like Num or (List Num).
+	Con struct {
+		Name string
+		Args []Type
+	}
+
+	// Func is the type of functions.
+	Func struct {
+		Params []Type
+		Result Type
+	}
+)
+
+// The base types. Nil is the result of builtins which return nothing, nil itself may be used as a
+// value of any type.
+var (
+	Num  = &Con{Name: "Num"}
+	Bool = &Con{Name: "Bool"}
+	Str  = &Con{Name: "Str"}
+	Nil  = &Con{Name: "Nil"}
+)
+
+// List returns the type of lists of elem.
+func List(elem Type) *Con {
+	return &Con{Name: "List", Args: []Type{elem}}
+}
+
+// Seq returns the type of the collections of elem walked by builtins: lists of elem, strings if
+// elem is Str, and maps and sets which have no type. It's only used for the parameters of
+// builtins, which take the type of the argument passed.
+func Seq(elem Type) *Con {
+	return &Con{Name: "Seq", Args: []Type{elem}}
+}
+
+func (t *Var) String() string  { return typeString(t) }
+func (t *Con) String() string  { return typeString(t) }
+func (t *Func) String() string { return typeString(t) }
+
+// Scheme is a polymorphic type, the variables in Vars stand for any type.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+func (s *Scheme) String() string {
+	return typeString(s.Type)
+}
+
+// prune returns the type a variable stands for, following the chain of instances.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.Instance == nil {
+			return t
+		}
+		t = v.Instance
+	}
+}
+
+// typePrinter prints types, naming the variables a, b, c... in order of appearance.
+type typePrinter struct {
+	names map[*Var]string
+}
+
+func typeString(t Type) string {
+	p := &typePrinter{names: make(map[*Var]string)}
+	return p.String(t)
+}
+
+// typeStrings prints types with consistent variable names.
+func typeStrings(types ...Type) []string {
+	p := &typePrinter{names: make(map[*Var]string)}
+	strs := make([]string, len(types))
+	for i, t := range types {
+		strs[i] = p.String(t)
+	}
+	return strs
+}
+
+func (p *typePrinter) String(t Type) string {
+	var b strings.Builder
+	p.write(&b, t)
+	return b.String()
+}
+
+func (p *typePrinter) write(b *strings.Builder, t Type) {
+	switch t := prune(t).(type) {
+	case *Var:
+		name, ok := p.names[t]
+		if !ok {
+			n := len(p.names)
+			name = string(rune('a' + n%26))
+			if n >= 26 {
+				name += fmt.Sprint(n / 26)
+			}
+			p.names[t] = name
+		}
+		b.WriteString(name)
+	case *Con:
+		if len(t.Args) == 0 {
+			b.WriteString(t.Name)
+			return
+		}
+		b.WriteString("(" + t.Name)
+		for _, arg := range t.Args {
+			b.WriteString(" ")
+			p.write(b, arg)
+		}
+		b.WriteString(")")
+	case *Func:
+		b.WriteString("(->")
+		for _, param := range t.Params {
+			b.WriteString(" ")
+			p.write(b, param)
+		}
+		b.WriteString(" ")
+		p.write(b, t.Result)
+		b.WriteString(")")
+	}
+}
+
+// Parse parses a type written in the syntax used to print them:
+//
+//	Num Bool Str Nil    base types
+//	(List t)            lists of t
+//	(Seq t)             collections of t, for the parameters of builtins
+//	(-> t1 ... tn t)    functions taking arguments of types t1 ... tn and returning a t
+//	a b c               type variables, any lower case name
+//
+// The type variables are quantified in the scheme returned.
+func Parse(src string) (*Scheme, error) {
+	p := &typeParser{vars: make(map[string]*Var)}
+	p.s.Init([]byte(src))
+	p.next()
+	t := p.parse()
+	if p.err == nil && p.tok != token.EOF {
+		p.errorf("unexpected %s after type", p.desc())
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	s := &Scheme{Type: t}
+	for _, name := range p.order {
+		s.Vars = append(s.Vars, p.vars[name])
+	}
+	return s, nil
+}
+
+// MustParse is like Parse but panics if the type is invalid.
+func MustParse(src string) *Scheme {
+	s, err := Parse(src)
+	if err != nil {
+		panic(fmt.Sprintf("types: %q: %v", src, err))
+	}
+	return s
+}
+
+type typeParser struct {
+	s     scanner.Scanner
+	tok   token.Token
+	lit   string
+	err   error
+	vars  map[string]*Var
+	order []string
+}
+
+func (p *typeParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.lit, p.err = p.s.Next()
+}
+
+func (p *typeParser) desc() string {
+	if p.lit != "" {
+		return p.lit
+	}
+	return token.TokenName(p.tok)
+}
+
+func (p *typeParser) errorf(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *typeParser) parse() Type {
+	if p.err != nil {
+		return nil
+	}
+	switch p.tok {
+	case token.IDENT:
+		name := p.lit
+		p.next()
+		switch name {
+		case "Num":
+			return Num
+		case "Bool":
+			return Bool
+		case "Str":
+			return Str
+		case "Nil":
+			return Nil
+		}
+		if name[0] < 'a' || name[0] > 'z' {
+			p.errorf("unknown type %s", name)
+			return nil
+		}
+		v, ok := p.vars[name]
+		if !ok {
+			v = &Var{ID: -len(p.vars) - 1}
+			p.vars[name] = v
+			p.order = append(p.order, name)
+		}
+		return v
+	case token.LPAREN:
+		p.next()
+		head := p.desc()
+		p.next()
+		var args []Type
+		for p.err == nil && p.tok != token.RPAREN && p.tok != token.EOF {
+			args = append(args, p.parse())
+		}
+		if p.tok != token.RPAREN {
+			p.errorf("expect ) at the end of type")
+			return nil
+		}
+		p.next()
+		switch {
+		case head == "List" && len(args) == 1:
+			return List(args[0])
+		case head == "Seq" && len(args) == 1:
+			return Seq(args[0])
+		case head == "->" && len(args) >= 1:
+			return &Func{Params: args[:len(args)-1], Result: args[len(args)-1]}
+		}
+		p.errorf("invalid type (%s ...)", head)
+		return nil
+	}
+	p.errorf("unexpected %s in type", p.desc())
+	return nil
+}
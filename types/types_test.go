@@ -0,0 +1,109 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/easonliao/gofp/parser"
+)
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1", "Num"},
+		{`"s"`, "Str"},
+		{"(< 1 2)", "Bool"},
+		{"[1 2 3]", "(List Num)"},
+		{"(fn [x] x)", "(-> a a)"},
+		{"(fn [f x] (f x))", "(-> (-> a b) a b)"},
+		{"(defn id [x] x) (id id)", "(-> a a)"},
+		{"(defn id [x] x) [(id 1) (id 2)]", "(List Num)"},
+		{"(let [id (fn [x] x)] (if (id true) (id 1) 2))", "Num"},
+		{"(map (fn [x] (< x 1)) [1 2])", "(List Bool)"},
+		{"(map + [1 2] [3 4])", "(List Num)"},
+		{"(reduce + 0 (range 10))", "Num"},
+		{"(defn fact [n] (if (= n 0) 1 (* n (fact (- n 1))))) fact", "(-> Num Num)"},
+		{"(defn len [l] (if (= l nil) 0 (+ 1 (len (rest l))))) len", "(-> (List a) Num)"},
+		{"(lazy-seq (cons 1 nil))", "(List Num)"},
+		{"(def x (println 1)) x", "a"},
+		{"(fn [^Double x ^Seq l] ^Seq (cons x l))", "(-> Num (List Num) (List Num))"},
+		{`(first "abc")`, "Str"},
+		{`(map first ["ab" "cd"])`, "(List a)"},
+		{`(concat "ab" ["c"])`, "(List Str)"},
+		{"(fn [m] (count (seq m)))", "(-> a Num)"},
+		{"(dorun [1 2])", "Nil"},
+		{"(sort > [3 1 2])", "(List Num)"},
+	}
+	for _, test := range tests {
+		exprs, err := parser.ParseExprs([]byte(test.src))
+		if err != nil {
+			t.Fatalf("%s: %v", test.src, err)
+		}
+		env := NewEnv()
+		var typ Type
+		for _, expr := range exprs {
+			if typ, err = env.Infer(expr); err != nil {
+				t.Fatalf("%s: %v", test.src, err)
+			}
+		}
+		if typ.String() != test.want {
+			t.Errorf("%s: got %s, want %s", test.src, typ, test.want)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"(+ 1 true)", []string{"1:6: operand of + must be Num, got Bool"}},
+		{"(if 1 2 3)", []string{"1:5: condition of if must be Bool, got Num"}},
+		{"(if true 1 \"a\")", []string{"1:12: else branch of if must be Num, got Str"}},
+		{"[1 \"a\"]", []string{"1:4: vector element must be Num, got Str"}},
+		{"(defn f [x] (+ x 1))\n(f \"a\")", []string{"2:4: argument 1 of f must be Num, got Str"}},
+		{"(defn f [x] x)\n(f 1 2)", []string{"2:1: wrong number of arguments to f: got 2, want 1"}},
+		{"(first 1 2)", []string{"1:1: wrong number of arguments to first: 2"}},
+		{`(map (fn [x] (+ x 1)) ["a"])`, []string{"1:23: argument 2 of map must be (List Num), got (List Str)"}},
+		{"(first 1)", []string{"1:8: argument 1 of first must be (List a), got Num"}},
+		{`(map (fn [x] (+ x 1)) "ab")`, []string{"1:6: argument 1 of map must be (-> Str a), got (-> Num Num)"}},
+		{"(def x 1)\n(x 1)", []string{"2:1: x is not a function, it has type Num"}},
+		{"(defn f [^String s] s)\n(f 1)", []string{"2:4: argument 1 of f must be Str, got Num"}},
+		{"(fn [x] ^Boolean (+ x 1))", []string{"1:18: result must be Bool, got Num"}},
+		{"(fn [x] (x x))", []string{"1:10: x has an infinite type: (-> a b) = a"}},
+		{"(def x (+ 1 true))\nx", []string{"1:13: operand of + must be Num, got Bool", "2:1: \"x\" is not defined"}},
+	}
+	for _, test := range tests {
+		exprs, err := parser.ParseExprs([]byte(test.src))
+		if err != nil {
+			t.Fatalf("%s: %v", test.src, err)
+		}
+		var got []string
+		for _, err := range Check(exprs, nil) {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, src := range []string{"Num", "(List Str)", "(-> a (List a) Bool)", "(-> (-> a b) (List a) (List b))", "(-> Num)", "(-> (Seq a) Nil)"} {
+		s, err := Parse(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if s.String() != src {
+			t.Errorf("got %s, want %s", s, src)
+		}
+	}
+	for _, src := range []string{"", "Foo", "(List)", "(Num Bool)", "(-> a", "Num Num"} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}